@@ -8,18 +8,40 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"sync"
 	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/dao"
+	"wxbot-lostandfound/handler"
+	"wxbot-lostandfound/scheduler"
+	"wxbot-lostandfound/speech"
 	"wxbot-lostandfound/utils"
+	"wxbot-lostandfound/webhook"
 	"wxbot-lostandfound/wxbizmsgcrypt"
 )
 
 type BotConfig struct {
-	CorpId         string
-	CorpSecret     string
-	AgentId        int
-	Token          string
-	AccessToken    string
-	EncodingAesKey string
+	CorpId             string
+	CorpSecret         string
+	AgentId            int
+	Token              string
+	AccessToken        string
+	EncodingAesKey     string
+	Admins             []string                // 管理员的企业微信用户名
+	MaxClaimAttempts   int                     // 认领时回答验证问题的最大次数
+	PickupLocations    map[string][]string     // 每个城市可选的取回地点 如前台、储物柜
+	Locations          []*utils.Location       // 地点层级 城市 -> 园区/楼栋 -> 楼层 -> 会议室
+	SearchRadiusKm     float64                 // 发送位置搜索记录时的搜索半径
+	Speech             speech.Config           // 语音识别
+	EnableTemplateCard bool                    // 菜单以模板卡片按钮的形式发送 关闭时使用文字菜单
+	RecordFormat       string                  // 记录的展示格式 markdown text news textcard
+	LocaleDir          string                  // 语言文件目录 默认为locales
+	DefaultLanguage    string                  // 默认语言 默认为zh
+	SubscriptionDays   int                     // 订阅的有效天数
+	Webhooks           []webhook.Target        // 推送新记录的群机器人 可按城市或办公地点配置
+	Schedule           ScheduleConfig          // 定时任务
+	BaseUrl            string                  // 机器人http服务对外的地址 用于图片和详情页链接
+	Database           dao.Config              // 数据库 可以使用sqlite postgres mysql
+	Dashboard          handler.DashboardConfig // 管理后台
 }
 type TokenResponse struct {
 	Errcode     int    `json:"errcode"`
@@ -36,6 +58,12 @@ var (
 	// 会话map,定时清理
 	conversationMap map[string]*conversation.Conversation
 	acceptMap       map[uint32]struct{}
+	// 处理消息时持有 http请求和语音识别后的会话会同时读写conversationMap、acceptMap和会话内容
+	conversationLock sync.Mutex
+	renderer         handler.Renderer
+	repo             dao.Repository // 数据库 启动时注入
+	// 企业微信接口地址 测试时指向本地的替身
+	apiBaseUrl = "https://qyapi.weixin.qq.com"
 )
 
 func init() {
@@ -48,16 +76,34 @@ func GetBotConfig() *BotConfig {
 	return botConfig
 }
 
-func Start() {
+// 判断用户是否为配置中的管理员
+func isAdmin(userName string) bool {
+	return utils.IfWordInSlice(userName, botConfig.Admins)
+}
+
+func Start(repository dao.Repository) {
 	// receive_id 企业应用的回调，表示corpid
 	log.Println("Starting bot...")
+	repo = repository
+	handler.SetRepository(repository)
+	LoadLocations(repository)
+	loadLocales()
+	initBroadcast()
+	go newScheduler(scheduler.RealClock).Run(nil)
+	transcriber = speech.NewTranscriber(botConfig.Speech)
+	renderer = handler.NewRenderer(botConfig.RecordFormat)
+	handler.SetBaseUrl(botConfig.BaseUrl)
+	handler.SetDetailSecret(botConfig.EncodingAesKey)
 	token, err := getAccessToken()
 	botConfig.AccessToken = token
 	utils.CheckError(err, "初始化获取access token")
 	wxcrypt = wxbizmsgcrypt.NewWXBizMsgCrypt(botConfig.Token, botConfig.EncodingAesKey, botConfig.CorpId, wxbizmsgcrypt.XmlType)
-	// 静态文件服务器，用于展示图片
-	fs := http.FileServer(http.Dir("imgs/"))
-	http.Handle("/api/bot/imgs/", http.StripPrefix("/api/bot/imgs/", fs))
+	// 记录的图片 只能通过带签名的链接查看
+	http.HandleFunc("/api/bot/imgs/", protect(handler.RecordImage))
+	// 记录详情页 卡片和图文消息的链接
+	http.HandleFunc("/api/bot/records/", protect(handler.RecordDetail))
+	// 管理后台 管理员通过企业微信网页授权登录
+	http.Handle("/admin/", handler.NewDashboard(botConfig.Dashboard, isAdmin, wecomOAuth{}))
 	// 开启一个http服务器，接收来自企业微信的消息
 	http.HandleFunc("/api/bot/message", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == "GET" {
@@ -71,6 +117,15 @@ func Start() {
 	log.Fatalln(http.ListenAndServe("127.0.0.1:8888", nil))
 }
 
+// 加载地点层级 在管理后台修改过地点时使用数据库中保存的地点
+func LoadLocations(repository dao.Repository) {
+	if paths := repository.GetLocations(); len(paths) > 0 {
+		utils.SetLocations(utils.BuildLocations(paths))
+		return
+	}
+	utils.SetLocations(botConfig.Locations)
+}
+
 func handleVerify(w http.ResponseWriter, r *http.Request) {
 	msgSignature := r.URL.Query().Get("msg_signature")
 	timestamp := r.URL.Query().Get("timestamp")
@@ -102,10 +157,18 @@ func handleMessage(w http.ResponseWriter, r *http.Request) {
 	msgContent := conversation.MsgContentPool.Get().(*conversation.MsgContent)
 	utils.CheckError(xml.Unmarshal(msg, &msgContent), "消息反序列化")
 	log.Println("读取到消息", msgContent)
+	conversationLock.Lock()
+	defer conversationLock.Unlock()
 	if _, exist := acceptMap[msgContent.CreateTime]; exist {
 		log.Println("接收到重复的消息")
 	} else {
 		acceptMap[msgContent.CreateTime] = struct{}{}
+		ctx := conversation.ConversationContext{
+			ReceiveContent: msgContent,
+			W:              w,
+			Timestamp:      timestamp,
+			Nonce:          nonce,
+		}
 		// 读取当前的会话map
 		switch msgContent.MsgType {
 		/*
@@ -133,16 +196,32 @@ func handleMessage(w http.ResponseWriter, r *http.Request) {
 				定时推送消息
 		*/
 		case "text":
-			err = startConversation(msgContent, nil, w, timestamp, nonce)
+			err = startConversation(ctx)
 			utils.CheckError(err, "被动回复消息")
 		case "image":
 			imgMsgContent := conversation.ImgMsgContentPool.Get().(*conversation.ImgContent)
 			_ = xml.Unmarshal(msg, imgMsgContent)
-			err = startConversation(msgContent, imgMsgContent, w, timestamp, nonce)
+			ctx.ImgContent = imgMsgContent
+			err = startConversation(ctx)
 			conversation.ImgMsgContentPool.Put(imgMsgContent)
+		case "location":
+			locationMsgContent := conversation.LocationMsgContentPool.Get().(*conversation.LocationContent)
+			_ = xml.Unmarshal(msg, locationMsgContent)
+			ctx.LocationContent = locationMsgContent
+			err = startConversation(ctx)
+			conversation.LocationMsgContentPool.Put(locationMsgContent)
+		case "voice":
+			voiceMsgContent := conversation.VoiceMsgContentPool.Get().(*conversation.VoiceContent)
+			_ = xml.Unmarshal(msg, voiceMsgContent)
+			err = handleVoice(ctx, voiceMsgContent)
+			conversation.VoiceMsgContentPool.Put(voiceMsgContent)
+			utils.CheckError(err, "处理语音消息")
+		case "event":
+			err = handleEvent(ctx)
+			utils.CheckError(err, "处理事件")
 		default:
 			// 无法处理的消息
-			err = replyText(*msgContent, w, timestamp, nonce, "抱歉,机器人无法处理当前类型消息。")
+			err = replyText(*msgContent, w, timestamp, nonce, trUser(msgContent.FromUsername, "unsupported_message"))
 			utils.CheckError(err, "被动回复消息(消息无法处理)")
 		}
 	}
@@ -166,7 +245,7 @@ func protect(function HandleFunc) HandleFunc {
 }
 
 func getAccessToken() (accessToken string, err error) {
-	resp, err := http.Get(fmt.Sprintf("https://qyapi.weixin.qq.com/cgi-bin/gettoken?corpid=%s&corpsecret=%s", botConfig.CorpId, botConfig.CorpSecret))
+	resp, err := http.Get(fmt.Sprintf("%s/cgi-bin/gettoken?corpid=%s&corpsecret=%s", apiBaseUrl, botConfig.CorpId, botConfig.CorpSecret))
 	accessTokenResponse := new(TokenResponse)
 	if err != nil {
 		return
@@ -0,0 +1,138 @@
+package bot
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/dao"
+	"wxbot-lostandfound/handler"
+	"wxbot-lostandfound/i18n"
+	"wxbot-lostandfound/webhook"
+	"wxbot-lostandfound/wxbizmsgcrypt"
+)
+
+// 测试用的机器人 发送的消息都由本地替身接收
+type testBot struct {
+	repo *dao.GormRepository
+	stub *webhook.Stub
+}
+
+func newTestBot(t *testing.T) *testBot {
+	t.Helper()
+	if err := i18n.Load("../locales", "zh"); err != nil {
+		t.Fatal(err)
+	}
+	repository, err := dao.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &webhook.Stub{}
+	server := httptest.NewServer(stub)
+	oldBaseUrl, oldConfig := apiBaseUrl, botConfig
+	t.Cleanup(func() {
+		server.Close()
+		apiBaseUrl, botConfig = oldBaseUrl, oldConfig
+	})
+	apiBaseUrl = server.URL
+	botConfig = &BotConfig{CorpId: "corp", Token: "token", EncodingAesKey: strings.Repeat("a", 43), AgentId: 1}
+	wxcrypt = wxbizmsgcrypt.NewWXBizMsgCrypt(botConfig.Token, botConfig.EncodingAesKey, botConfig.CorpId, wxbizmsgcrypt.XmlType)
+	repo = repository
+	handler.SetRepository(repository)
+	renderer = handler.NewRenderer(handler.FormatText)
+	conversationMap = make(map[string]*conversation.Conversation)
+	acceptMap = make(map[uint32]struct{})
+	languageLock.Lock()
+	languageMap = map[string]string{}
+	languageLock.Unlock()
+	return &testBot{repo: repository, stub: stub}
+}
+
+// 用户发送一条文字消息
+func (b *testBot) send(user string, content string) {
+	ctx := conversation.ConversationContext{
+		ReceiveContent: &conversation.MsgContent{FromUsername: user, ToUsername: "corp", MsgType: "text", Content: content},
+		W:              httptest.NewRecorder(),
+	}
+	if err := startConversation(ctx); err != nil {
+		panic(err)
+	}
+}
+
+// 用户通过企业微信的回调发送一条加密的文字消息 不同消息的createTime需要不同
+func (b *testBot) post(t *testing.T, user string, content string, createTime uint32) {
+	plain, err := xml.Marshal(struct {
+		XMLName      xml.Name `xml:"xml"`
+		ToUserName   string
+		FromUserName string
+		CreateTime   uint32
+		MsgType      string
+		Content      string
+	}{ToUserName: "corp", FromUserName: user, CreateTime: createTime, MsgType: "text", Content: content})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	timestamp, nonce := fmt.Sprint(createTime), "nonce"
+	encrypted, cryptErr := wxcrypt.EncryptMsg(string(plain), timestamp, nonce)
+	if cryptErr != nil {
+		t.Error(cryptErr.ErrMsg)
+		return
+	}
+	var msg wxbizmsgcrypt.WXBizMsg4Send
+	if err = xml.Unmarshal(encrypted, &msg); err != nil {
+		t.Error(err)
+		return
+	}
+	url := fmt.Sprintf("/api/bot/message?msg_signature=%s&timestamp=%s&nonce=%s", msg.Signature.Value, timestamp, nonce)
+	handleMessage(httptest.NewRecorder(), httptest.NewRequest("POST", url, strings.NewReader(string(encrypted))))
+}
+
+// 发给用户的所有消息的文字内容 按发送顺序
+func (b *testBot) received(user string) (contents []string) {
+	for _, body := range b.stub.Messages() {
+		var msg struct {
+			Touser string `json:"touser"`
+			Text   struct {
+				Content string `json:"content"`
+			} `json:"text"`
+			Markdown struct {
+				Content string `json:"content"`
+			} `json:"markdown"`
+		}
+		if json.Unmarshal(body, &msg) != nil || msg.Touser != user {
+			continue
+		}
+		contents = append(contents, msg.Text.Content+msg.Markdown.Content)
+	}
+	return
+}
+
+// 收到的消息中是否有包含text的
+func (b *testBot) receivedText(user string, text string) bool {
+	return containsText(b.received(user), text)
+}
+
+func (b *testBot) addRecord(t *testing.T, user string, kind conversation.RecordKind, form conversation.Form) dao.ItemRecord {
+	t.Helper()
+	record, err := b.repo.AddRecord(conversation.ConversationContext{
+		ReceiveContent: &conversation.MsgContent{FromUsername: user},
+		Conversation:   &conversation.Conversation{UserName: user, Type: kind, Form: form},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func containsText(contents []string, text string) bool {
+	for _, content := range contents {
+		if strings.Contains(content, text) {
+			return true
+		}
+	}
+	return false
+}
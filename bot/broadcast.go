@@ -0,0 +1,105 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/dao"
+	"wxbot-lostandfound/handler"
+	"wxbot-lostandfound/i18n"
+	"wxbot-lostandfound/webhook"
+)
+
+// 添加记录后向配置的群聊推送消息
+var robots []*webhook.Robot
+
+func initBroadcast() {
+	robots = robots[:0]
+	for _, target := range botConfig.Webhooks {
+		if target.Url == "" {
+			log.Printf("群聊%s没有配置webhook地址\n", target.Name)
+			continue
+		}
+		robots = append(robots, webhook.NewRobot(target))
+	}
+}
+
+// 推送新记录 群聊中的成员按匿名用户处理,敏感物品不展示图片并对号码打码
+func broadcastRecord(record dao.ItemRecord) {
+	location := record.Location
+	if location == "" {
+		location = record.City
+	}
+	for _, robot := range robots {
+		if !robot.Target.Matches(location, record.Type) {
+			continue
+		}
+		// 每个群聊单独限流 互不影响
+		go func(robot *webhook.Robot) {
+			viewer := handler.Viewer{Language: robot.Target.Language}
+			lang := viewer.Language
+			if lang == "" {
+				lang = i18n.DefaultLanguage
+			}
+			var err error
+			switch robot.Target.Format {
+			case webhook.FormatNews:
+				err = robot.SendNews([]conversation.NewsArticle{handler.RecordArticle(record, viewer)})
+			default:
+				content := i18n.T(lang, "broadcast_title") + "\n" + handler.RenderRecord("record_markdown", record, viewer)
+				err = robot.SendMarkdown(content)
+			}
+			if err != nil {
+				log.Printf("推送记录%d到群聊%s出错 %s\n", record.Id, robot.Target.Name, err.Error())
+			}
+		}(robot)
+	}
+}
+
+// 向用户、部门和群聊发送markdown通知 用于命令行工具 不需要启动服务
+// users为@all时发送给应用可见范围内的所有用户
+func Broadcast(content string, users []string, parties []string, webhooks []string) error {
+	var firstErr error
+	fail := func(err error) {
+		log.Println(err.Error())
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if len(users) > 0 || len(parties) > 0 {
+		if _, err := getAccessToken(); err != nil {
+			return err
+		}
+		if len(users) > 0 {
+			markdownMsg := &conversation.MarkDownMsg{Msgtype: "markdown"}
+			markdownMsg.Markdown.Content = content
+			if err := sendMsgToUser(markdownMsg, strings.Join(users, "|")); err != nil {
+				fail(fmt.Errorf("发送给用户出错 %s", err.Error()))
+			}
+		}
+		if len(parties) > 0 {
+			if err := sendMDtoParty(content, strings.Join(parties, "|")); err != nil {
+				fail(fmt.Errorf("发送给部门出错 %s", err.Error()))
+			}
+		}
+	}
+	if len(webhooks) > 0 {
+		initBroadcast()
+	}
+	for _, name := range webhooks {
+		sent := false
+		for _, robot := range robots {
+			if robot.Target.Name == name {
+				sent = true
+				if err := robot.SendMarkdown(content); err != nil {
+					fail(fmt.Errorf("推送到群聊%s出错 %s", name, err.Error()))
+				}
+			}
+		}
+		if !sent {
+			fail(fmt.Errorf("没有名为%s的群聊", name))
+		}
+	}
+	return firstErr
+}
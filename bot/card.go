@@ -0,0 +1,101 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"wxbot-lostandfound/conversation"
+)
+
+// 模板卡片 将带序号的文字菜单转换为按钮,点击按钮等同于输入对应的序号
+
+const (
+	maxCardButtons   = 6  // 按钮交互型卡片最多6个按钮
+	maxCardTitleLen  = 26 // 标题最多26个字
+	maxCardDescLen   = 44
+	maxCardButtonLen = 10
+)
+
+var menuOptionRegexp = regexp.MustCompile(`^(\d+)\.(.+)$`)
+
+type menuOption struct {
+	Key  string
+	Text string
+}
+
+// 拆分菜单中的说明文字和选项 如 "请选择\n1.yes\n2.no"
+func parseMenu(menu string) (lines []string, options []menuOption) {
+	for _, line := range strings.Split(menu, "\n") {
+		if match := menuOptionRegexp.FindStringSubmatch(strings.TrimSpace(line)); match != nil {
+			options = append(options, menuOption{Key: match[1], Text: match[2]})
+		} else if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return
+}
+
+func truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length-1]) + "…"
+}
+
+// 发送菜单 开启模板卡片时以按钮形式发送,否则发送文字菜单
+func sendMenuWithCtx(ctx conversation.ConversationContext, menu string) error {
+	return sendMenuToUser(menu, ctx.ReceiveContent.FromUsername)
+}
+
+func sendMenuToUser(menu string, userName string) error {
+	lines, options := parseMenu(menu)
+	if !botConfig.EnableTemplateCard || len(options) < 2 || len(options) > maxCardButtons {
+		return sendTextToUser(menu, userName)
+	}
+	title, desc := trUser(userName, "card_default_title"), strings.Join(lines, "\n")
+	if len(lines) == 1 && len([]rune(lines[0])) <= maxCardTitleLen {
+		title, desc = lines[0], ""
+	}
+	if len([]rune(desc)) > maxCardDescLen {
+		// 说明文字过长时单独发送
+		if err := sendTextToUser(desc, userName); err != nil {
+			return err
+		}
+		desc = ""
+	}
+	cardMsg := conversation.TemplateCardMsg{
+		Touser:  userName,
+		Msgtype: "template_card",
+		Agentid: botConfig.AgentId,
+	}
+	cardMsg.TemplateCard.CardType = "button_interaction"
+	cardMsg.TemplateCard.MainTitle.Title = title
+	cardMsg.TemplateCard.MainTitle.Desc = desc
+	taskId := fmt.Sprintf("%s_%d", userName, time.Now().UnixNano())
+	cardMsg.TemplateCard.TaskId = taskId
+	for i, option := range options {
+		style := 2
+		if i == 0 {
+			style = 1
+		}
+		cardMsg.TemplateCard.ButtonList = append(cardMsg.TemplateCard.ButtonList, conversation.CardButton{
+			Text:  truncate(option.Text, maxCardButtonLen),
+			Style: style,
+			Key:   option.Key,
+		})
+	}
+	jsonMsg, err := json.Marshal(cardMsg)
+	if err != nil {
+		return err
+	}
+	if err = sendJsonMsg(jsonMsg, "模板卡片"); err != nil {
+		return err
+	}
+	if c, exist := conversationMap[userName]; exist {
+		c.TaskId = taskId
+	}
+	return nil
+}
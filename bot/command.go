@@ -0,0 +1,85 @@
+package bot
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"wxbot-lostandfound/conversation"
+)
+
+// 在任何会话阶段都可以使用的命令 如切换语言、订阅、认领
+var commands = []func(ctx conversation.ConversationContext) (handled bool, err error){
+	languageCommand,
+	subscriptionCommand,
+	claimCommand,
+	completeCommand,
+	statusCommand,
+}
+
+var claimRegexp = regexp.MustCompile(`(?i)^(?:认领|claim)\s*(\d+)$`)
+
+// 依次尝试各个命令 不是命令时返回false,继续进行会话
+func handleCommand(ctx conversation.ConversationContext) (handled bool, err error) {
+	if ctx.ImgContent != nil || ctx.LocationContent != nil {
+		return false, nil
+	}
+	for _, command := range commands {
+		if handled, err = command(ctx); handled {
+			return
+		}
+	}
+	return false, nil
+}
+
+// 认领命令 如 认领 12, 从订阅通知中直接进入认领流程
+// 有未完成的登记时先询问是否放弃,避免丢失已经填写的内容
+func claimCommand(ctx conversation.ConversationContext) (handled bool, err error) {
+	content := strings.TrimSpace(ctx.ReceiveContent.Content)
+	c := conversationMap[ctx.ReceiveContent.FromUsername]
+	match := claimRegexp.FindStringSubmatch(content)
+	if match == nil {
+		if c == nil || c.PendingClaim == "" {
+			return false, nil
+		}
+		id := c.PendingClaim
+		c.PendingClaim = ""
+		if content != "1" {
+			return true, sendTextWithCtx(ctx, tr(ctx, "claim_abandon_kept"))
+		}
+		startClaim(ctx, id)
+		return true, nil
+	}
+	if !conversationIdle(c) {
+		c.PendingClaim = match[1]
+		return true, sendMenuWithCtx(ctx, tr(ctx, "claim_abandon_confirm"))
+	}
+	startClaim(ctx, match[1])
+	return true, nil
+}
+
+// 没有未完成的登记 即还未开始会话、正在选择操作或者正在查看记录
+func conversationIdle(c *conversation.Conversation) bool {
+	switch {
+	case c == nil || c.Operation == "list":
+		return true
+	case c.Edited:
+		return false
+	}
+	return c.Stage <= 1
+}
+
+// 以丢失物品的用户查看捡到物品列表的身份开始新的会话
+func startClaim(ctx conversation.ConversationContext, id string) {
+	userName := ctx.ReceiveContent.FromUsername
+	ctx.Conversation = &conversation.Conversation{
+		UserName:   userName,
+		LastActive: time.Now(),
+		Stage:      2,
+		Type:       conversation.KindLost,
+		Operation:  "list",
+		Status:     "waitclaimid",
+	}
+	conversationMap[userName] = ctx.Conversation
+	ctx.ReceiveContent.Content = id
+	claimIdConversation(ctx)
+}
@@ -0,0 +1,61 @@
+package bot
+
+import (
+	"fmt"
+	"testing"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/dao"
+)
+
+func TestClaimCommandKeepsUnfinishedForm(t *testing.T) {
+	filling := func() *conversation.Conversation {
+		return &conversation.Conversation{UserName: "bob", Stage: 4, Type: conversation.KindLost, Operation: "add", Form: conversation.Form{Location: "杭州/西溪园区", ItemName: "耳机"}}
+	}
+	tests := []struct {
+		name         string
+		conversation *conversation.Conversation
+		replies      []string // 认领命令之后的回复
+		claimed      bool
+	}{
+		{name: "没有会话直接认领", claimed: true},
+		{name: "选择操作时直接认领", conversation: &conversation.Conversation{UserName: "bob", Stage: 1, Type: conversation.KindLost}, claimed: true},
+		{name: "查看记录时直接认领", conversation: &conversation.Conversation{UserName: "bob", Stage: 2, Type: conversation.KindLost, Operation: "list", Status: "waitchoose"}, claimed: true},
+		{name: "登记中需要确认", conversation: filling()},
+		{name: "登记中确认放弃后认领", conversation: filling(), replies: []string{"1"}, claimed: true},
+		{name: "登记中选择继续登记", conversation: filling(), replies: []string{"2"}},
+		{name: "编辑表单中需要确认", conversation: &conversation.Conversation{UserName: "bob", Stage: 1, Type: conversation.KindLost, Operation: "add", Edited: true, Form: conversation.Form{ItemName: "耳机"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := newTestBot(t)
+			record := b.addRecord(t, "alice", conversation.KindFound, conversation.Form{City: "杭州", Location: "杭州/西溪园区", ItemName: "黑色雨伞", ItemTags: []string{"雨伞"}})
+			if test.conversation != nil {
+				conversationMap["bob"] = test.conversation
+			}
+			b.send("bob", fmt.Sprintf("认领 %d", record.Id))
+			for _, reply := range test.replies {
+				b.send("bob", reply)
+			}
+			got, err := b.repo.GetRecordById(record.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claimed := got.Status == dao.StatusClaimed; claimed != test.claimed {
+				t.Errorf("认领应该为%v 实际状态为%s %q", test.claimed, got.Status, b.received("bob"))
+			}
+			c := conversationMap["bob"]
+			if test.claimed {
+				if c == nil || c.Operation != "list" {
+					t.Errorf("认领后应该进入查看记录的会话 %+v", c)
+				}
+				return
+			}
+			if c != test.conversation || c.Form.ItemName != "耳机" {
+				t.Errorf("未完成的登记不应该被替换 %+v", c)
+			}
+			if wantPending := len(test.replies) == 0; (c.PendingClaim != "") != wantPending {
+				t.Errorf("等待确认的认领应该为%v %q", wantPending, c.PendingClaim)
+			}
+		})
+	}
+}
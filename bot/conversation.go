@@ -1,51 +1,46 @@
 package bot
 
 import (
+	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"strconv"
 	"strings"
 	"time"
 	"wxbot-lostandfound/conversation"
 	"wxbot-lostandfound/dao"
 	"wxbot-lostandfound/handler"
+	"wxbot-lostandfound/i18n"
 	"wxbot-lostandfound/utils"
 )
 
-var (
-	initPrompt               = "欢迎使用失物小助手，请问您遇到了什么问题呢?\n1.我丢失了物品\n2.我捡到了物品\n3.我是管理员!\n4.结束会话"
-	askLostItemPrompt        = "你丢失的东西是什么呢?"
-	askFoundItemPrompt       = "你捡到的东西是什么呢?"
-	askLostOperationPrompt   = "1.添加丢失物品的记录\n2.查看捡到的物品列表\n3.返回上一步"
-	askFoundOperationPrompt  = "1.添加捡到物品的记录\n2.查看失物记录列表\n3.返回上一步"
-	askLostPlacePrompt       = "请问你在哪里(城市)丢失了物品呢?"
-	askFoundPlacePrompt      = "请问你在哪里(城市)捡到了物品呢?"
-	askLostDescriptionPrompt = "请对丢失的物品进行详细一些的描述(如颜色、品牌等)。"
-	askPickDescriptionPrompt = "请对捡到的物品进行详细一些的描述(如颜色、品牌等)。"
-	askImgPrompt             = "请上传一张物品的图片,没有图片则输入任何文字即可。"
-	generalInvalidPrompt     = "无效输入,请重新选择。"
-	cityInvalidPrompt        = "无效城市名,请重新输入。"
-)
-
 // 针对每个用户维护一个会话map,长时间不活跃则清理
-// 开始会话
-func startConversation(ReceiveContent *conversation.MsgContent, imgContent *conversation.ImgContent, w http.ResponseWriter, timestamp string, nonce string) (err error) {
-	ctx := conversation.ConversationContext{
-		ReceiveContent: ReceiveContent,
-		ImgContent:     imgContent,
-		W:              w,
-		Timestamp:      timestamp,
-		Nonce:          nonce,
-		Conversation:   conversationMap[ReceiveContent.FromUsername],
-	}
+// 开始会话 ctx中除了Conversation以外的内容由调用方填写
+func startConversation(ctx conversation.ConversationContext) (err error) {
+	ctx.Conversation = conversationMap[ctx.ReceiveContent.FromUsername]
 	// 收到消息后马上进行回复,避免微信服务器多次推送,之后改用异步方法向企业微信发送消息
 	// TODO 有时候可能会丢包造成微信服务器没收到确认消息进而发生重传
 	replyTextWithCtx(ctx, "")
+	// 被禁用的用户不处理任何消息 每次都查询数据库 命令行工具禁用后立即生效
+	if repo.GetUserSetting(ctx.ReceiveContent.FromUsername).Banned {
+		delete(conversationMap, ctx.ReceiveContent.FromUsername)
+		return sendTextWithCtx(ctx, tr(ctx, "user_banned"))
+	}
+	// 之前发送的模板卡片不再有效
+	if c, exist := conversationMap[ctx.ReceiveContent.FromUsername]; exist {
+		c.TaskId = ""
+	}
+	// 任何阶段都可以使用命令
+	if handled, commandErr := handleCommand(ctx); handled {
+		return commandErr
+	}
 
-	if c, exist := conversationMap[ReceiveContent.FromUsername]; exist {
+	if c, exist := conversationMap[ctx.ReceiveContent.FromUsername]; exist {
 		// 后续会话
 		c.LastActive = time.Now()
+		if ctx.LocationContent != nil && !acceptLocation(c) {
+			return sendTextWithCtx(ctx, tr(ctx, "location_message_unsupported"))
+		}
 		switch c.Stage {
 		case 0:
 			log.Println("阶段0")
@@ -60,6 +55,8 @@ func startConversation(ReceiveContent *conversation.MsgContent, imgContent *conv
 				err = stage2AddConversation(ctx)
 			} else if c.Operation == "list" {
 				stage2ListConversation(ctx)
+			} else if c.Type == conversation.KindAdmin {
+				err = stage2AdminConversation(ctx)
 			}
 		case 3:
 			log.Println("阶段3")
@@ -73,6 +70,18 @@ func startConversation(ReceiveContent *conversation.MsgContent, imgContent *conv
 		case 6:
 			log.Println("阶段6")
 			err = askForConfirm(ctx)
+		case 7:
+			log.Println("阶段7")
+			err = stage7PickupConversation(ctx)
+		case 8:
+			log.Println("阶段8")
+			err = stage8VerifyConversation(ctx)
+		case 9:
+			log.Println("阶段9")
+			err = stage9SmartConversation(ctx)
+		case 10:
+			log.Println("阶段10")
+			err = stage10TimeConversation(ctx)
 		}
 	} else {
 		err = initConversation(ctx)
@@ -81,15 +90,14 @@ func startConversation(ReceiveContent *conversation.MsgContent, imgContent *conv
 }
 
 func initConversation(ctx conversation.ConversationContext) (err error) {
-	// 还未记录map
-	err = sendTextWithCtx(ctx, initPrompt)
-	// 保存当前会话
-	if err == nil {
-		conversationMap[ctx.ReceiveContent.FromUsername] = &conversation.Conversation{
-			UserName:   ctx.ReceiveContent.FromUsername,
-			LastActive: time.Now(),
-			Stage:      0,
-		}
+	// 还未记录map 先保存会话,发送的模板卡片才能记录到会话中
+	conversationMap[ctx.ReceiveContent.FromUsername] = &conversation.Conversation{
+		UserName:   ctx.ReceiveContent.FromUsername,
+		LastActive: time.Now(),
+		Stage:      0,
+	}
+	if err = sendMenuWithCtx(ctx, tr(ctx, "init")); err != nil {
+		delete(conversationMap, ctx.ReceiveContent.FromUsername)
 	}
 	return
 }
@@ -105,61 +113,162 @@ func stage0Conversation(ctx conversation.ConversationContext) (err error) {
 	switch ctx.ReceiveContent.Content {
 	case "1", "我丢失了物品", "丢失物品":
 		ctx.Conversation.Stage = 1
-		ctx.Conversation.Type = 1
+		ctx.Conversation.Type = conversation.KindLost
 		// 虽然可以直接调用 stage1,但是为了避免过多层的嵌套,还是只进行回复
-		err = sendTextWithCtx(ctx, askLostOperationPrompt)
+		err = sendMenuWithCtx(ctx, tr(ctx, "lost_operation"))
 	case "2", "我捡到了物品", "捡到物品":
 		ctx.Conversation.Stage = 1
-		ctx.Conversation.Type = 2
-		err = sendTextWithCtx(ctx, askFoundOperationPrompt)
+		ctx.Conversation.Type = conversation.KindFound
+		err = sendMenuWithCtx(ctx, tr(ctx, "found_operation"))
 	case "3", "我是管理员":
-		// TODO 允许企业中指定身份的人进行一些管理操作
-		ctx.Conversation.Type = 3
+		if !isAdmin(ctx.ReceiveContent.FromUsername) {
+			err = sendTextWithCtx(ctx, tr(ctx, "not_admin"))
+			return
+		}
+		ctx.Conversation.Stage = 1
+		ctx.Conversation.Type = conversation.KindAdmin
+		err = sendMenuWithCtx(ctx, tr(ctx, "admin_operation"))
 	case "4", "结束会话":
-		err = sendTextWithCtx(ctx, "再见，当前会话已结束")
+		err = sendTextWithCtx(ctx, tr(ctx, "goodbye"))
 		delete(conversationMap, ctx.ReceiveContent.FromUsername)
+	case "5", "智能模式", "一句话登记":
+		ctx.Conversation.Stage = 9
+		err = sendTextWithCtx(ctx, tr(ctx, "ask_smart"))
 	default:
 		// 无效输入
-		err = sendTextWithCtx(ctx, generalInvalidPrompt)
+		err = sendTextWithCtx(ctx, tr(ctx, "general_invalid"))
 	}
 	return
 }
 
 // 阶段1 设置操作 添加或者是查看
 func stage1Conversation(ctx conversation.ConversationContext) (err error) {
+	if ctx.Conversation.Type == conversation.KindAdmin {
+		return stage1AdminConversation(ctx)
+	}
 	ctx.Conversation.Stage = 2
 	switch ctx.ReceiveContent.Content {
 	case "1", "添加丢失物品的记录", "添加捡到物品的记录":
 		ctx.Conversation.Operation = "add"
-		if ctx.Conversation.Type == 1 {
-			err = sendTextWithCtx(ctx, askLostPlacePrompt)
+		if ctx.Conversation.Type == conversation.KindLost {
+			err = sendTextWithCtx(ctx, tr(ctx, "ask_lost_place"))
 		} else {
-			err = sendTextWithCtx(ctx, askFoundPlacePrompt)
+			err = sendTextWithCtx(ctx, tr(ctx, "ask_found_place"))
 		}
 	case "2", "查看捡到的物品列表", "查看失物记录列表":
 		ctx.Conversation.Operation = "list"
-		err = sendTextWithCtx(ctx, "1.查看所有记录\n2.查看未完成记录\n3.查看已完成记录\n4.根据描述搜索记录\n5.返回上一步")
+		err = sendMenuWithCtx(ctx, tr(ctx, "list_operation"))
 	case "3", "返回上一步":
 		ctx.Conversation.Stage = 0
-		err = sendTextWithCtx(ctx, initPrompt)
+		err = sendMenuWithCtx(ctx, tr(ctx, "init"))
 	default:
-		err = sendTextWithCtx(ctx, generalInvalidPrompt)
+		err = sendTextWithCtx(ctx, tr(ctx, "general_invalid"))
 	}
 	return
 }
 
-// 阶段2 添加地点 需要确认
+// 阶段1 管理员选择操作
+func stage1AdminConversation(ctx conversation.ConversationContext) (err error) {
+	ctx.Conversation.Stage = 2
+	switch ctx.ReceiveContent.Content {
+	case "1", "登记物品移交":
+		ctx.Conversation.Operation = "handover"
+		err = sendTextWithCtx(ctx, tr(ctx, "ask_hand_over"))
+	case "2", "查看物品流转记录":
+		ctx.Conversation.Operation = "custody"
+		err = sendTextWithCtx(ctx, tr(ctx, "ask_custody_id"))
+	case "3", "修改记录":
+		ctx.Conversation.Operation = "edit"
+		err = sendTextWithCtx(ctx, tr(ctx, "ask_edit"))
+	case "4", "删除记录":
+		ctx.Conversation.Operation = "delete"
+		err = sendTextWithCtx(ctx, tr(ctx, "ask_delete_id"))
+	case "5", "查看记录修改历史":
+		ctx.Conversation.Operation = "history"
+		err = sendTextWithCtx(ctx, tr(ctx, "ask_history_id"))
+	case "6", "恢复记录":
+		ctx.Conversation.Operation = "restore"
+		err = sendTextWithCtx(ctx, tr(ctx, "ask_restore"))
+	case "7", "返回上一步":
+		ctx.Conversation.Stage = 0
+		err = sendMenuWithCtx(ctx, tr(ctx, "init"))
+	default:
+		ctx.Conversation.Stage = 1
+		err = sendTextWithCtx(ctx, tr(ctx, "general_invalid"))
+	}
+	return
+}
+
+// 阶段2 管理员操作 完成后回到管理员菜单
+func stage2AdminConversation(ctx conversation.ConversationContext) (err error) {
+	content := strings.TrimSpace(ctx.ReceiveContent.Content)
+	ctx.Conversation.Stage = 1
+	switch ctx.Conversation.Operation {
+	case "handover":
+		fields := strings.Fields(content)
+		if len(fields) < 2 {
+			ctx.Conversation.Stage = 2
+			return sendTextWithCtx(ctx, tr(ctx, "ask_hand_over"))
+		}
+		id, parseErr := strconv.ParseInt(fields[0], 10, 64)
+		if parseErr != nil {
+			ctx.Conversation.Stage = 2
+			return sendTextWithCtx(ctx, tr(ctx, "ask_hand_over"))
+		}
+		record, handOverErr := repo.HandOverItem(id, strings.Join(fields[1:], " "), ctx.ReceiveContent.FromUsername, "")
+		if handOverErr != nil {
+			log.Println("登记物品移交出错", handOverErr.Error())
+			return sendMenuWithCtx(ctx, tr(ctx, "hand_over_failed")+"\n"+tr(ctx, "admin_operation"))
+		}
+		if record.User != ctx.ReceiveContent.FromUsername {
+			if notifyErr := sendTextToUser(trUser(record.User, "hand_over_notify", record), record.User); notifyErr != nil {
+				log.Println("通知登记人出错", notifyErr.Error())
+			}
+		}
+		err = sendMenuWithCtx(ctx, tr(ctx, "hand_over_done", record)+"\n"+tr(ctx, "admin_operation"))
+	case "custody":
+		id, parseErr := strconv.ParseInt(content, 10, 64)
+		if parseErr != nil {
+			ctx.Conversation.Stage = 2
+			return sendTextWithCtx(ctx, tr(ctx, "ask_custody_id"))
+		}
+		err = sendMenuWithCtx(ctx, handler.GetCustodyText(id, userLanguage(ctx.ReceiveContent.FromUsername))+"\n"+tr(ctx, "admin_operation"))
+	case "edit":
+		err = editRecordConversation(ctx, content)
+	case "delete":
+		err = deleteRecordConversation(ctx, content)
+	case "history":
+		err = revisionHistoryConversation(ctx, content)
+	case "restore":
+		err = restoreRecordConversation(ctx, content)
+	}
+	return
+}
+
+// 阶段2 添加地点 需要确认 输入内容与配置的地点层级进行模糊匹配,存在多个候选时由用户选择
 func stage2AddConversation(ctx conversation.ConversationContext) (err error) {
-	content := ctx.ReceiveContent.Content
+	content := strings.TrimSpace(ctx.ReceiveContent.Content)
+	if ctx.LocationContent != nil {
+		return locationMsgConversation(ctx)
+	}
 	switch ctx.Conversation.Status {
 	case "":
-		if !utils.IfWordInSlice(content, utils.CitySlice) {
-			err = sendTextWithCtx(ctx, cityInvalidPrompt)
+		matches := matchLocations(content)
+		switch len(matches) {
+		case 0:
+			err = sendTextWithCtx(ctx, tr(ctx, "city_invalid", i18n.Data{"Cities": strings.Join(utils.Cities(), ",")}))
+		case 1:
+			err = confirmLocation(ctx, matches[0])
+		default:
+			ctx.Conversation.Status = "waitpick"
+			err = sendTextWithCtx(ctx, locationPickPrompt(ctx, matches))
+		}
+	case "waitpick":
+		if location := pickLocation(ctx, content); location != nil {
+			err = confirmLocation(ctx, location)
 		} else {
-			ctx.Conversation.Status = "waitconfirm"
-			ctx.Conversation.Form.City = content
-			// 询问,要求确认城市名称无误
-			err = sendTextWithCtx(ctx, fmt.Sprintf("您所在的城市是:%s\n1.yes\n2.no", content))
+			ctx.Conversation.Status = ""
+			err = sendTextWithCtx(ctx, tr(ctx, "reenter_location"))
 		}
 	case "waitconfirm":
 		// 要求进行确认
@@ -167,78 +276,138 @@ func stage2AddConversation(ctx conversation.ConversationContext) (err error) {
 		switch content {
 		case "1", "yes":
 			if ctx.Conversation.Edited {
+				// 编辑完成后直接回到最终确认
 				ctx.Conversation.Stage = 6
 				ctx.Conversation.Edited = false
-			} else {
-				ctx.Conversation.Stage = 3
+				return askForConfirm(ctx)
 			}
-			if ctx.Conversation.Type == 1 {
-				err = sendTextWithCtx(ctx, askLostItemPrompt)
+			ctx.Conversation.Stage = 3
+			if ctx.Conversation.Type == conversation.KindLost {
+				err = sendTextWithCtx(ctx, tr(ctx, "ask_lost_item"))
 			} else {
-				err = sendTextWithCtx(ctx, askFoundItemPrompt)
+				err = sendTextWithCtx(ctx, tr(ctx, "ask_found_item"))
 			}
 		case "2", "no":
 			fallthrough
 		default:
 			// 重新进行输入
-			err = sendTextWithCtx(ctx, "请重新输入城市名")
+			err = sendTextWithCtx(ctx, tr(ctx, "reenter_location"))
 		}
 	}
 
 	return
 }
 
+// 只有填写地点和按地点搜索时可以处理位置消息
+func acceptLocation(c *conversation.Conversation) bool {
+	return c.Stage == 2 && ((c.Operation == "add" && c.Status == "") || (c.Operation == "list" && c.Status == "waitlocation"))
+}
+
+// 阶段2 用户发送了位置 记录坐标并匹配最近的办公地点
+func locationMsgConversation(ctx conversation.ConversationContext) error {
+	locationContent := ctx.LocationContent
+	ctx.Conversation.Form.Latitude = locationContent.LocationX
+	ctx.Conversation.Form.Longitude = locationContent.LocationY
+	ctx.Conversation.Form.LocationLabel = locationContent.Label
+	nearest, distance := utils.NearestLocation(utils.GeoPoint{Latitude: locationContent.LocationX, Longitude: locationContent.LocationY})
+	if nearest == nil {
+		// 没有配置坐标时仍需要用户输入地点
+		return sendTextWithCtx(ctx, tr(ctx, "location_recorded", locationContent))
+	}
+	log.Printf("位置%s最近的地点为%s 距离%.2fkm\n", locationContent.Label, nearest.Path(), distance)
+	return confirmLocation(ctx, nearest)
+}
+
+func searchRadius() float64 {
+	if botConfig.SearchRadiusKm > 0 {
+		return botConfig.SearchRadiusKm
+	}
+	return 2
+}
+
+// 使用分词结果中的地点词和名词匹配地点
+func matchLocations(content string) []*utils.Location {
+	_, placeWords, nameWords := ParseMsg(content)
+	return utils.MatchLocations(content, append(placeWords, nameWords...))
+}
+
+// 列出候选地点供用户选择
+func locationPickPrompt(ctx conversation.ConversationContext, matches []*utils.Location) string {
+	ctx.Conversation.Candidates = ctx.Conversation.Candidates[:0]
+	builder := strings.Builder{}
+	builder.WriteString(tr(ctx, "location_pick"))
+	for i, location := range matches {
+		ctx.Conversation.Candidates = append(ctx.Conversation.Candidates, location.Path())
+		builder.WriteString(fmt.Sprintf("\n%d.%s", i+1, location.Path()))
+	}
+	return builder.String()
+}
+
+// 根据用户输入的序号选择候选地点
+func pickLocation(ctx conversation.ConversationContext, content string) *utils.Location {
+	defer func() { ctx.Conversation.Candidates = nil }()
+	index, err := strconv.Atoi(content)
+	if err != nil || index < 1 || index > len(ctx.Conversation.Candidates) {
+		return nil
+	}
+	return utils.FindLocation(ctx.Conversation.Candidates[index-1])
+}
+
+// 询问,要求确认地点无误
+func confirmLocation(ctx conversation.ConversationContext, location *utils.Location) error {
+	ctx.Conversation.Status = "waitconfirm"
+	ctx.Conversation.Form.City = location.City()
+	ctx.Conversation.Form.Location = location.Path()
+	return sendMenuWithCtx(ctx, tr(ctx, "location_confirm", i18n.Data{"Location": location.Path()}))
+}
+
 // 阶段2 查看记录 以多个Markdown返回 暂时未做分页和时间等筛选
 func stage2ListConversation(ctx conversation.ConversationContext) {
-	var searchType int64
-	if ctx.Conversation.Type == 1 {
-		// 要进行相反的查找, 丢失东西应该查找的是捡到东西的记录
-		searchType = 2
-	} else if ctx.Conversation.Type == 2 {
-		searchType = 1
+	viewer := handler.Viewer{
+		UserName: ctx.ReceiveContent.FromUsername,
+		IsAdmin:  isAdmin(ctx.ReceiveContent.FromUsername),
 	}
+	// 要进行相反的查找, 丢失东西应该查找的是捡到东西的记录
+	searchType := ctx.Conversation.Type.Opposite()
 	switch ctx.Conversation.Status {
 	case "":
 		ctx.Conversation.Status = "waitchoose"
-		var mds, tags []string
+		var tags []string
 		switch ctx.ReceiveContent.Content {
 		case "2", "查看未完成记录":
-			sendTextWithCtx(ctx, "正在进行查询")
-			mds = handler.GetRecordMarkdown(searchType, "未完成", nil)
+			sendTextWithCtx(ctx, tr(ctx, "searching"))
+			sendRecords(ctx, handler.GetRecords(dao.RecordFilter{Type: searchType, Statuses: dao.OpenStatuses}), viewer, searchType)
 		case "3", "查看已完成记录":
-			sendTextWithCtx(ctx, "正在进行查询")
-			mds = handler.GetRecordMarkdown(searchType, "已完成", nil)
+			sendTextWithCtx(ctx, tr(ctx, "searching"))
+			sendRecords(ctx, handler.GetRecords(dao.RecordFilter{Type: searchType, Statuses: []dao.RecordStatus{dao.StatusCompleted}}), viewer, searchType)
 		case "4", "根据标签搜索记录":
-			sendTextWithCtx(ctx, "正在进行查询")
+			sendTextWithCtx(ctx, tr(ctx, "searching"))
 			tags = handler.GetAllTag()
 			if len(tags) == 0 {
-				sendTextWithCtx(ctx, "当前还没有任何标签")
+				sendTextWithCtx(ctx, tr(ctx, "no_tags"))
 			}
 		case "1", "查看所有记录":
-			mds = handler.GetRecordMarkdown(searchType, "", nil)
-		case "5", "返回上一步":
+			sendRecords(ctx, handler.GetRecords(dao.RecordFilter{Type: searchType}), viewer, searchType)
+		case "5", "根据地点搜索记录":
+			ctx.Conversation.Status = "waitlocation"
+			sendTextWithCtx(ctx, tr(ctx, "ask_search_location"))
+		case "6", "根据时间搜索记录":
+			ctx.Conversation.Status = "waittime"
+			sendTextWithCtx(ctx, tr(ctx, "ask_search_time"))
+		case "7", "返回上一步":
 			fallthrough
 		default:
+			ctx.Conversation.Status = ""
 			ctx.Conversation.Stage = 1
-			if ctx.Conversation.Type == 1 {
-				sendTextWithCtx(ctx, askLostOperationPrompt)
+			if ctx.Conversation.Type == conversation.KindLost {
+				sendMenuWithCtx(ctx, tr(ctx, "lost_operation"))
 			} else {
-				sendTextWithCtx(ctx, askFoundOperationPrompt)
-			}
-		}
-		// 返回多个markdown
-		if len(mds) > 0 {
-			sendTextWithCtx(ctx, "共找到"+strconv.Itoa(len(mds))+"条记录")
-			for _, md := range mds {
-				if err := sendMDtoUserWithCtx(ctx, md); err != nil {
-					log.Println("返回markdown出错", err.Error())
-				}
+				sendMenuWithCtx(ctx, tr(ctx, "found_operation"))
 			}
-			sendTextWithCtx(ctx, "1.返回上一步\n2.结束会话")
 		}
 		if len(tags) > 0 {
 			ctx.Conversation.Status = "waittags"
-			sendTextWithCtx(ctx, fmt.Sprintf("当前共有如下标签\n%s\n输入标签进行查询(多个标签用空格分隔)", strings.Join(tags, ",")))
+			sendTextWithCtx(ctx, tr(ctx, "choose_tags", i18n.Data{"Tags": strings.Join(tags, ",")}))
 		}
 
 	case "waitchoose":
@@ -246,36 +415,216 @@ func stage2ListConversation(ctx conversation.ConversationContext) {
 		switch ctx.ReceiveContent.Content {
 		case "1", "返回上一步":
 			ctx.Conversation.Stage = 2
-			sendTextWithCtx(ctx, "1.查看所有记录\n2.查看未完成记录\n3.查看已完成记录\n4.根据描述搜索记录\n5.返回上一步")
+			sendMenuWithCtx(ctx, tr(ctx, "list_operation"))
 		case "2", "结束会话":
-			sendTextWithCtx(ctx, "当前会话已结束")
+			sendTextWithCtx(ctx, tr(ctx, "conversation_ended"))
 			delete(conversationMap, ctx.ReceiveContent.FromUsername)
+		case "3", "认领物品":
+			if searchType == conversation.KindFound {
+				ctx.Conversation.Status = "waitclaimid"
+				sendTextWithCtx(ctx, tr(ctx, "ask_claim_id"))
+			}
+		}
+	case "waitclaimid":
+		claimIdConversation(ctx)
+	case "waitclaimanswer":
+		claimAnswerConversation(ctx)
+	case "waitlocation":
+		if locationContent := ctx.LocationContent; locationContent != nil {
+			// 发送位置时搜索该位置附近发送了位置的记录
+			ctx.Conversation.Status = "waitchoose"
+			near := &utils.GeoPoint{Latitude: locationContent.LocationX, Longitude: locationContent.LocationY}
+			sendRecords(ctx, handler.GetRecords(dao.RecordFilter{Type: searchType, Near: near, RadiusKm: searchRadius()}), viewer, searchType)
+			return
 		}
+		// 按地点搜索 包含下级地点的记录
+		matches := matchLocations(ctx.ReceiveContent.Content)
+		switch len(matches) {
+		case 0:
+			sendTextWithCtx(ctx, tr(ctx, "search_location_not_found", i18n.Data{"Cities": strings.Join(utils.Cities(), ",")}))
+		case 1:
+			ctx.Conversation.Status = "waitchoose"
+			sendRecords(ctx, handler.GetRecords(dao.RecordFilter{Type: searchType, Location: matches[0].Path()}), viewer, searchType)
+		default:
+			ctx.Conversation.Status = "waitlocationpick"
+			sendTextWithCtx(ctx, locationPickPrompt(ctx, matches))
+		}
+	case "waitlocationpick":
+		if location := pickLocation(ctx, strings.TrimSpace(ctx.ReceiveContent.Content)); location != nil {
+			ctx.Conversation.Status = "waitchoose"
+			sendRecords(ctx, handler.GetRecords(dao.RecordFilter{Type: searchType, Location: location.Path()}), viewer, searchType)
+		} else {
+			ctx.Conversation.Status = "waitlocation"
+			sendTextWithCtx(ctx, tr(ctx, "ask_search_location"))
+		}
+	case "waittime":
+		since, until, err := utils.ParseTimeRange(ctx.ReceiveContent.Content, time.Now())
+		if err != nil {
+			sendTextWithCtx(ctx, tr(ctx, "search_time_invalid"))
+			return
+		}
+		ctx.Conversation.Status = "waitchoose"
+		sendRecords(ctx, handler.GetRecords(dao.RecordFilter{Type: searchType, Since: since, Until: until}), viewer, searchType)
 	case "waittags":
 		// 对输入的文本进行提取，提取出标签
 		ctx.Conversation.Status = "waitchoose"
 		content := ctx.ReceiveContent.Content
 		tags := strings.Fields(content)
-		mds := handler.GetRecordMarkdown(searchType, "", tags)
-		sendTextWithCtx(ctx, "共找到"+strconv.Itoa(len(mds))+"条记录")
-		if len(mds) > 0 {
-			for _, md := range mds {
-				if err := sendMDtoUserWithCtx(ctx, md); err != nil {
-					log.Println("返回markdown出错", err.Error())
-				}
-			}
+		sendRecords(ctx, handler.GetRecords(dao.RecordFilter{Type: searchType, Tags: tags}), viewer, searchType)
+	}
+}
+
+// 返回查找到的记录 以及后续的选项
+func sendRecords(ctx conversation.ConversationContext, records []dao.ItemRecord, viewer handler.Viewer, searchType conversation.RecordKind) {
+	sendTextWithCtx(ctx, tr(ctx, "records_found", i18n.Data{"Count": len(records)}))
+	sendRecordsToUser(records, viewer, ctx.ReceiveContent.FromUsername)
+	sendMenuWithCtx(ctx, listChoosePrompt(ctx, searchType))
+}
+
+// 查看记录后的选项,查看捡到的物品时可以进行认领
+func listChoosePrompt(ctx conversation.ConversationContext, searchType conversation.RecordKind) string {
+	if searchType == conversation.KindFound {
+		return tr(ctx, "list_choose_claim")
+	}
+	return tr(ctx, "list_choose")
+}
+
+// 认领 输入记录ID 没有设置验证问题的记录直接展示联系方式
+// 敏感物品没有设置验证问题时不直接认领 通知登记人核实身份
+func claimIdConversation(ctx conversation.ConversationContext) {
+	ctx.Conversation.Status = "waitchoose"
+	id, err := strconv.ParseInt(strings.TrimSpace(ctx.ReceiveContent.Content), 10, 64)
+	if err != nil {
+		sendMenuWithCtx(ctx, tr(ctx, "claim_invalid_id")+"\n"+listChoosePrompt(ctx, conversation.KindFound))
+		return
+	}
+	record, err := repo.GetRecordById(id)
+	if err != nil || record.Type != conversation.KindFound {
+		sendMenuWithCtx(ctx, tr(ctx, "claim_not_found")+"\n"+listChoosePrompt(ctx, conversation.KindFound))
+		return
+	}
+	user := ctx.ReceiveContent.FromUsername
+	if reason := claimRefused(record, user); reason != "" {
+		sendMenuWithCtx(ctx, tr(ctx, reason)+"\n"+listChoosePrompt(ctx, conversation.KindFound))
+		return
+	}
+	if record.VerifyQuestion == "" {
+		if record.Sensitive {
+			requestClaim(ctx, record)
+			return
+		}
+		claimSuccess(ctx, record, &dao.ClaimAttempt{ItemId: id, User: user, Passed: true})
+		return
+	}
+	if repo.CountFailedClaimAttempts(id, user) >= int64(maxClaimAttempts()) {
+		sendMenuWithCtx(ctx, tr(ctx, "claim_attempts_exhausted")+"\n"+listChoosePrompt(ctx, conversation.KindFound))
+		return
+	}
+	ctx.Conversation.ClaimId = id
+	ctx.Conversation.Status = "waitclaimanswer"
+	sendTextWithCtx(ctx, tr(ctx, "claim_question", i18n.Data{"Question": record.VerifyQuestion}))
+}
+
+// 不能认领的原因 可以认领时返回空
+// 只有未认领的记录可以认领 已认领、已完成等记录不再展示联系方式
+func claimRefused(record dao.ItemRecord, user string) string {
+	switch {
+	case record.User == user:
+		return "claim_own"
+	case !record.Status.IsOpen() || !dao.CanTransitionRecord(record, dao.StatusClaimed, dao.RoleClaimant):
+		return "claim_not_open"
+	}
+	return ""
+}
+
+// 没有验证问题的敏感物品 通知登记人核实认领人的身份 不展示完整记录
+func requestClaim(ctx conversation.ConversationContext, record dao.ItemRecord) {
+	user := ctx.ReceiveContent.FromUsername
+	sendMenuWithCtx(ctx, tr(ctx, "claim_sensitive_pending")+"\n"+listChoosePrompt(ctx, conversation.KindFound))
+	notify := trUser(record.User, "claim_request_notify", i18n.Data{"User": user, "ItemName": record.ItemName, "Id": record.Id})
+	if err := sendTextToUser(notify, record.User); err != nil {
+		log.Println("通知登记人出错", err.Error())
+	}
+}
+
+// 认领 回答验证问题 每次回答都会记录
+func claimAnswerConversation(ctx conversation.ConversationContext) {
+	ctx.Conversation.Status = "waitchoose"
+	record, err := repo.GetRecordById(ctx.Conversation.ClaimId)
+	if err != nil {
+		sendMenuWithCtx(ctx, tr(ctx, "claim_not_found")+"\n"+listChoosePrompt(ctx, conversation.KindFound))
+		return
+	}
+	user := ctx.ReceiveContent.FromUsername
+	// 回答期间记录可能已经被其他人认领
+	if reason := claimRefused(record, user); reason != "" {
+		ctx.Conversation.ClaimId = 0
+		sendMenuWithCtx(ctx, tr(ctx, reason)+"\n"+listChoosePrompt(ctx, conversation.KindFound))
+		return
+	}
+	answer := ctx.ReceiveContent.Content
+	attempt := &dao.ClaimAttempt{
+		ItemId: record.Id,
+		User:   user,
+		Answer: answer,
+		Passed: utils.FuzzyMatch(answer, record.VerifyAnswer),
+	}
+	if attempt.Passed {
+		ctx.Conversation.ClaimId = 0
+		claimSuccess(ctx, record, attempt)
+		return
+	}
+	if err := repo.AddClaimAttempt(attempt); err != nil {
+		log.Println("记录认领出错", err.Error())
+	}
+	remain := int64(maxClaimAttempts()) - repo.CountFailedClaimAttempts(record.Id, user)
+	if remain <= 0 {
+		ctx.Conversation.ClaimId = 0
+		sendMenuWithCtx(ctx, tr(ctx, "claim_wrong_exhausted")+"\n"+listChoosePrompt(ctx, conversation.KindFound))
+		return
+	}
+	ctx.Conversation.Status = "waitclaimanswer"
+	sendTextWithCtx(ctx, tr(ctx, "claim_wrong_retry", i18n.Data{"Remain": remain}))
+}
+
+// 认领成功 记录变更为已认领后才记录通过的认领 展示完整记录和登记人联系方式,并通知登记人
+// 状态变更失败时(如已被其他人认领)不展示任何信息
+func claimSuccess(ctx conversation.ConversationContext, record dao.ItemRecord, attempt *dao.ClaimAttempt) {
+	user := ctx.ReceiveContent.FromUsername
+	claimed, err := repo.TransitionRecord(record.Id, dao.StatusClaimed, user, dao.RoleClaimant, "")
+	if err != nil {
+		if !errors.Is(err, dao.ErrInvalidTransition) {
+			log.Println("变更记录状态出错", err.Error())
 		}
-		sendTextWithCtx(ctx, "1.返回上一步\n2.结束会话")
+		sendMenuWithCtx(ctx, tr(ctx, "claim_not_open")+"\n"+listChoosePrompt(ctx, conversation.KindFound))
+		return
+	}
+	if err := repo.AddClaimAttempt(attempt); err != nil {
+		log.Println("记录认领出错", err.Error())
+	}
+	record = claimed
+	sendRecordsToUser([]dao.ItemRecord{record}, handler.Viewer{UserName: user}, user)
+	sendMenuWithCtx(ctx, tr(ctx, "claim_success", record)+"\n"+listChoosePrompt(ctx, conversation.KindFound))
+	notify := trUser(record.User, "claim_notify", i18n.Data{"User": user, "ItemName": record.ItemName, "Id": record.Id})
+	if err := sendTextToUser(notify, record.User); err != nil {
+		log.Println("通知登记人出错", err.Error())
 	}
 }
 
+func maxClaimAttempts() int {
+	if botConfig.MaxClaimAttempts > 0 {
+		return botConfig.MaxClaimAttempts
+	}
+	return 3
+}
+
 // 阶段3 添加物品名称 需要进行确认
 func stage3ItemConversation(ctx conversation.ConversationContext) (err error) {
 	content := ctx.ReceiveContent.Content
 	switch ctx.Conversation.Status {
 	case "":
 		ctx.Conversation.Form.ItemName = content
-		err = sendTextWithCtx(ctx, fmt.Sprintf("物品名称为:%s\n1.yes\n2.no", content))
+		err = sendMenuWithCtx(ctx, tr(ctx, "item_name_confirm", i18n.Data{"ItemName": content}))
 		ctx.Conversation.Status = "waitconfirm"
 	case "waitconfirm":
 		ctx.Conversation.Status = ""
@@ -284,21 +633,67 @@ func stage3ItemConversation(ctx conversation.ConversationContext) (err error) {
 			if ctx.Conversation.Edited {
 				ctx.Conversation.Stage = 6
 				ctx.Conversation.Edited = false
-			} else {
-				ctx.Conversation.Stage = 4
+				return askForConfirm(ctx)
 			}
-			if ctx.Conversation.Type == 1 {
-				err = sendTextWithCtx(ctx, askLostDescriptionPrompt)
+			ctx.Conversation.Stage = 10
+			err = sendTextWithCtx(ctx, askTimePrompt(ctx))
+		case "2", "no":
+			fallthrough
+		default:
+			err = sendTextWithCtx(ctx, tr(ctx, "reenter_item_name"))
+		}
+	}
+	// 根据之前的输入生成标签
+	return
+}
+
+func askTimePrompt(ctx conversation.ConversationContext) string {
+	if ctx.Conversation.Type == conversation.KindLost {
+		return tr(ctx, "ask_lost_time")
+	}
+	return tr(ctx, "ask_found_time")
+}
+
+// 阶段10 添加丢失或捡到物品的时间 支持 昨天下午、上周五、3月2日 等表达 需要确认
+func stage10TimeConversation(ctx conversation.ConversationContext) (err error) {
+	content := strings.TrimSpace(ctx.ReceiveContent.Content)
+	switch ctx.Conversation.Status {
+	case "":
+		if content == "0" || content == "不清楚" {
+			ctx.Conversation.Form.OccurredAt = time.Time{}
+			ctx.Conversation.Status = "waitconfirm"
+			return sendMenuWithCtx(ctx, tr(ctx, "time_unknown_confirm"))
+		}
+		occurredAt, parseErr := utils.ParseTime(content, time.Now())
+		if errors.Is(parseErr, utils.ErrFutureTime) {
+			return sendTextWithCtx(ctx, tr(ctx, "time_future"))
+		} else if parseErr != nil {
+			return sendTextWithCtx(ctx, tr(ctx, "time_invalid"))
+		}
+		ctx.Conversation.Form.OccurredAt = occurredAt
+		ctx.Conversation.Status = "waitconfirm"
+		err = sendMenuWithCtx(ctx, tr(ctx, "time_confirm", i18n.Data{"Time": utils.FormatTime(occurredAt)}))
+	case "waitconfirm":
+		ctx.Conversation.Status = ""
+		switch content {
+		case "1", "yes":
+			if ctx.Conversation.Edited {
+				ctx.Conversation.Stage = 6
+				ctx.Conversation.Edited = false
+				return askForConfirm(ctx)
+			}
+			ctx.Conversation.Stage = 4
+			if ctx.Conversation.Type == conversation.KindLost {
+				err = sendTextWithCtx(ctx, tr(ctx, "ask_lost_description"))
 			} else {
-				err = sendTextWithCtx(ctx, askPickDescriptionPrompt)
+				err = sendTextWithCtx(ctx, tr(ctx, "ask_found_description"))
 			}
 		case "2", "no":
 			fallthrough
 		default:
-			err = sendTextWithCtx(ctx, "请重新输入物品名称")
+			err = sendTextWithCtx(ctx, askTimePrompt(ctx))
 		}
 	}
-	// 根据之前的输入生成标签
 	return
 }
 
@@ -309,38 +704,44 @@ func stage4DescriptionConversation(ctx conversation.ConversationContext) (err er
 	case "":
 		ctx.Conversation.Status = "waitconfirm"
 		ctx.Conversation.Form.Description = content
-		err = sendTextWithCtx(ctx, fmt.Sprintf("您的描述是:\n%s\n1.yes\n2.no", content))
+		err = sendMenuWithCtx(ctx, tr(ctx, "description_confirm", i18n.Data{"Description": content}))
 	case "waitconfirm":
 		ctx.Conversation.Status = ""
 		switch content {
 		case "1", "yes":
+			generateFormTags(ctx)
 			if ctx.Conversation.Edited {
 				ctx.Conversation.Stage = 6
 				ctx.Conversation.Edited = false
-			} else {
-				ctx.Conversation.Stage = 5
+				return askForConfirm(ctx)
 			}
-			allTextBuilder := strings.Builder{}
-			allTextBuilder.WriteString(ctx.Conversation.Form.City)
-			allTextBuilder.WriteString(ctx.Conversation.Form.ItemName)
-			allTextBuilder.WriteString(ctx.Conversation.Form.Description)
-			tags := GenerateTags(allTextBuilder.String())
-			log.Println("物品TAGS:", tags)
-			ctx.Conversation.Form.ItemTags = tags
-			err = sendTextWithCtx(ctx, askImgPrompt)
+			ctx.Conversation.Stage = 5
+			err = sendTextWithCtx(ctx, tr(ctx, "ask_img"))
 		case "2", "no":
 			fallthrough
 		default:
-			err = sendTextWithCtx(ctx, "请重新输入描述")
+			err = sendTextWithCtx(ctx, tr(ctx, "reenter_description"))
 		}
 	}
 	return
 }
 
+// 根据已填写的内容生成标签 并判断是否为敏感物品
+func generateFormTags(ctx conversation.ConversationContext) {
+	allTextBuilder := strings.Builder{}
+	allTextBuilder.WriteString(ctx.Conversation.Form.City)
+	allTextBuilder.WriteString(ctx.Conversation.Form.ItemName)
+	allTextBuilder.WriteString(ctx.Conversation.Form.Description)
+	tags := GenerateTags(allTextBuilder.String())
+	log.Println("物品TAGS:", tags)
+	ctx.Conversation.Form.ItemTags = tags
+	ctx.Conversation.Form.Sensitive = utils.IsSensitive(tags)
+}
+
 // 阶段5 添加图片 需要确认
 func stage5ImgConversation(ctx conversation.ConversationContext) (err error) {
 	if ctx.Conversation.Stage != 5 {
-		err = sendTextWithCtx(ctx, "当前会话阶段无法处理图片")
+		err = sendTextWithCtx(ctx, tr(ctx, "img_wrong_stage"))
 	} else {
 		switch ctx.Conversation.Status {
 		case "":
@@ -349,11 +750,11 @@ func stage5ImgConversation(ctx conversation.ConversationContext) (err error) {
 				log.Println("读取到图片消息", ctx.ImgContent)
 				ctx.Conversation.Form.ItemImg = imgContent.PicUrl
 				ctx.ImgContent = nil
-				err = sendTextWithCtx(ctx, "确认是这张图片吗?\n1.yes\n2.no")
+				err = sendMenuWithCtx(ctx, tr(ctx, "img_confirm"))
 			} else {
 				// 没有图片需要上传的情况
 				ctx.Conversation.Form.ItemImg = ""
-				err = sendTextWithCtx(ctx, "确认没有图片需要上传吗?\n1.yes\n2.no")
+				err = sendMenuWithCtx(ctx, tr(ctx, "no_img_confirm"))
 			}
 		case "waitconfirm":
 			ctx.Conversation.Status = ""
@@ -366,60 +767,181 @@ func stage5ImgConversation(ctx conversation.ConversationContext) (err error) {
 					log.Println("开始下载图片")
 					ctx.Conversation.Form.ItemImgName = utils.DownloadFile(picUrl)
 					log.Println("图片已下载")
-					err = sendTextWithCtx(ctx, "图片已下载")
+					err = sendTextWithCtx(ctx, tr(ctx, "img_downloaded"))
 				} else {
-					err = sendTextWithCtx(ctx, "选择不上传图片")
+					err = sendTextWithCtx(ctx, tr(ctx, "img_skipped"))
+				}
+				if ctx.Conversation.Type == conversation.KindFound && !ctx.Conversation.Edited {
+					// 捡到物品需要填写取回地点
+					ctx.Conversation.Stage = 7
+					err = sendTextWithCtx(ctx, pickupPrompt(ctx))
+				} else {
+					ctx.Conversation.Stage = 6
+					ctx.Conversation.Edited = false
+					err = askForConfirm(ctx)
 				}
-				ctx.Conversation.Stage = 6
-				err = askForConfirm(ctx)
 			case "2", "no":
 				fallthrough
 			default:
 				// 另外删除本地的图片
-				err = sendTextWithCtx(ctx, "请重新决定吧")
+				err = sendTextWithCtx(ctx, tr(ctx, "img_redecide"))
 			}
 		}
 	}
 	return
 }
 
+// 询问取回地点 列出所在城市配置好的地点
+func pickupPrompt(ctx conversation.ConversationContext) string {
+	builder := strings.Builder{}
+	builder.WriteString(tr(ctx, "ask_pickup"))
+	locations := botConfig.PickupLocations[ctx.Conversation.Form.City]
+	if len(locations) > 0 {
+		builder.WriteString(tr(ctx, "ask_pickup_choose"))
+		for i, location := range locations {
+			builder.WriteString(fmt.Sprintf("\n%d.%s", i+1, location))
+		}
+	}
+	return builder.String()
+}
+
+// 阶段7 捡到物品填写取回地点 需要确认
+func stage7PickupConversation(ctx conversation.ConversationContext) (err error) {
+	content := strings.TrimSpace(ctx.ReceiveContent.Content)
+	switch ctx.Conversation.Status {
+	case "":
+		if content == "" {
+			return sendTextWithCtx(ctx, pickupPrompt(ctx))
+		}
+		location := content
+		locations := botConfig.PickupLocations[ctx.Conversation.Form.City]
+		if index, parseErr := strconv.Atoi(content); parseErr == nil && index >= 1 && index <= len(locations) {
+			location = locations[index-1]
+		}
+		ctx.Conversation.Form.PickupLocation = location
+		ctx.Conversation.Status = "waitconfirm"
+		err = sendMenuWithCtx(ctx, tr(ctx, "pickup_confirm", i18n.Data{"PickupLocation": location}))
+	case "waitconfirm":
+		ctx.Conversation.Status = ""
+		switch content {
+		case "1", "yes":
+			if ctx.Conversation.Edited {
+				ctx.Conversation.Stage = 6
+				ctx.Conversation.Edited = false
+				err = askForConfirm(ctx)
+			} else {
+				ctx.Conversation.Stage = 8
+				err = sendTextWithCtx(ctx, tr(ctx, "ask_verify_question"))
+			}
+		case "2", "no":
+			fallthrough
+		default:
+			err = sendTextWithCtx(ctx, pickupPrompt(ctx))
+		}
+	}
+	return
+}
+
+// 阶段8 捡到物品设置验证问题 可以跳过
+func stage8VerifyConversation(ctx conversation.ConversationContext) (err error) {
+	content := strings.TrimSpace(ctx.ReceiveContent.Content)
+	switch ctx.Conversation.Status {
+	case "":
+		if content == "0" || content == "" {
+			ctx.Conversation.Form.VerifyQuestion = ""
+			ctx.Conversation.Form.VerifyAnswer = ""
+			ctx.Conversation.Stage = 6
+			ctx.Conversation.Edited = false
+			err = askForConfirm(ctx)
+		} else {
+			ctx.Conversation.Form.VerifyQuestion = content
+			ctx.Conversation.Status = "waitanswer"
+			err = sendTextWithCtx(ctx, tr(ctx, "ask_verify_answer"))
+		}
+	case "waitanswer":
+		ctx.Conversation.Status = "waitconfirm"
+		ctx.Conversation.Form.VerifyAnswer = content
+		err = sendMenuWithCtx(ctx, tr(ctx, "verify_confirm", i18n.Data{"Question": ctx.Conversation.Form.VerifyQuestion, "Answer": content}))
+	case "waitconfirm":
+		ctx.Conversation.Status = ""
+		switch content {
+		case "1", "yes":
+			ctx.Conversation.Stage = 6
+			ctx.Conversation.Edited = false
+			err = askForConfirm(ctx)
+		case "2", "no":
+			fallthrough
+		default:
+			err = sendTextWithCtx(ctx, tr(ctx, "ask_verify_question"))
+		}
+	}
+	return
+}
+
 // 提交数据库前的确认 stage6
 func askForConfirm(ctx conversation.ConversationContext) (err error) {
 	switch ctx.Conversation.Status {
 	case "":
 		log.Println("向用户展示确认信息")
+		if !ctx.Conversation.Edited {
+			// 智能模式下未能识别的项目需要单独询问
+			if asked, askErr := askForMissing(ctx); asked {
+				return askErr
+			}
+		}
 		if !ctx.Conversation.Edited {
 			// 主动发送消息，显示当前填的所有项目
 			ctx.Conversation.Status = "waitconfirm"
-			msg := fmt.Sprintf("在提交前进行确认:\n城市:%s\n物品:%s\n描述:%s\n标签:%s\n1.yes\n2.no", ctx.Conversation.Form.City,
-				ctx.Conversation.Form.ItemName, ctx.Conversation.Form.Description, strings.Join(ctx.Conversation.Form.ItemTags, ","))
+			msg := tr(ctx, "confirm_form", i18n.Data{"Form": showForm(ctx)})
 			//err = sendTextToUser(msg, ctx.ReceiveContent.FromUsername)
-			err = sendTextWithCtx(ctx, msg)
+			err = sendMenuWithCtx(ctx, msg)
 		} else {
 			// 选择切换stage处理
 			switch ctx.ReceiveContent.Content {
 			case "1":
 				ctx.Conversation.Stage = 1
-				err = sendTextWithCtx(ctx, "请重新选择要进行的操作\n1.添加记录\n2.列出记录")
+				err = sendTextWithCtx(ctx, tr(ctx, "edit_operation"))
 			case "2":
 				ctx.Conversation.Stage = 2
-				err = sendTextWithCtx(ctx, "请重新输入您所在的城市")
+				err = sendTextWithCtx(ctx, tr(ctx, "edit_location"))
 			case "3":
 				ctx.Conversation.Stage = 3
-				err = sendTextWithCtx(ctx, "请重新输入物品的名称")
+				err = sendTextWithCtx(ctx, tr(ctx, "edit_item_name"))
 			case "4":
 				ctx.Conversation.Stage = 4
-				err = sendTextWithCtx(ctx, "请重新输入详细描述")
+				err = sendTextWithCtx(ctx, tr(ctx, "edit_description"))
 			case "5":
 				ctx.Conversation.Stage = 5
-				err = sendTextWithCtx(ctx, "请重新上传图片(输入文字则不上传图片)")
+				err = sendTextWithCtx(ctx, tr(ctx, "edit_img"))
 			case "6":
 				ctx.Conversation.Edited = false
 				ctx.Conversation.Stage = 6
-				err = sendTextWithCtx(ctx, "取消选择，输入任意文本继续操作")
+				err = sendTextWithCtx(ctx, tr(ctx, "edit_cancel"))
 			case "7":
-				err = sendTextWithCtx(ctx, "已取消该次会话")
+				err = sendTextWithCtx(ctx, tr(ctx, "conversation_cancelled"))
 				delete(conversationMap, ctx.ReceiveContent.FromUsername)
+			case "8":
+				// 切换隐私保护后直接重新展示表单
+				ctx.Conversation.Form.Sensitive = !ctx.Conversation.Form.Sensitive
+				ctx.Conversation.Edited = false
+				err = askForConfirm(ctx)
+			case "9":
+				if ctx.Conversation.Type == conversation.KindFound {
+					ctx.Conversation.Stage = 8
+					err = sendTextWithCtx(ctx, tr(ctx, "ask_verify_question"))
+				} else {
+					err = sendTextWithCtx(ctx, tr(ctx, "general_invalid"))
+				}
+			case "10":
+				if ctx.Conversation.Type == conversation.KindFound {
+					ctx.Conversation.Stage = 7
+					err = sendTextWithCtx(ctx, pickupPrompt(ctx))
+				} else {
+					err = sendTextWithCtx(ctx, tr(ctx, "general_invalid"))
+				}
+			case "11":
+				ctx.Conversation.Stage = 10
+				err = sendTextWithCtx(ctx, askTimePrompt(ctx))
 			}
 		}
 	case "waitconfirm":
@@ -429,21 +951,44 @@ func askForConfirm(ctx conversation.ConversationContext) (err error) {
 		switch ctx.ReceiveContent.Content {
 		case "1", "yes":
 			// 提交至数据库
-			err = dao.AddRecord(ctx)
-			err = sendTextWithCtx(ctx, "已添加记录,当前会话已结束") //TODO 可扩展提交记录后进行查找
+			record, addErr := repo.AddRecord(ctx)
+			if addErr != nil {
+				// 保存失败时保留会话 用户可以再次确认
+				log.Println("添加记录出错", addErr.Error())
+				ctx.Conversation.Status = "waitconfirm"
+				return sendTextWithCtx(ctx, tr(ctx, "record_add_failed"))
+			}
+			err = sendTextWithCtx(ctx, tr(ctx, "record_added")) //TODO 可扩展提交记录后进行查找
 			delete(conversationMap, ctx.ReceiveContent.FromUsername)
+			onRecordAdded(ctx, record)
 		case "2", "no":
 			fallthrough
 		default:
 			// 要求选择需要修改哪一阶段
 			ctx.Conversation.Edited = true
-			err = sendTextWithCtx(ctx, "请输入您想要修改哪一阶段\n1.操作选择(添加记录或者是列出已有记录)\n2.城市修改\n3.物品名称修改\n4.修改描述\n5.重新上传图片\n6.取消\n7.退出会话")
+			err = sendTextWithCtx(ctx, tr(ctx, "edit_menu"))
 		}
 	}
 	return
 }
 
-// TODO 展示当前表单已填项目
-func showForm(ctx conversation.ConversationContext) (form string) {
-	return
+// 展示当前表单已填项目
+func showForm(ctx conversation.ConversationContext) string {
+	form := ctx.Conversation.Form
+	occurredAt := ""
+	if !form.OccurredAt.IsZero() {
+		occurredAt = utils.FormatTime(form.OccurredAt)
+	}
+	return tr(ctx, "form", i18n.Data{
+		"Location":       form.Location,
+		"ItemName":       form.ItemName,
+		"Description":    form.Description,
+		"Tags":           strings.Join(form.ItemTags, ","),
+		"Sensitive":      form.Sensitive,
+		"Time":           occurredAt,
+		"LocationLabel":  form.LocationLabel,
+		"PickupLocation": form.PickupLocation,
+		"VerifyQuestion": form.VerifyQuestion,
+		"VerifyAnswer":   form.VerifyAnswer,
+	})
 }
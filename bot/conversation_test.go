@@ -0,0 +1,114 @@
+package bot
+
+import (
+	"fmt"
+	"testing"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/dao"
+)
+
+func TestClaim(t *testing.T) {
+	umbrella := conversation.Form{City: "杭州", Location: "杭州/西溪园区", ItemName: "黑色雨伞", ItemTags: []string{"雨伞"}, Description: "在3楼会议室捡到", PickupLocation: "前台"}
+	question := umbrella
+	question.VerifyQuestion, question.VerifyAnswer = "伞柄是什么颜色", "红色"
+	card := conversation.Form{City: "杭州", Location: "杭州/西溪园区", ItemName: "工牌", ItemTags: []string{"工牌"}, Description: "蓝色挂绳", Sensitive: true}
+	tests := []struct {
+		name       string
+		form       conversation.Form
+		statuses   []dao.RecordStatus // 认领前由管理员变更的状态
+		claimant   string
+		answers    []string
+		reply      string // 认领人最后收到的提示
+		revealed   bool   // 是否向认领人展示了完整记录
+		notify     string // 登记人收到的通知 为空时不应该收到通知
+		wantStatus dao.RecordStatus
+		verified   bool
+	}{
+		{name: "没有验证问题直接认领", form: umbrella, claimant: "bob", reply: "验证通过", revealed: true, notify: "认领了您登记的物品", wantStatus: dao.StatusClaimed, verified: true},
+		{name: "敏感物品没有验证问题需要登记人核实", form: card, claimant: "bob", reply: "已通知登记人核实", notify: "想认领您登记的敏感物品", wantStatus: dao.StatusOpen},
+		{name: "已认领的记录", form: umbrella, statuses: []dao.RecordStatus{dao.StatusClaimed}, claimant: "bob", reply: "无法认领", wantStatus: dao.StatusClaimed},
+		{name: "已完成的记录", form: umbrella, statuses: []dao.RecordStatus{dao.StatusCompleted}, claimant: "bob", reply: "无法认领", wantStatus: dao.StatusCompleted},
+		{name: "已归档的记录", form: question, statuses: []dao.RecordStatus{dao.StatusExpired, dao.StatusArchived}, claimant: "bob", reply: "无法认领", wantStatus: dao.StatusArchived},
+		{name: "移交保管点的记录可以认领", form: umbrella, statuses: []dao.RecordStatus{dao.StatusInCustody}, claimant: "bob", reply: "验证通过", revealed: true, notify: "认领了您登记的物品", wantStatus: dao.StatusClaimed, verified: true},
+		{name: "不能认领自己的记录", form: umbrella, claimant: "alice", reply: "不能认领自己登记的物品", wantStatus: dao.StatusOpen},
+		{name: "回答正确", form: question, claimant: "bob", answers: []string{"红色"}, reply: "验证通过", revealed: true, notify: "认领了您登记的物品", wantStatus: dao.StatusClaimed, verified: true},
+		{name: "回答错误后重试", form: question, claimant: "bob", answers: []string{"黑色"}, reply: "还可以尝试2次", wantStatus: dao.StatusOpen},
+		{name: "多次回答错误", form: question, claimant: "bob", answers: []string{"黑色", "白色", "绿色"}, reply: "验证次数已用完", wantStatus: dao.StatusOpen},
+		{name: "回答错误后再回答正确", form: question, claimant: "bob", answers: []string{"黑色", "红色"}, reply: "验证通过", revealed: true, notify: "认领了您登记的物品", wantStatus: dao.StatusClaimed, verified: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := newTestBot(t)
+			record := b.addRecord(t, "alice", conversation.KindFound, test.form)
+			for _, status := range test.statuses {
+				role := dao.RoleAdmin
+				if status == dao.StatusArchived {
+					role = dao.RoleSystem
+				}
+				if _, err := b.repo.TransitionRecord(record.Id, status, "admin", role, ""); err != nil {
+					t.Fatal(err)
+				}
+			}
+			b.send(test.claimant, fmt.Sprintf("认领 %d", record.Id))
+			for _, answer := range test.answers {
+				b.send(test.claimant, answer)
+			}
+			if !b.receivedText(test.claimant, test.reply) {
+				t.Errorf("认领人应该收到%q %q", test.reply, b.received(test.claimant))
+			}
+			if revealed := b.receivedText(test.claimant, "描述:"+test.form.Description); revealed != test.revealed {
+				t.Errorf("展示完整记录应该为%v %q", test.revealed, b.received(test.claimant))
+			}
+			if test.claimant != "alice" {
+				owner := b.received("alice")
+				if test.notify == "" && len(owner) > 0 {
+					t.Errorf("登记人不应该收到通知 %q", owner)
+				}
+				if test.notify != "" && !b.receivedText("alice", test.notify) {
+					t.Errorf("登记人应该收到%q %q", test.notify, owner)
+				}
+			}
+			got, err := b.repo.GetRecordById(record.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != test.wantStatus {
+				t.Errorf("记录状态应该为%s 实际为%s", test.wantStatus, got.Status)
+			}
+			if verified := b.repo.IsClaimVerified(record.Id, test.claimant); verified != test.verified {
+				t.Errorf("认领验证应该为%v", test.verified)
+			}
+		})
+	}
+}
+
+func TestClaimAttemptsExhausted(t *testing.T) {
+	b := newTestBot(t)
+	form := conversation.Form{City: "杭州", Location: "杭州/西溪园区", ItemName: "黑色雨伞", ItemTags: []string{"雨伞"}, VerifyQuestion: "伞柄是什么颜色", VerifyAnswer: "红色"}
+	record := b.addRecord(t, "alice", conversation.KindFound, form)
+	claim := fmt.Sprintf("认领 %d", record.Id)
+	b.send("bob", claim)
+	for _, answer := range []string{"黑色", "白色", "绿色"} {
+		b.send("bob", answer)
+	}
+	// 次数用完后重新认领也不会再询问验证问题
+	before := len(b.received("bob"))
+	b.send("bob", claim)
+	b.send("bob", "红色")
+	after := b.received("bob")[before:]
+	if !containsText(after, "请联系管理员") {
+		t.Errorf("次数用完后应该不能再认领 %q", after)
+	}
+	if b.repo.IsClaimVerified(record.Id, "bob") {
+		t.Errorf("次数用完后不应该再通过验证 %q", after)
+	}
+	if attempts := b.repo.CountFailedClaimAttempts(record.Id, "bob"); attempts != 3 {
+		t.Errorf("应该记录3次失败的认领 %d", attempts)
+	}
+	// 其他用户不受影响
+	b.send("carol", claim)
+	b.send("carol", "红色")
+	if !b.repo.IsClaimVerified(record.Id, "carol") {
+		t.Error("其他用户应该可以认领")
+	}
+}
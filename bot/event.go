@@ -0,0 +1,98 @@
+package bot
+
+import (
+	"log"
+	"time"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/dao"
+	"wxbot-lostandfound/handler"
+	"wxbot-lostandfound/i18n"
+)
+
+// 自定义菜单的key 对应会话中的快捷输入
+const (
+	menuKeyLost      = "LOST"
+	menuKeyFound     = "FOUND"
+	menuKeySmart     = "SMART"
+	menuKeyMyRecords = "MY_RECORDS"
+	menuKeySubscribe = "MY_SUBSCRIPTIONS"
+)
+
+var menuShortcuts = map[string]string{
+	menuKeyLost:  "1",
+	menuKeyFound: "2",
+	menuKeySmart: "5",
+}
+
+// 处理事件消息 进入应用时打招呼,菜单点击映射为会话中的输入
+func handleEvent(ctx conversation.ConversationContext) (err error) {
+	msgContent, w, timestamp, nonce := ctx.ReceiveContent, ctx.W, ctx.Timestamp, ctx.Nonce
+	log.Printf("接收到事件 %s %s\n", msgContent.Event, msgContent.EventKey)
+	userName := msgContent.FromUsername
+	switch msgContent.Event {
+	case conversation.EventEnterAgent, conversation.EventSubscribe:
+		if _, exist := conversationMap[userName]; exist {
+			// 已有会话时不打断
+			return replyText(*msgContent, w, timestamp, nonce, "")
+		}
+		err = startConversation(ctx)
+	case conversation.EventUnsubscribe:
+		delete(conversationMap, userName)
+		err = replyText(*msgContent, w, timestamp, nonce, "")
+	case conversation.EventClick:
+		if msgContent.EventKey == menuKeyMyRecords {
+			if err = replyText(*msgContent, w, timestamp, nonce, ""); err != nil {
+				return
+			}
+			return sendMyRecords(userName)
+		}
+		if msgContent.EventKey == menuKeySubscribe {
+			if err = replyText(*msgContent, w, timestamp, nonce, ""); err != nil {
+				return
+			}
+			return sendSubscriptions(userName)
+		}
+		input, ok := menuShortcuts[msgContent.EventKey]
+		if !ok {
+			log.Println("未知的菜单key", msgContent.EventKey)
+			return replyText(*msgContent, w, timestamp, nonce, "")
+		}
+		// 从头开始一个新的会话 并把菜单作为阶段0的输入
+		conversationMap[userName] = &conversation.Conversation{
+			UserName:   userName,
+			LastActive: time.Now(),
+			Stage:      0,
+		}
+		msgContent.Content = input
+		err = startConversation(ctx)
+	case conversation.EventTemplateCard:
+		// 只响应最近发送的卡片 旧卡片的序号在当前阶段可能有不同的含义
+		if c, exist := conversationMap[userName]; !exist || c.TaskId == "" || c.TaskId != msgContent.TaskId {
+			log.Println("忽略过期的模板卡片", msgContent.TaskId)
+			if err = replyText(*msgContent, w, timestamp, nonce, ""); err != nil {
+				return
+			}
+			return sendTextToUser(trUser(userName, "card_expired"), userName)
+		}
+		// 按钮的key即为菜单的序号 作为文字输入继续会话
+		msgContent.Content = msgContent.EventKey
+		err = startConversation(ctx)
+	default:
+		// view等事件不需要处理
+		err = replyText(*msgContent, w, timestamp, nonce, "")
+	}
+	return
+}
+
+// 我的记录 列出用户自己登记的所有记录
+func sendMyRecords(userName string) error {
+	records := handler.GetRecords(dao.RecordFilter{User: userName})
+	if len(records) == 0 {
+		return sendTextToUser(trUser(userName, "no_records"), userName)
+	}
+	if err := sendTextToUser(trUser(userName, "my_records_count", i18n.Data{"Count": len(records)}), userName); err != nil {
+		return err
+	}
+	sendRecordsToUser(records, handler.Viewer{UserName: userName, IsAdmin: isAdmin(userName)}, userName)
+	return nil
+}
@@ -0,0 +1,88 @@
+package bot
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/i18n"
+	"wxbot-lostandfound/utils"
+)
+
+// 用户语言 用户通过 language 命令设置,未设置时使用默认语言
+var (
+	languageMap     = map[string]string{}
+	languageLock    sync.RWMutex // 多个请求同时读写languageMap
+	languageRegexp  = regexp.MustCompile(`(?i)^(?:/?language|/?lang|语言)(?:\s+(\S+))?$`)
+	languageAliases = map[string]string{
+		"中文": "zh", "chinese": "zh", "zh-cn": "zh",
+		"英文": "en", "英语": "en", "english": "en",
+	}
+)
+
+// 加载语言文件 缺少文案时无法启动
+func loadLocales() {
+	localeDir := botConfig.LocaleDir
+	if localeDir == "" {
+		localeDir = "locales"
+	}
+	utils.CheckError(i18n.Load(localeDir, botConfig.DefaultLanguage), "加载语言文件")
+}
+
+func userLanguage(userName string) string {
+	languageLock.RLock()
+	lang, exist := languageMap[userName]
+	languageLock.RUnlock()
+	if exist {
+		return lang
+	}
+	lang = repo.GetUserSetting(userName).Language
+	if !i18n.Supported(lang) {
+		lang = i18n.DefaultLanguage
+	}
+	setUserLanguage(userName, lang)
+	return lang
+}
+
+func setUserLanguage(userName string, lang string) {
+	languageLock.Lock()
+	languageMap[userName] = lang
+	languageLock.Unlock()
+}
+
+// 按用户的语言渲染文案
+func tr(ctx conversation.ConversationContext, key string, data ...interface{}) string {
+	return trUser(ctx.ReceiveContent.FromUsername, key, data...)
+}
+
+func trUser(userName string, key string, data ...interface{}) string {
+	return i18n.T(userLanguage(userName), key, data...)
+}
+
+// 处理语言命令 如 language en, 语言 中文, 不是语言命令时返回false
+func languageCommand(ctx conversation.ConversationContext) (handled bool, err error) {
+	match := languageRegexp.FindStringSubmatch(strings.TrimSpace(ctx.ReceiveContent.Content))
+	if match == nil {
+		return false, nil
+	}
+	userName := ctx.ReceiveContent.FromUsername
+	languages := strings.Join(i18n.Languages(), ",")
+	lang := strings.ToLower(match[1])
+	if alias, exist := languageAliases[lang]; exist {
+		lang = alias
+	}
+	switch {
+	case lang == "":
+		err = sendTextWithCtx(ctx, tr(ctx, "language_current", i18n.Data{"Language": userLanguage(userName), "Languages": languages}))
+	case !i18n.Supported(lang):
+		err = sendTextWithCtx(ctx, tr(ctx, "language_unsupported", i18n.Data{"Language": match[1], "Languages": languages}))
+	default:
+		if saveErr := repo.SetLanguage(userName, lang); saveErr != nil {
+			log.Println("保存用户语言出错", saveErr.Error())
+		}
+		setUserLanguage(userName, lang)
+		err = sendTextWithCtx(ctx, tr(ctx, "language_switched"))
+	}
+	return true, err
+}
@@ -0,0 +1,74 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/i18n"
+	"wxbot-lostandfound/utils"
+)
+
+// 应用自定义菜单 点击后以click事件推送到回调地址
+type MenuButton struct {
+	Type      string       `json:"type,omitempty"`
+	Name      string       `json:"name"`
+	Key       string       `json:"key,omitempty"`
+	Url       string       `json:"url,omitempty"`
+	SubButton []MenuButton `json:"sub_button,omitempty"`
+}
+
+type Menu struct {
+	Button []MenuButton `json:"button"`
+}
+
+// 菜单对所有用户相同 使用默认语言
+func defaultMenu() Menu {
+	lang := i18n.DefaultLanguage
+	return Menu{
+		Button: []MenuButton{
+			{Type: "click", Name: i18n.T(lang, "menu_lost"), Key: menuKeyLost},
+			{Type: "click", Name: i18n.T(lang, "menu_found"), Key: menuKeyFound},
+			{Name: i18n.T(lang, "menu_more"), SubButton: []MenuButton{
+				{Type: "click", Name: i18n.T(lang, "menu_smart"), Key: menuKeySmart},
+				{Type: "click", Name: i18n.T(lang, "menu_my_records"), Key: menuKeyMyRecords},
+				{Type: "click", Name: i18n.T(lang, "menu_my_subscriptions"), Key: menuKeySubscribe},
+			}},
+		},
+	}
+}
+
+// 调用企业微信接口创建应用的自定义菜单
+func CreateMenu() error {
+	token, err := getAccessToken()
+	utils.CheckError(err, "获取access token")
+	botConfig.AccessToken = token
+	loadLocales()
+	jsonMenu, err := json.Marshal(defaultMenu())
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/cgi-bin/menu/create?access_token=%s&agentid=%d", apiBaseUrl, botConfig.AccessToken, botConfig.AgentId)
+	resp, err := http.Post(url, "application/json", bytes.NewReader(jsonMenu))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	response := &conversation.InitiativeMsgResponse{}
+	if err = json.Unmarshal(body, response); err != nil {
+		return err
+	}
+	if response.Errcode != 0 {
+		return errors.New("创建菜单失败:" + response.Errmsg)
+	}
+	log.Println("成功创建应用菜单")
+	return nil
+}
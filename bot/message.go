@@ -5,10 +5,13 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/dao"
+	"wxbot-lostandfound/handler"
 	"wxbot-lostandfound/utils"
 )
 
@@ -72,7 +75,7 @@ func sendTextToUser(text string, userName string) error {
 	conversation.InitiativeTextMsgPool.Put(initiativeTextMsg)
 	// 最多重试3次
 	for i := 0; i < 3; i++ {
-		req, err := http.NewRequest("POST", "https://qyapi.weixin.qq.com/cgi-bin/message/send?access_token="+botConfig.AccessToken, bytes.NewReader(jsonMsg))
+		req, err := http.NewRequest("POST", apiBaseUrl+"/cgi-bin/message/send?access_token="+botConfig.AccessToken, bytes.NewReader(jsonMsg))
 		if err != nil {
 			return err
 		}
@@ -99,46 +102,90 @@ func sendTextToUser(text string, userName string) error {
 }
 
 // 主动发送markdown
-// TODO 使用type switch 和上一个方法进行合并 减少重复代码
 func sendMDtoUserWithCtx(ctx conversation.ConversationContext, md string) error {
-	initiativeMsgResponse := &conversation.InitiativeMsgResponse{}
-	markdownMsg := conversation.MarkDownMsg{
-		Touser:  ctx.ReceiveContent.FromUsername,
-		Msgtype: "markdown",
-		Agentid: botConfig.AgentId,
-		EnableDuplicateCheck:   0,
-		DuplicateCheckInterval: 0,
-	}
+	return sendMDtoUser(md, ctx.ReceiveContent.FromUsername)
+}
+
+func sendMDtoUser(md string, userName string) error {
+	markdownMsg := &conversation.MarkDownMsg{Msgtype: "markdown"}
+	markdownMsg.Markdown.Content = md
+	return sendMsgToUser(markdownMsg, userName)
+}
+
+// 主动发送markdown到部门 多个部门id用|分隔
+func sendMDtoParty(md string, party string) error {
+	markdownMsg := &conversation.MarkDownMsg{Toparty: party, Msgtype: "markdown", Agentid: botConfig.AgentId}
 	markdownMsg.Markdown.Content = md
-	client := &http.Client{}
 	jsonMsg, err := json.Marshal(markdownMsg)
 	if err != nil {
 		return err
 	}
-	// 最多重试3次
+	return sendJsonMsg(jsonMsg, "部门Markdown")
+}
+
+// 主动发送各类消息 填写接收人和应用id后发送
+func sendMsgToUser(msg interface{}, userName string) error {
+	var msgName string
+	switch m := msg.(type) {
+	case *conversation.InitiativeTextMsg:
+		m.Touser, m.Agentid, msgName = userName, botConfig.AgentId, "文本"
+	case *conversation.MarkDownMsg:
+		m.Touser, m.Agentid, msgName = userName, botConfig.AgentId, "Markdown"
+	case *conversation.NewsMsg:
+		m.Touser, m.Agentid, msgName = userName, botConfig.AgentId, "图文"
+	case *conversation.TextCardMsg:
+		m.Touser, m.Agentid, msgName = userName, botConfig.AgentId, "文本卡片"
+	case *conversation.TemplateCardMsg:
+		m.Touser, m.Agentid, msgName = userName, botConfig.AgentId, "模板卡片"
+	default:
+		return fmt.Errorf("不支持的消息类型 %T", msg)
+	}
+	jsonMsg, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return sendJsonMsg(jsonMsg, msgName)
+}
+
+// 主动发送已经序列化的消息 最多重试3次
+func sendJsonMsg(jsonMsg []byte, msgName string) (err error) {
+	initiativeMsgResponse := &conversation.InitiativeMsgResponse{}
+	client := &http.Client{}
 	for i := 0; i < 3; i++ {
-		req, err := http.NewRequest("POST", "https://qyapi.weixin.qq.com/cgi-bin/message/send?access_token="+botConfig.AccessToken, bytes.NewReader(jsonMsg))
+		var req *http.Request
+		var resp *http.Response
+		var body []byte
+		req, err = http.NewRequest("POST", apiBaseUrl+"/cgi-bin/message/send?access_token="+botConfig.AccessToken, bytes.NewReader(jsonMsg))
 		if err != nil {
-			return err
+			return
 		}
-		resp, err := client.Do(req)
-		if err != nil {
-			return err
+		if resp, err = client.Do(req); err != nil {
+			return
 		}
-		body, err := ioutil.ReadAll(resp.Body)
+		body, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
 		if err != nil {
-			return err
+			return
 		}
 		// 需要检查token是否有效，无效需要重新获取，重新发送
 		json.Unmarshal(body, initiativeMsgResponse)
-		log.Println(initiativeMsgResponse)
-		if initiativeMsgResponse.Errcode != 0 {
-			log.Println("主动发送Markdown消息出现错误", string(body))
-			getAccessToken()
-		} else {
-			log.Println("成功发送主动Markdown消息。")
-			break
+		if initiativeMsgResponse.Errcode == 0 {
+			log.Printf("成功发送主动%s消息。\n", msgName)
+			return nil
+		}
+		log.Printf("主动发送%s消息出现错误 %s\n", msgName, string(body))
+		err = errors.New(initiativeMsgResponse.Errmsg)
+		getAccessToken()
+	}
+	return
+}
+
+// 按配置的格式渲染记录并发送
+func sendRecordsToUser(records []dao.ItemRecord, viewer handler.Viewer, userName string) {
+	viewer.Language = userLanguage(userName)
+	for _, msg := range renderer.Render(records, viewer) {
+		if err := sendMsgToUser(msg, userName); err != nil {
+			log.Println("返回记录出错", err.Error())
 		}
 	}
-	return err
 }
@@ -0,0 +1,56 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// 管理后台使用的企业微信网页授权 只需要获取成员的UserId
+type wecomOAuth struct{}
+
+type oauthUserResponse struct {
+	Errcode int    `json:"errcode"`
+	Errmsg  string `json:"errmsg"`
+	UserId  string `json:"UserId"` // 非企业成员授权时为空
+}
+
+// 网页授权链接 需要在企业微信客户端中打开
+func (wecomOAuth) AuthorizeUrl(redirectUri string, state string) string {
+	return fmt.Sprintf("https://open.weixin.qq.com/connect/oauth2/authorize?appid=%s&redirect_uri=%s&response_type=code&scope=snsapi_base&state=%s&agentid=%d#wechat_redirect",
+		botConfig.CorpId, url.QueryEscape(redirectUri), url.QueryEscape(state), botConfig.AgentId)
+}
+
+// 根据授权回调中的code获取成员的UserId
+func (wecomOAuth) UserId(code string) (userId string, err error) {
+	for i := 0; i < 2; i++ {
+		var resp *http.Response
+		var body []byte
+		resp, err = http.Get(fmt.Sprintf("%s/cgi-bin/user/getuserinfo?access_token=%s&code=%s", apiBaseUrl, botConfig.AccessToken, url.QueryEscape(code)))
+		if err != nil {
+			return
+		}
+		body, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return
+		}
+		response := &oauthUserResponse{}
+		if err = json.Unmarshal(body, response); err != nil {
+			return
+		}
+		if response.Errcode == 0 {
+			if response.UserId == "" {
+				return "", errors.New("不是企业成员")
+			}
+			return response.UserId, nil
+		}
+		// access token过期时重新获取后重试
+		err = errors.New(response.Errmsg)
+		getAccessToken()
+	}
+	return
+}
@@ -0,0 +1,144 @@
+package bot
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/dao"
+	"wxbot-lostandfound/i18n"
+	"wxbot-lostandfound/utils"
+)
+
+// 管理员修改、删除、恢复记录以及查看修改历史 完成后回到管理员菜单
+
+// 可以修改的项目 输入的项目名称 -> 列名
+var editFields = map[string]string{
+	"名称": "item_name", "name": "item_name",
+	"描述": "description", "description": "description",
+	"地点": "location", "location": "location",
+	"取回地点": "pickup_location", "pickup": "pickup_location",
+	"标签": "tags", "tags": "tags",
+}
+
+// 发送结果并回到管理员菜单
+func adminDone(ctx conversation.ConversationContext, key string, data interface{}) error {
+	return sendMenuWithCtx(ctx, tr(ctx, key, data)+"\n"+tr(ctx, "admin_operation"))
+}
+
+// 重新询问 停留在当前操作
+func adminAskAgain(ctx conversation.ConversationContext, key string) error {
+	ctx.Conversation.Stage = 2
+	return sendTextWithCtx(ctx, tr(ctx, key))
+}
+
+// 修改记录 如 12 名称 黑色雨伞
+func editRecordConversation(ctx conversation.ConversationContext, content string) error {
+	fields := strings.Fields(content)
+	if len(fields) < 3 {
+		return adminAskAgain(ctx, "ask_edit")
+	}
+	id, err := strconv.ParseInt(fields[0], 10, 64)
+	column, exist := editFields[strings.ToLower(fields[1])]
+	if err != nil || !exist {
+		return adminAskAgain(ctx, "ask_edit")
+	}
+	value := strings.Join(fields[2:], " ")
+	var location *utils.Location
+	if column == "location" {
+		matches := matchLocations(value)
+		if len(matches) != 1 {
+			return adminAskAgain(ctx, "edit_location_invalid")
+		}
+		location = matches[0]
+	}
+	record, err := repo.UpdateRecord(id, ctx.ReceiveContent.FromUsername, func(record *dao.ItemRecord) {
+		switch column {
+		case "item_name":
+			record.ItemName = value
+		case "description":
+			record.Description = value
+		case "location":
+			record.City = location.City()
+			record.Location = location.Path()
+		case "pickup_location":
+			record.PickupLocation = value
+		case "tags":
+			record.Tags = strings.Join(strings.Fields(strings.ReplaceAll(value, ",", " ")), ",")
+		}
+	})
+	if err != nil {
+		log.Println("修改记录出错", err.Error())
+		return adminDone(ctx, "edit_failed", nil)
+	}
+	return adminDone(ctx, "edit_done", record)
+}
+
+func deleteRecordConversation(ctx conversation.ConversationContext, content string) error {
+	id, err := strconv.ParseInt(content, 10, 64)
+	if err != nil {
+		return adminAskAgain(ctx, "ask_delete_id")
+	}
+	if err := repo.DeleteRecord(id, ctx.ReceiveContent.FromUsername); err != nil {
+		log.Println("删除记录出错", err.Error())
+		return adminDone(ctx, "delete_failed", nil)
+	}
+	return adminDone(ctx, "delete_done", i18n.Data{"Id": id})
+}
+
+// 恢复记录 如 12 恢复已删除的记录, 12 2 恢复到版本2
+func restoreRecordConversation(ctx conversation.ConversationContext, content string) error {
+	fields := strings.Fields(content)
+	if len(fields) == 0 || len(fields) > 2 {
+		return adminAskAgain(ctx, "ask_restore")
+	}
+	id, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return adminAskAgain(ctx, "ask_restore")
+	}
+	version := 0
+	if len(fields) == 2 {
+		if version, err = strconv.Atoi(fields[1]); err != nil {
+			return adminAskAgain(ctx, "ask_restore")
+		}
+	}
+	record, err := repo.RestoreRecord(id, version, ctx.ReceiveContent.FromUsername)
+	if err != nil {
+		log.Println("恢复记录出错", err.Error())
+		return adminDone(ctx, "restore_failed", nil)
+	}
+	return adminDone(ctx, "restore_done", record)
+}
+
+// 修改历史 列出每个历史版本保存时的内容
+func revisionHistoryConversation(ctx conversation.ConversationContext, content string) error {
+	id, err := strconv.ParseInt(content, 10, 64)
+	if err != nil {
+		return adminAskAgain(ctx, "ask_history_id")
+	}
+	revisions := repo.GetRevisions(id)
+	if len(revisions) == 0 {
+		return adminDone(ctx, "revision_empty", i18n.Data{"Id": id})
+	}
+	_, err = repo.GetRecordById(id)
+	builder := strings.Builder{}
+	builder.WriteString(tr(ctx, "revision_title", i18n.Data{"Id": id, "Deleted": err != nil}))
+	for _, revision := range revisions {
+		record, err := revision.Record()
+		if err != nil {
+			log.Println("解析历史版本出错", err.Error())
+			continue
+		}
+		builder.WriteString("\n" + tr(ctx, "revision_item", i18n.Data{
+			"Version":  revision.Version,
+			"Time":     utils.FormatTime(revision.CreatedAt),
+			"Editor":   revision.Editor,
+			"Action":   tr(ctx, "revision_action_"+string(revision.Action)),
+			"ItemName": record.ItemName,
+			"Location": record.Location,
+			"Tags":     record.Tags,
+		}))
+	}
+	builder.WriteString("\n" + tr(ctx, "revision_hint", i18n.Data{"Id": id}))
+	return sendMenuWithCtx(ctx, builder.String()+"\n"+tr(ctx, "admin_operation"))
+}
@@ -0,0 +1,159 @@
+package bot
+
+import (
+	"log"
+	"strings"
+	"time"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/dao"
+	"wxbot-lostandfound/handler"
+	"wxbot-lostandfound/i18n"
+	"wxbot-lostandfound/scheduler"
+	"wxbot-lostandfound/utils"
+)
+
+// 定时任务 汇总推送、提醒登记人更新记录、归档过期记录
+// 执行时间使用cron表达式配置 如 "0 9 * * *" 每天9点, "0 9 * * 1" 每周一9点
+
+type ScheduleConfig struct {
+	Digests  []DigestConfig
+	Reminder ReminderConfig
+	Archive  ArchiveConfig
+}
+
+// 汇总最近新增的记录以及仍未认领的捡到物品
+type DigestConfig struct {
+	Name     string
+	Cron     string
+	Days     int      // 汇总最近几天新增的记录 默认为1
+	Webhooks []string // 推送到的群机器人 对应Webhooks中的Name
+	Parties  []string // 推送到的部门id
+	Language string
+}
+
+// 提醒登记人更新或关闭超过AfterDays天仍未完成的记录 每条记录每AfterDays天最多提醒一次
+type ReminderConfig struct {
+	Cron      string
+	AfterDays int
+}
+
+// 归档创建超过AfterDays天的记录
+type ArchiveConfig struct {
+	Cron      string
+	AfterDays int
+}
+
+const maxDigestItems = 20 // 每部分最多列出的记录数 避免超出消息长度限制
+
+// 根据配置创建调度器 clock在测试时可以替换为手动控制的时钟
+func newScheduler(clock scheduler.Clock) *scheduler.Scheduler {
+	s := scheduler.New(clock)
+	config := botConfig.Schedule
+	for _, digest := range config.Digests {
+		digest := digest
+		utils.CheckError(s.Add("汇总"+digest.Name, digest.Cron, func(now time.Time) { sendDigest(digest, now) }), "添加汇总任务")
+	}
+	if config.Reminder.Cron != "" && config.Reminder.AfterDays > 0 {
+		utils.CheckError(s.Add("提醒", config.Reminder.Cron, func(now time.Time) { remindStaleRecords(config.Reminder, now) }), "添加提醒任务")
+	}
+	if config.Archive.Cron != "" && config.Archive.AfterDays > 0 {
+		utils.CheckError(s.Add("归档", config.Archive.Cron, func(now time.Time) { archiveRecords(config.Archive, now) }), "添加归档任务")
+	}
+	return s
+}
+
+// 汇总消息 markdown格式
+func digestMarkdown(config DigestConfig, now time.Time) string {
+	days := config.Days
+	if days <= 0 {
+		days = 1
+	}
+	lang := config.Language
+	if lang == "" {
+		lang = i18n.DefaultLanguage
+	}
+	since := now.AddDate(0, 0, -days)
+	viewer := handler.Viewer{Language: lang}
+	newRecords := handler.GetRecords(dao.RecordFilter{CreatedSince: since, CreatedBefore: now})
+	unclaimed := handler.GetRecords(dao.RecordFilter{Type: conversation.KindFound, Statuses: []dao.RecordStatus{dao.StatusOpen, dao.StatusInCustody}, CreatedBefore: since})
+	builder := strings.Builder{}
+	builder.WriteString(i18n.T(lang, "digest_title", i18n.Data{"Since": since.Format("2006-01-02 15:04"), "Until": now.Format("2006-01-02 15:04")}))
+	writeSection := func(key string, records []dao.ItemRecord) {
+		builder.WriteString("\n" + i18n.T(lang, key, i18n.Data{"Count": len(records)}))
+		for i, record := range records {
+			if i == maxDigestItems {
+				builder.WriteString("\n" + i18n.T(lang, "digest_more", i18n.Data{"Count": len(records) - maxDigestItems}))
+				break
+			}
+			builder.WriteString("\n" + handler.RenderRecord("digest_item", record, viewer))
+		}
+	}
+	writeSection("digest_new", newRecords)
+	writeSection("digest_unclaimed", unclaimed)
+	return builder.String()
+}
+
+func sendDigest(config DigestConfig, now time.Time) {
+	md := digestMarkdown(config, now)
+	for _, name := range config.Webhooks {
+		sent := false
+		for _, robot := range robots {
+			if robot.Target.Name == name {
+				sent = true
+				if err := robot.SendMarkdown(md); err != nil {
+					log.Printf("推送汇总到群聊%s出错 %s\n", name, err.Error())
+				}
+			}
+		}
+		if !sent {
+			log.Printf("汇总%s配置的群聊%s不存在\n", config.Name, name)
+		}
+	}
+	if len(config.Parties) > 0 {
+		if err := sendMDtoParty(md, strings.Join(config.Parties, "|")); err != nil {
+			log.Printf("推送汇总到部门出错 %s\n", err.Error())
+		}
+	}
+}
+
+// 提醒登记人更新或关闭长时间未完成的记录
+func remindStaleRecords(config ReminderConfig, now time.Time) {
+	records := repo.GetStaleRecords(now.AddDate(0, 0, -config.AfterDays))
+	userRecords := map[string][]dao.ItemRecord{}
+	var users []string
+	for _, record := range records {
+		if _, exist := userRecords[record.User]; !exist {
+			users = append(users, record.User)
+		}
+		userRecords[record.User] = append(userRecords[record.User], record)
+	}
+	for _, userName := range users {
+		records := userRecords[userName]
+		viewer := handler.Viewer{UserName: userName, Language: userLanguage(userName)}
+		builder := strings.Builder{}
+		builder.WriteString(trUser(userName, "reminder_title", i18n.Data{"Count": len(records), "Days": config.AfterDays}))
+		ids := make([]int64, 0, len(records))
+		for _, record := range records {
+			builder.WriteString("\n" + handler.RenderRecord("digest_item", record, viewer))
+			ids = append(ids, record.Id)
+		}
+		builder.WriteString("\n" + trUser(userName, "reminder_hint"))
+		if err := sendTextToUser(builder.String(), userName); err != nil {
+			log.Println("发送提醒出错", err.Error())
+			continue
+		}
+		if err := repo.MarkReminded(ids, now); err != nil {
+			log.Println("记录提醒时间出错", err.Error())
+		}
+	}
+	log.Printf("提醒了%d个用户的%d条记录\n", len(users), len(records))
+}
+
+func archiveRecords(config ArchiveConfig, now time.Time) {
+	count, err := repo.ArchiveRecords(now.AddDate(0, 0, -config.AfterDays))
+	if err != nil {
+		log.Println("归档记录出错", err.Error())
+		return
+	}
+	log.Printf("归档了%d条记录\n", count)
+}
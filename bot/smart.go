@@ -0,0 +1,147 @@
+package bot
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/utils"
+)
+
+// 智能模式 从一句话中提取表单内容
+
+var (
+	lostKeywords  = []string{"丢了", "丢失", "遗失", "弄丢", "不见了", "找不到", "落在"}
+	foundKeywords = []string{"捡到", "捡了", "拾到", "拾获", "发现了", "有人落下"}
+	// 量词后面的内容一般为物品 如 一个黑色索尼耳机
+	itemRegexp = regexp.MustCompile(`(?:一|两|1|2)?(?:个|只|部|张|串|副|把|台|件|本|条|块|支|顶|双|枚|袋|瓶)([^，。,.!！？?\s]+)`)
+)
+
+// 根据关键词判断是丢失还是捡到了物品 无法判断时返回KindUnknown
+func extractType(msg string) conversation.RecordKind {
+	for _, keyword := range foundKeywords {
+		if strings.Contains(msg, keyword) {
+			return conversation.KindFound
+		}
+	}
+	for _, keyword := range lostKeywords {
+		if strings.Contains(msg, keyword) {
+			return conversation.KindLost
+		}
+	}
+	return conversation.KindUnknown
+}
+
+// 提取物品名称 优先取量词后面的内容,否则取最后一个名词
+func extractItemName(msg string, nameWords []string, location *utils.Location) string {
+	if match := itemRegexp.FindStringSubmatch(msg); match != nil {
+		return match[1]
+	}
+	for i := len(nameWords) - 1; i >= 0; i-- {
+		word := nameWords[i]
+		if location != nil && strings.Contains(location.Path(), word) {
+			continue
+		}
+		return word
+	}
+	return ""
+}
+
+// 从一句话中提取表单 未能识别的项目保持为空 时间为可选项
+func extractForm(msg string) (recordType conversation.RecordKind, form conversation.Form) {
+	defer utils.MetricTimeCost("智能提取")()
+	_, placeWords, nameWords := ParseMsg(msg)
+	recordType = extractType(msg)
+	var location *utils.Location
+	if matches := utils.MatchLocations(msg, append(placeWords, nameWords...)); len(matches) == 1 {
+		location = matches[0]
+		form.City = location.City()
+		form.Location = location.Path()
+	}
+	form.ItemName = extractItemName(msg, nameWords, location)
+	// 时间范围取开始时间 如 最近一周 取一周前 确认时会展示识别出的时间
+	if occurredAt, _, err := utils.ParseTimeRange(timeText(msg, location, form.ItemName), time.Now()); err == nil {
+		form.OccurredAt = occurredAt
+	}
+	form.Description = msg
+	log.Printf("智能提取 类型:%s 地点:%s 物品:%s\n", recordType, form.Location, form.ItemName)
+	return
+}
+
+// 去掉已识别为地点和物品的内容后再识别时间 避免 3号楼 1号线 等被当成日期
+func timeText(msg string, location *utils.Location, itemName string) string {
+	var words []string
+	if location != nil {
+		words = strings.Split(location.Path(), utils.LocationSeparator)
+	}
+	if itemName != "" {
+		words = append(words, itemName)
+	}
+	for _, word := range words {
+		msg = strings.ReplaceAll(msg, word, " ")
+	}
+	return msg
+}
+
+// 阶段9 智能模式 一句话登记,提取后直接进入最终确认,只询问缺失的项目
+// 捡到物品仍需填写取回地点和验证问题
+func stage9SmartConversation(ctx conversation.ConversationContext) (err error) {
+	content := strings.TrimSpace(ctx.ReceiveContent.Content)
+	switch ctx.Conversation.Status {
+	case "":
+		recordType, form := extractForm(content)
+		ctx.Conversation.Form = form
+		ctx.Conversation.Operation = "add"
+		generateFormTags(ctx)
+		if recordType == conversation.KindUnknown {
+			ctx.Conversation.Status = "waittype"
+			return sendMenuWithCtx(ctx, tr(ctx, "ask_smart_type"))
+		}
+		ctx.Conversation.Type = recordType
+		ctx.Conversation.Stage = 6
+		err = askForConfirm(ctx)
+	case "waittype":
+		switch content {
+		case "1", "丢失了物品":
+			ctx.Conversation.Type = conversation.KindLost
+		case "2", "捡到了物品":
+			ctx.Conversation.Type = conversation.KindFound
+		default:
+			return sendMenuWithCtx(ctx, tr(ctx, "ask_smart_type"))
+		}
+		ctx.Conversation.Status = ""
+		ctx.Conversation.Stage = 6
+		err = askForConfirm(ctx)
+	}
+	return
+}
+
+// 询问表单中缺失的必填项目,编辑状态下填写完成后会回到最终确认
+func askForMissing(ctx conversation.ConversationContext) (asked bool, err error) {
+	form := ctx.Conversation.Form
+	switch {
+	case form.Location == "":
+		ctx.Conversation.Stage = 2
+		if ctx.Conversation.Type == conversation.KindLost {
+			err = sendTextWithCtx(ctx, tr(ctx, "ask_lost_place"))
+		} else {
+			err = sendTextWithCtx(ctx, tr(ctx, "ask_found_place"))
+		}
+	case form.ItemName == "":
+		ctx.Conversation.Stage = 3
+		if ctx.Conversation.Type == conversation.KindLost {
+			err = sendTextWithCtx(ctx, tr(ctx, "ask_lost_item"))
+		} else {
+			err = sendTextWithCtx(ctx, tr(ctx, "ask_found_item"))
+		}
+	case ctx.Conversation.Type == conversation.KindFound && form.PickupLocation == "":
+		// 捡到物品按正常流程填写取回地点和验证问题 完成后回到最终确认
+		ctx.Conversation.Stage = 7
+		return true, sendTextWithCtx(ctx, pickupPrompt(ctx))
+	default:
+		return false, nil
+	}
+	ctx.Conversation.Edited = true
+	return true, err
+}
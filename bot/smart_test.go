@@ -0,0 +1,49 @@
+package bot
+
+import (
+	"testing"
+	"time"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/utils"
+)
+
+func TestExtractForm(t *testing.T) {
+	utils.SetLocations([]*utils.Location{
+		{Name: "杭州", Children: []*utils.Location{
+			{Name: "西溪园区", Children: []*utils.Location{{Name: "3号楼", Children: []*utils.Location{{Name: "会议室"}}}}},
+		}},
+		{Name: "北京"},
+	})
+	t.Cleanup(func() { utils.SetLocations(nil) })
+	now := time.Now()
+	tests := []struct {
+		msg      string
+		kind     conversation.RecordKind
+		location string
+		item     string
+		hasTime  bool
+	}{
+		{"在杭州西溪园区3号楼会议室丢了一副耳机", conversation.KindLost, "杭州/西溪园区/3号楼/会议室", "耳机", false},
+		{"3号楼会议室捡到一把黑色雨伞", conversation.KindFound, "杭州/西溪园区/3号楼/会议室", "黑色雨伞", false},
+		{"北京1号线地铁上丢了一个钱包", conversation.KindLost, "北京", "钱包", false},
+		{"昨天在3号楼会议室丢了一副耳机", conversation.KindLost, "杭州/西溪园区/3号楼/会议室", "耳机", true},
+		{"3号楼会议室捡到一台3号机", conversation.KindFound, "杭州/西溪园区/3号楼/会议室", "3号机", false},
+	}
+	for _, test := range tests {
+		kind, form := extractForm(test.msg)
+		if kind != test.kind {
+			t.Errorf("%s 类型应该为%s 实际为%s", test.msg, test.kind, kind)
+		}
+		if form.Location != test.location {
+			t.Errorf("%s 地点应该为%s 实际为%s", test.msg, test.location, form.Location)
+		}
+		if form.ItemName != test.item {
+			t.Errorf("%s 物品应该为%s 实际为%s", test.msg, test.item, form.ItemName)
+		}
+		if hasTime := !form.OccurredAt.IsZero(); hasTime != test.hasTime {
+			t.Errorf("%s 识别出时间应该为%v 实际为%v", test.msg, test.hasTime, form.OccurredAt)
+		} else if hasTime && (form.OccurredAt.After(now) || now.Sub(form.OccurredAt) > 48*time.Hour) {
+			t.Errorf("%s 时间应该为昨天 实际为%v", test.msg, form.OccurredAt)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package bot
+
+import (
+	"errors"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/dao"
+	"wxbot-lostandfound/handler"
+	"wxbot-lostandfound/i18n"
+	"wxbot-lostandfound/utils"
+)
+
+// 记录状态命令 查看状态历史以及变更状态
+
+var (
+	completeRegexp = regexp.MustCompile(`(?i)^(?:完成|close)\s*(\d+)$`)
+	statusRegexp   = regexp.MustCompile(`(?i)^(?:状态|status)\s*(\d+)(?:\s+(.+))?$`)
+)
+
+// 用户对记录的角色 用于判断可以进行的状态变更
+func recordRole(record dao.ItemRecord, userName string) dao.Role {
+	switch {
+	case isAdmin(userName):
+		return dao.RoleAdmin
+	case record.User == userName:
+		return dao.RoleOwner
+	case repo.IsClaimVerified(record.Id, userName):
+		// 只有通过验证的认领人可以变更状态 其他用户不能修改他人的记录
+		return dao.RoleClaimant
+	default:
+		return dao.RoleNone
+	}
+}
+
+// 根据状态代码或任意语言的状态名称查找状态
+func parseStatus(name string) (dao.RecordStatus, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, status := range dao.Statuses {
+		if name == string(status) {
+			return status, true
+		}
+		for _, lang := range i18n.Languages() {
+			if name == strings.ToLower(handler.StatusName(status, lang)) {
+				return status, true
+			}
+		}
+	}
+	return "", false
+}
+
+func statusNames(statuses []dao.RecordStatus, lang string) string {
+	names := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		names = append(names, handler.StatusName(status, lang))
+	}
+	return strings.Join(names, ",")
+}
+
+// 完成命令 如 完成 12, 等同于 状态 12 已完成
+func completeCommand(ctx conversation.ConversationContext) (handled bool, err error) {
+	match := completeRegexp.FindStringSubmatch(strings.TrimSpace(ctx.ReceiveContent.Content))
+	if match == nil {
+		return false, nil
+	}
+	id, _ := strconv.ParseInt(match[1], 10, 64)
+	return true, changeStatus(ctx, id, dao.StatusCompleted)
+}
+
+// 状态命令 如 状态 12 查看记录状态, 状态 12 已撤回 变更记录状态
+func statusCommand(ctx conversation.ConversationContext) (handled bool, err error) {
+	match := statusRegexp.FindStringSubmatch(strings.TrimSpace(ctx.ReceiveContent.Content))
+	if match == nil {
+		return false, nil
+	}
+	id, _ := strconv.ParseInt(match[1], 10, 64)
+	if match[2] == "" {
+		return true, sendStatus(ctx, id)
+	}
+	status, ok := parseStatus(match[2])
+	if !ok {
+		lang := userLanguage(ctx.ReceiveContent.FromUsername)
+		return true, sendTextWithCtx(ctx, tr(ctx, "status_unknown", i18n.Data{"Name": match[2], "Statuses": statusNames(dao.Statuses, lang)}))
+	}
+	return true, changeStatus(ctx, id, status)
+}
+
+// 展示记录当前状态和可以变更到的状态 登记人和管理员可以看到变更历史
+func sendStatus(ctx conversation.ConversationContext, id int64) error {
+	userName := ctx.ReceiveContent.FromUsername
+	lang := userLanguage(userName)
+	record, err := repo.GetRecordById(id)
+	if err != nil {
+		return sendTextWithCtx(ctx, tr(ctx, "status_not_found", i18n.Data{"Id": id}))
+	}
+	role := recordRole(record, userName)
+	builder := strings.Builder{}
+	builder.WriteString(tr(ctx, "status_current", i18n.Data{"Id": id, "Status": handler.StatusName(record.Status, lang)}))
+	if role == dao.RoleOwner || role == dao.RoleAdmin {
+		for _, history := range repo.GetStatusHistory(id) {
+			builder.WriteString("\n" + tr(ctx, "status_history_item", i18n.Data{
+				"Time":     utils.FormatTime(history.CreatedAt),
+				"From":     handler.StatusName(history.FromStatus, lang),
+				"To":       handler.StatusName(history.ToStatus, lang),
+				"Operator": history.Operator,
+				"Note":     history.Note,
+			}))
+		}
+	}
+	if next := dao.NextStatuses(record, role); len(next) > 0 {
+		builder.WriteString("\n" + tr(ctx, "status_next", i18n.Data{"Id": id, "Statuses": statusNames(next, lang)}))
+	}
+	return sendTextWithCtx(ctx, builder.String())
+}
+
+// 按用户的角色变更记录状态 由其他人变更时通知登记人
+func changeStatus(ctx conversation.ConversationContext, id int64, status dao.RecordStatus) error {
+	userName := ctx.ReceiveContent.FromUsername
+	lang := userLanguage(userName)
+	record, err := repo.GetRecordById(id)
+	if err != nil {
+		return sendTextWithCtx(ctx, tr(ctx, "status_not_found", i18n.Data{"Id": id}))
+	}
+	from := record.Status
+	data := i18n.Data{"Id": id, "From": handler.StatusName(from, lang), "To": handler.StatusName(status, lang)}
+	record, err = repo.TransitionRecord(id, status, userName, recordRole(record, userName), "")
+	if errors.Is(err, dao.ErrInvalidTransition) {
+		return sendTextWithCtx(ctx, tr(ctx, "status_denied", data))
+	} else if err != nil {
+		log.Println("变更记录状态出错", err.Error())
+		return sendTextWithCtx(ctx, tr(ctx, "status_failed", data))
+	}
+	if record.User != userName {
+		notify := trUser(record.User, "status_notify", i18n.Data{
+			"Id":       id,
+			"ItemName": record.ItemName,
+			"User":     userName,
+			"Status":   handler.StatusName(status, userLanguage(record.User)),
+		})
+		if notifyErr := sendTextToUser(notify, record.User); notifyErr != nil {
+			log.Println("通知登记人出错", notifyErr.Error())
+		}
+	}
+	return sendTextWithCtx(ctx, tr(ctx, "status_changed", data))
+}
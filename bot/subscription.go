@@ -0,0 +1,189 @@
+package bot
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/dao"
+	"wxbot-lostandfound/handler"
+	"wxbot-lostandfound/i18n"
+	"wxbot-lostandfound/utils"
+)
+
+// 订阅 登记丢失物品后自动订阅,也可以通过命令手动订阅关键词
+// 订阅 耳机 黑色 杭州 -> 订阅关键词 耳机,黑色 城市 杭州
+// 订阅 / 我的订阅 -> 查看订阅
+// 取消订阅 3 -> 取消ID为3的订阅
+
+var (
+	subscribeRegexp   = regexp.MustCompile(`(?i)^(?:订阅|subscribe)(?:\s+(.+))?$`)
+	listRegexp        = regexp.MustCompile(`(?i)^(?:我的订阅|subscriptions)$`)
+	unsubscribeRegexp = regexp.MustCompile(`(?i)^(?:取消订阅|unsubscribe)\s*(\d+)$`)
+)
+
+func subscriptionCommand(ctx conversation.ConversationContext) (handled bool, err error) {
+	content := strings.TrimSpace(ctx.ReceiveContent.Content)
+	userName := ctx.ReceiveContent.FromUsername
+	if match := unsubscribeRegexp.FindStringSubmatch(content); match != nil {
+		id, _ := strconv.ParseInt(match[1], 10, 64)
+		deleteErr := repo.DeleteSubscription(id, userName)
+		switch {
+		case deleteErr == nil:
+			err = sendTextWithCtx(ctx, tr(ctx, "subscription_cancelled", i18n.Data{"Id": id}))
+		case errors.Is(deleteErr, gorm.ErrRecordNotFound):
+			err = sendTextWithCtx(ctx, tr(ctx, "subscription_not_found"))
+		default:
+			log.Println("取消订阅出错", deleteErr.Error())
+			err = sendTextWithCtx(ctx, tr(ctx, "subscription_not_found"))
+		}
+		return true, err
+	}
+	if listRegexp.MatchString(content) {
+		return true, sendSubscriptions(userName)
+	}
+	match := subscribeRegexp.FindStringSubmatch(content)
+	if match == nil {
+		return false, nil
+	}
+	if match[1] == "" {
+		return true, sendSubscriptions(userName)
+	}
+	keywords, city := parseSubscription(match[1])
+	if len(keywords) == 0 {
+		return true, sendTextWithCtx(ctx, tr(ctx, "subscription_no_keywords"))
+	}
+	subscription := &dao.Subscription{
+		User:      userName,
+		Keywords:  strings.Join(keywords, ","),
+		City:      city,
+		ExpiresAt: time.Now().AddDate(0, 0, subscriptionDays()),
+	}
+	if addErr := repo.AddSubscription(subscription); addErr != nil {
+		log.Println("添加订阅出错", addErr.Error())
+		return true, sendTextWithCtx(ctx, tr(ctx, "general_invalid"))
+	}
+	return true, sendTextWithCtx(ctx, tr(ctx, "subscription_created", subscriptionData(*subscription)))
+}
+
+// 拆分订阅内容 城市名作为城市,其余作为关键词
+func parseSubscription(text string) (keywords []string, city string) {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ' ' || r == ',' || r == '，' || r == '、'
+	})
+	for _, word := range words {
+		if city == "" && utils.IfWordInSlice(word, utils.Cities()) {
+			city = word
+			continue
+		}
+		word = strings.ToLower(word)
+		if !utils.IfWordInSlice(word, keywords) {
+			keywords = append(keywords, word)
+		}
+	}
+	return
+}
+
+func subscriptionDays() int {
+	if botConfig.SubscriptionDays > 0 {
+		return botConfig.SubscriptionDays
+	}
+	return 30
+}
+
+func subscriptionData(subscription dao.Subscription) i18n.Data {
+	return i18n.Data{
+		"Id":        subscription.Id,
+		"Keywords":  subscription.Keywords,
+		"City":      subscription.City,
+		"ExpiresAt": subscription.ExpiresAt.Format("2006-01-02"),
+	}
+}
+
+// 列出用户的订阅
+func sendSubscriptions(userName string) error {
+	subscriptions := repo.GetSubscriptions(userName, time.Now())
+	if len(subscriptions) == 0 {
+		return sendTextToUser(trUser(userName, "subscription_list_empty"), userName)
+	}
+	builder := strings.Builder{}
+	builder.WriteString(trUser(userName, "subscription_list_title"))
+	for _, subscription := range subscriptions {
+		builder.WriteString("\n" + trUser(userName, "subscription_item", subscriptionData(subscription)))
+	}
+	builder.WriteString("\n" + trUser(userName, "subscription_list_hint"))
+	return sendTextToUser(builder.String(), userName)
+}
+
+// 记录添加后的处理 推送到群聊,丢失物品自动订阅,捡到物品通知匹配的订阅人
+func onRecordAdded(ctx conversation.ConversationContext, record dao.ItemRecord) {
+	broadcastRecord(record)
+	switch record.Type {
+	case conversation.KindLost:
+		keywords := itemKeywords(record)
+		if len(keywords) == 0 {
+			return
+		}
+		subscription := &dao.Subscription{
+			User:      record.User,
+			Keywords:  strings.Join(keywords, ","),
+			City:      record.City,
+			ItemId:    record.Id,
+			ExpiresAt: time.Now().AddDate(0, 0, subscriptionDays()),
+		}
+		if err := repo.AddSubscription(subscription); err != nil {
+			log.Println("自动订阅出错", err.Error())
+			return
+		}
+		sendTextWithCtx(ctx, tr(ctx, "subscription_auto_created", subscriptionData(*subscription)))
+	case conversation.KindFound:
+		notifySubscribers(record)
+	}
+}
+
+// 自动订阅的关键词 只使用物品名称及其中的名词
+// 记录的标签包含城市、地点和描述中的普通名词,会匹配到同城的所有记录
+func itemKeywords(record dao.ItemRecord) (keywords []string) {
+	itemName := strings.ToLower(strings.TrimSpace(record.ItemName))
+	if itemName == "" {
+		return
+	}
+	places := append(strings.Split(record.Location, utils.LocationSeparator), record.City)
+	keywords = append(keywords, itemName)
+	for _, tag := range GenerateTags(record.ItemName) {
+		tag = strings.ToLower(tag)
+		if utils.IfWordInSlice(tag, keywords) || utils.IfWordInSlice(tag, places) || utils.IfWordInSlice(tag, utils.Cities()) {
+			continue
+		}
+		keywords = append(keywords, tag)
+	}
+	return
+}
+
+// 通知与捡到物品匹配的订阅人 每个订阅人只通知一次
+func notifySubscribers(record dao.ItemRecord) {
+	now := time.Now()
+	repo.DeleteExpiredSubscriptions(now)
+	notified := map[string]struct{}{}
+	for _, subscription := range repo.MatchSubscriptions(record, now) {
+		userName := subscription.User
+		if _, exist := notified[userName]; exist {
+			continue
+		}
+		notified[userName] = struct{}{}
+		lang := userLanguage(userName)
+		data := subscriptionData(subscription)
+		data["RecordId"] = record.Id
+		data["DetailUrl"] = handler.RecordDetailUrl(record.Id, lang)
+		if err := sendTextToUser(trUser(userName, "subscription_matched", data), userName); err != nil {
+			log.Println("发送订阅通知出错", err.Error())
+			continue
+		}
+		sendRecordsToUser([]dao.ItemRecord{record}, handler.Viewer{UserName: userName, IsAdmin: isAdmin(userName), Language: lang}, userName)
+	}
+	log.Printf("记录%d通知了%d个订阅人\n", record.Id, len(notified))
+}
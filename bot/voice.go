@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/i18n"
+	"wxbot-lostandfound/speech"
+	"wxbot-lostandfound/utils"
+)
+
+var transcriber speech.Transcriber
+
+// 通过MediaId下载临时素材 保存到voices文件夹
+func downloadMedia(mediaId string) (filePath string, err error) {
+	resp, err := http.Get(fmt.Sprintf("%s/cgi-bin/media/get?access_token=%s&media_id=%s", apiBaseUrl, botConfig.AccessToken, mediaId))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	// 出错时返回的是json
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		body, _ := ioutil.ReadAll(resp.Body)
+		getAccessToken()
+		return "", errors.New("下载素材失败:" + string(body))
+	}
+	if err = os.MkdirAll("voices", 0755); err != nil {
+		return
+	}
+	filePath = filepath.Join("voices", mediaId+".amr")
+	out, err := os.Create(filePath)
+	if err != nil {
+		return
+	}
+	defer out.Close()
+	_, err = io.Copy(out, resp.Body)
+	return
+}
+
+// 下载语音并识别为文字 识别完成后删除下载和转换的文件
+func transcribeVoice(mediaId string) (text string, err error) {
+	amrPath, err := downloadMedia(mediaId)
+	if amrPath != "" {
+		defer os.Remove(amrPath)
+	}
+	if err != nil {
+		return
+	}
+	wavPath, err := speech.ConvertAmrToWav(botConfig.Speech.Ffmpeg, amrPath)
+	defer os.Remove(wavPath)
+	if err != nil {
+		return
+	}
+	return transcriber.Transcribe(wavPath)
+}
+
+// 被动回复已经发送后 会话中的被动回复直接丢弃
+type discardResponse struct{}
+
+func (discardResponse) Header() http.Header         { return http.Header{} }
+func (discardResponse) Write(b []byte) (int, error) { return len(b), nil }
+func (discardResponse) WriteHeader(int)             {}
+
+// 语音消息 识别可能超过被动回复的5秒限制,先回复再异步识别
+// 识别后回显识别结果,并作为文字输入继续会话
+func handleVoice(ctx conversation.ConversationContext, voiceContent *conversation.VoiceContent) error {
+	if err := replyTextWithCtx(ctx, ""); err != nil {
+		return err
+	}
+	// 消息结构会放回结构池 异步处理时需要复制
+	receiveContent := *ctx.ReceiveContent
+	ctx.ReceiveContent = &receiveContent
+	ctx.W = discardResponse{}
+	mediaId := voiceContent.MediaId
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("处理语音消息出错 %v\n", r)
+			}
+		}()
+		if err := continueWithVoice(ctx, mediaId); err != nil {
+			log.Println("处理语音消息出错", err.Error())
+		}
+	}()
+	return nil
+}
+
+func continueWithVoice(ctx conversation.ConversationContext, mediaId string) error {
+	text, err := transcribeVoice(mediaId)
+	if err != nil || text == "" {
+		if err != nil {
+			log.Println("语音识别出错", err.Error())
+		}
+		return sendTextWithCtx(ctx, tr(ctx, "voice_unrecognized"))
+	}
+	log.Println("语音识别结果", text)
+	return continueWithText(ctx, text)
+}
+
+// 以识别出的文字继续会话 识别在后台进行,需要和其他消息一样持有会话锁
+func continueWithText(ctx conversation.ConversationContext, text string) error {
+	ctx.ReceiveContent.Content = text
+	// 先回显识别结果 之后的每一步都需要确认,识别有误时可以选择no重新输入
+	utils.CheckError(sendTextWithCtx(ctx, tr(ctx, "voice_recognized", i18n.Data{"Text": text})), "回显语音识别结果")
+	conversationLock.Lock()
+	defer conversationLock.Unlock()
+	return startConversation(ctx)
+}
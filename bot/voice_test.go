@@ -0,0 +1,50 @@
+package bot
+
+import (
+	"sync"
+	"testing"
+	"wxbot-lostandfound/conversation"
+)
+
+// 语音识别后在后台继续会话 同时收到的其他消息不能同时修改会话 使用 go test -race 检查
+func TestVoiceConcurrentWithMessages(t *testing.T) {
+	b := newTestBot(t)
+	users := []string{"alice", "bob", "carol"}
+	var wait sync.WaitGroup
+	for i, user := range users {
+		wait.Add(2)
+		go func(i int, user string) {
+			defer wait.Done()
+			for j, content := range []string{"你好", "1", "2", "结束会话"} {
+				b.post(t, user, content, uint32(i*100+j+1))
+			}
+		}(i, user)
+		go func(user string) {
+			defer wait.Done()
+			for _, text := range []string{"你好", "4"} {
+				ctx := conversation.ConversationContext{
+					ReceiveContent: &conversation.MsgContent{FromUsername: user, ToUsername: "corp", MsgType: "voice"},
+					W:              discardResponse{},
+				}
+				if err := continueWithText(ctx, text); err != nil {
+					t.Error(err)
+				}
+			}
+		}(user)
+	}
+	wait.Wait()
+	for _, user := range users {
+		if !b.receivedText(user, "你好") {
+			t.Errorf("%s 应该收到语音识别结果 %q", user, b.received(user))
+		}
+	}
+	if len(acceptMap) != len(users)*4 {
+		t.Errorf("应该记录%d条消息 实际为%d", len(users)*4, len(acceptMap))
+	}
+	// 重复推送的消息不再处理
+	before := len(b.received("alice"))
+	b.post(t, "alice", "你好", 1)
+	if after := len(b.received("alice")); after != before {
+		t.Errorf("重复的消息不应该处理 %q", b.received("alice")[before:])
+	}
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"wxbot-lostandfound/bot"
+	"wxbot-lostandfound/dao"
+)
+
+// broadcast [--users a,b|@all] [--parties 1,2] [--webhooks 群聊名称] 消息
+// 消息为markdown格式 使用--file时从文件读取
+func broadcast(repository *dao.GormRepository, args []string) error {
+	flagSet := newFlagSet("broadcast")
+	users := flagSet.String("users", "", "逗号分隔的用户名 @all为所有用户")
+	parties := flagSet.String("parties", "", "逗号分隔的部门ID")
+	webhooks := flagSet.String("webhooks", "", "逗号分隔的群聊名称 即配置中webhooks的name")
+	file := flagSet.String("file", "", "从文件读取消息")
+	values, err := parseArgs(flagSet, args, -1)
+	if err != nil {
+		return err
+	}
+	var content string
+	switch {
+	case *file != "" && len(values) == 0:
+		data, err := ioutil.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		content = string(data)
+	case *file == "" && len(values) == 1:
+		content = values[0]
+	default:
+		return fmt.Errorf("需要一条消息或者使用--file指定消息文件")
+	}
+	if strings.TrimSpace(content) == "" {
+		return fmt.Errorf("消息不能为空")
+	}
+	userList, partyList, webhookList := splitList(*users), splitList(*parties), splitList(*webhooks)
+	if len(userList) == 0 && len(partyList) == 0 && len(webhookList) == 0 {
+		return fmt.Errorf("需要指定--users --parties或--webhooks")
+	}
+	if err := bot.Broadcast(content, userList, partyList, webhookList); err != nil {
+		return err
+	}
+	fmt.Fprintln(output, "发送成功")
+	return nil
+}
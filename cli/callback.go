@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"wxbot-lostandfound/bot"
+	"wxbot-lostandfound/dao"
+	"wxbot-lostandfound/wxbizmsgcrypt"
+)
+
+// 企业微信推送的文本消息 加密前的内容
+type callbackMessage struct {
+	XMLName      xml.Name            `xml:"xml"`
+	ToUserName   wxbizmsgcrypt.CDATA `xml:"ToUserName"`
+	FromUserName wxbizmsgcrypt.CDATA `xml:"FromUserName"`
+	CreateTime   uint32              `xml:"CreateTime"`
+	MsgType      wxbizmsgcrypt.CDATA `xml:"MsgType"`
+	Content      wxbizmsgcrypt.CDATA `xml:"Content"`
+	MsgId        string              `xml:"MsgId"`
+	AgentID      int                 `xml:"AgentID"`
+}
+
+// verify-callback [--user 用户名] [--content 消息] [--url 回调地址]
+// 使用配置中的Token和EncodingAesKey加密一条文本消息并输出签名参数,指定url时发送到回调地址并解密回复
+func verifyCallback(repository *dao.GormRepository, args []string) error {
+	flagSet := newFlagSet("verify-callback")
+	user := flagSet.String("user", "test", "发送消息的用户名")
+	content := flagSet.String("content", "help", "消息内容")
+	callbackUrl := flagSet.String("url", "", "回调地址 如 http://127.0.0.1:8888/api/bot/message")
+	if _, err := parseArgs(flagSet, args, 0); err != nil {
+		return err
+	}
+	config := bot.GetBotConfig()
+	wxcrypt := wxbizmsgcrypt.NewWXBizMsgCrypt(config.Token, config.EncodingAesKey, config.CorpId, wxbizmsgcrypt.XmlType)
+	now := time.Now()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	nonce := strconv.FormatInt(rand.New(rand.NewSource(now.UnixNano())).Int63(), 36)
+	plaintext, err := xml.Marshal(callbackMessage{
+		ToUserName:   wxbizmsgcrypt.CDATA{Value: config.CorpId},
+		FromUserName: wxbizmsgcrypt.CDATA{Value: *user},
+		// 服务端按CreateTime去除重复消息
+		CreateTime: uint32(now.Unix()),
+		MsgType:    wxbizmsgcrypt.CDATA{Value: "text"},
+		Content:    wxbizmsgcrypt.CDATA{Value: *content},
+		MsgId:      strconv.FormatInt(now.UnixNano(), 10),
+		AgentID:    config.AgentId,
+	})
+	if err != nil {
+		return err
+	}
+	body, cryptErr := wxcrypt.EncryptMsg(string(plaintext), timestamp, nonce)
+	if cryptErr != nil {
+		return errors.New("加密消息出错 " + cryptErr.ErrMsg)
+	}
+	var encrypted wxbizmsgcrypt.WXBizMsg4Send
+	if err := xml.Unmarshal(body, &encrypted); err != nil {
+		return err
+	}
+	signature := encrypted.Signature.Value
+	// 先在本地解密 确认配置的密钥可用
+	if _, cryptErr := wxcrypt.DecryptMsg(signature, timestamp, nonce, body); cryptErr != nil {
+		return errors.New("解密测试消息出错 " + cryptErr.ErrMsg)
+	}
+	query := url.Values{"msg_signature": {signature}, "timestamp": {timestamp}, "nonce": {nonce}}
+	fmt.Fprintf(output, "msg_signature=%s\ntimestamp=%s\nnonce=%s\nquery=%s\n\n%s\n", signature, timestamp, nonce, query.Encode(), body)
+	if *callbackUrl == "" {
+		return nil
+	}
+	resp, err := http.Post(*callbackUrl+"?"+query.Encode(), "text/xml", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	reply, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(output, "\n回调地址返回 %s\n", resp.Status)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("回调地址返回%d", resp.StatusCode)
+	}
+	if len(reply) == 0 {
+		return nil
+	}
+	// 被动回复同样是加密的
+	var encryptedReply wxbizmsgcrypt.WXBizMsg4Send
+	if err := xml.Unmarshal(reply, &encryptedReply); err != nil {
+		return fmt.Errorf("无法解析回复 %s", reply)
+	}
+	replyText, cryptErr := wxcrypt.DecryptMsg(encryptedReply.Signature.Value, encryptedReply.Timestamp, encryptedReply.Nonce.Value, reply)
+	if cryptErr != nil {
+		return errors.New("解密回复出错 " + cryptErr.ErrMsg)
+	}
+	fmt.Fprintf(output, "%s\n", replyText)
+	return nil
+}
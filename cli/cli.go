@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"wxbot-lostandfound/bot"
+	"wxbot-lostandfound/dao"
+)
+
+// 命令行管理工具 与服务使用相同的配置和数据库,服务运行时也可以执行
+// 每个命令只通过repository读写数据库,服务端每次处理消息时都会重新查询
+
+// 命令行中进行操作的用户 记录在状态历史和历史版本中
+const operator = "cli"
+
+// 输出位置 便于替换
+var output io.Writer = os.Stdout
+
+type command struct {
+	name  string
+	usage string
+	run   func(repository *dao.GormRepository, args []string) error
+}
+
+var commands []command
+
+func init() {
+	// 在init中赋值 help命令需要引用commands
+	commands = []command{
+		{"serve", "启动机器人服务 (默认)", serve},
+		{"createmenu", "创建应用的自定义菜单", createMenu},
+		{"migrate", "status|up [版本]|down [数量] 查看、执行或回退数据库迁移", migrate},
+		{"records", "list|show|close|delete 查询和管理记录", records},
+		{"tags", "list|merge|rename 管理标签", tags},
+		{"users", "ban|unban 禁用或解禁用户", users},
+		{"broadcast", "向用户、部门或群聊发送通知", broadcast},
+		{"export", "导出记录 支持csv jsonl xlsx", export},
+		{"import", "从csv jsonl xlsx文件导入记录", importRecords},
+		{"verify-callback", "生成加密的测试消息 可直接发送到回调地址", verifyCallback},
+		{"help", "查看可用的命令", help},
+	}
+}
+
+// 执行命令 没有参数时启动服务
+func Run(args []string, repository *dao.GormRepository) error {
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	for _, c := range commands {
+		if c.name == name {
+			return c.run(repository, args)
+		}
+	}
+	return fmt.Errorf("未知的命令%s 使用help查看可用的命令", name)
+}
+
+func serve(repository *dao.GormRepository, args []string) error {
+	if _, err := repository.MigrateUp(0); err != nil {
+		return err
+	}
+	bot.Start(repository)
+	return nil
+}
+
+func createMenu(repository *dao.GormRepository, args []string) error {
+	return bot.CreateMenu()
+}
+
+func help(repository *dao.GormRepository, args []string) error {
+	writer := newTable()
+	for _, c := range commands {
+		fmt.Fprintf(writer, "%s\t%s\n", c.name, c.usage)
+	}
+	return writer.Flush()
+}
+
+// 执行子命令 如 records list
+func runSubcommand(group string, subcommands map[string]func(args []string) error, args []string) error {
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(args) == 0 {
+		return fmt.Errorf("%s需要子命令: %s", group, strings.Join(names, " "))
+	}
+	run, exist := subcommands[args[0]]
+	if !exist {
+		return fmt.Errorf("未知的命令%s %s 可用的命令: %s", group, args[0], strings.Join(names, " "))
+	}
+	return run(args[1:])
+}
+
+// 出错时不打印用法 由调用方返回错误
+func newFlagSet(name string) *flag.FlagSet {
+	flagSet := flag.NewFlagSet(name, flag.ContinueOnError)
+	flagSet.SetOutput(output)
+	return flagSet
+}
+
+// 解析参数和位置参数 位置参数可以写在选项前面 如 close 12 --note 已取回
+// positional为位置参数的数量 小于0时不检查
+func parseArgs(flagSet *flag.FlagSet, args []string, positional int) ([]string, error) {
+	var values []string
+	for len(args) > 0 && (positional < 0 || len(values) < positional) && !strings.HasPrefix(args[0], "-") {
+		values, args = append(values, args[0]), args[1:]
+	}
+	if err := flagSet.Parse(args); err != nil {
+		return nil, err
+	}
+	values = append(values, flagSet.Args()...)
+	if positional >= 0 && len(values) != positional {
+		return nil, fmt.Errorf("%s需要%d个参数", flagSet.Name(), positional)
+	}
+	return values, nil
+}
+
+func parseId(text string) (int64, error) {
+	id, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("无效的记录ID%s", text)
+	}
+	return id, nil
+}
+
+// 逗号分隔的列表 忽略空白项
+func splitList(text string) (items []string) {
+	for _, item := range strings.Split(text, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return
+}
+
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+}
+
+// 日期参数 为空时不筛选
+func parseDate(text string) (time.Time, error) {
+	if text == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", text, time.Local)
+	if err != nil {
+		return t, fmt.Errorf("无效的日期%s 格式为2006-01-02", text)
+	}
+	return t, nil
+}
+
+// 时间为空时显示 -
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04")
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/dao"
+	"wxbot-lostandfound/transfer"
+)
+
+// export [--output 文件] [--format csv|jsonl|xlsx] [--status open,completed] [--type lost|found] [--since 日期] [--until 日期]
+// 导出记录及其标签、状态历史和图片名称 没有指定格式时按文件扩展名确定,输出到标准输出时默认为jsonl
+func export(repository *dao.GormRepository, args []string) error {
+	flagSet := newFlagSet("export")
+	outputFile := flagSet.String("output", "", "输出文件 默认为标准输出")
+	formatName := flagSet.String("format", "", "csv jsonl xlsx")
+	statuses := flagSet.String("status", "", "逗号分隔的状态 默认导出所有状态")
+	kind := flagSet.String("type", "", "lost 或 found")
+	since := flagSet.String("since", "", "创建时间不早于该日期 如 2021-11-01")
+	until := flagSet.String("until", "", "创建时间早于该日期 如 2021-12-01")
+	if _, err := parseArgs(flagSet, args, 0); err != nil {
+		return err
+	}
+	format, err := exportFormat(*formatName, *outputFile)
+	if err != nil {
+		return err
+	}
+	filter := dao.RecordFilter{Statuses: dao.Statuses}
+	if *statuses != "" {
+		filter.Statuses = nil
+		for _, status := range splitList(*statuses) {
+			if !dao.RecordStatus(status).IsValid() {
+				return fmt.Errorf("无效的状态%s", status)
+			}
+			filter.Statuses = append(filter.Statuses, dao.RecordStatus(status))
+		}
+	}
+	if *kind != "" {
+		if filter.Type, err = conversation.ParseKind(*kind); err != nil {
+			return fmt.Errorf("无效的类型%s", *kind)
+		}
+	}
+	if filter.CreatedSince, err = parseDate(*since); err != nil {
+		return err
+	}
+	if filter.CreatedBefore, err = parseDate(*until); err != nil {
+		return err
+	}
+	var writer io.Writer = output
+	if *outputFile != "" {
+		file, err := os.Create(*outputFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+	records := repository.GetRecord(filter)
+	sort.Slice(records, func(i, j int) bool { return records[i].Id < records[j].Id })
+	exported := make([]transfer.Record, 0, len(records))
+	for _, record := range records {
+		exported = append(exported, transfer.NewRecord(record, repository.GetStatusHistory(record.Id)))
+	}
+	if err := transfer.Export(writer, format, exported); err != nil {
+		return err
+	}
+	if *outputFile != "" {
+		fmt.Fprintf(output, "导出了%d条记录\n", len(records))
+	}
+	return nil
+}
+
+func exportFormat(name string, path string) (transfer.Format, error) {
+	switch {
+	case name != "":
+		return transfer.ParseFormat(name)
+	case path != "":
+		return transfer.FormatOf(path)
+	}
+	return transfer.FormatJSONL, nil
+}
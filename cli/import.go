@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"wxbot-lostandfound/bot"
+	"wxbot-lostandfound/dao"
+	"wxbot-lostandfound/transfer"
+)
+
+// import 文件 [--format csv|jsonl|xlsx] [--user 用户名] [--dry-run]
+// 所有行检查通过后在同一个事务中导入 有错误时输出每一行的错误并且不导入任何记录
+func importRecords(repository *dao.GormRepository, args []string) error {
+	flagSet := newFlagSet("import")
+	formatName := flagSet.String("format", "", "csv jsonl xlsx 默认按文件扩展名确定")
+	user := flagSet.String("user", operator, "没有填写登记人时使用的用户名")
+	dryRun := flagSet.Bool("dry-run", false, "只检查文件 不导入")
+	values, err := parseArgs(flagSet, args, 1)
+	if err != nil {
+		return err
+	}
+	format, err := transfer.FormatOf(values[0])
+	if *formatName != "" {
+		format, err = transfer.ParseFormat(*formatName)
+	}
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(values[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	// 检查地点需要当前的地点层级
+	bot.LoadLocations(repository)
+	count, rowErrors, err := transfer.Import(repository, file, format, transfer.ImportOptions{
+		User:   *user,
+		Tagger: bot.GenerateTags,
+		DryRun: *dryRun,
+	})
+	if err != nil {
+		return err
+	}
+	if len(rowErrors) > 0 {
+		for _, rowError := range rowErrors {
+			fmt.Fprintln(output, rowError.Error())
+		}
+		return fmt.Errorf("%d行有错误 没有导入任何记录", len(rowErrors))
+	}
+	if *dryRun {
+		fmt.Fprintln(output, "检查通过")
+		return nil
+	}
+	fmt.Fprintf(output, "导入了%d条记录\n", count)
+	return nil
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"wxbot-lostandfound/dao"
+)
+
+// migrate status|up [版本]|down [数量]
+func migrate(repository *dao.GormRepository, args []string) error {
+	command, number := "status", 0
+	if len(args) > 0 {
+		command = args[0]
+	}
+	if len(args) > 1 {
+		var err error
+		if number, err = strconv.Atoi(args[1]); err != nil {
+			return fmt.Errorf("无效的数字%s", args[1])
+		}
+	}
+	switch command {
+	case "status":
+		states, err := repository.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			appliedAt := "未执行"
+			if state.AppliedAt != nil {
+				appliedAt = formatTime(state.AppliedAt)
+			}
+			fmt.Fprintf(output, "%3d %-40s %s\n", state.Version, state.Name, appliedAt)
+		}
+	case "up":
+		done, err := repository.MigrateUp(number)
+		fmt.Fprintf(output, "执行了%d个迁移\n", len(done))
+		return err
+	case "down":
+		// 默认回退一个迁移
+		if number == 0 {
+			number = 1
+		}
+		done, err := repository.MigrateDown(number)
+		fmt.Fprintf(output, "回退了%d个迁移\n", len(done))
+		return err
+	default:
+		return fmt.Errorf("未知的命令%s 可用的命令: status up down", command)
+	}
+	return nil
+}
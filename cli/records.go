@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/dao"
+)
+
+// records list|show|close|delete
+func records(repository *dao.GormRepository, args []string) error {
+	return runSubcommand("records", map[string]func(args []string) error{
+		"list":   func(args []string) error { return listRecords(repository, args) },
+		"show":   func(args []string) error { return showRecord(repository, args) },
+		"close":  func(args []string) error { return closeRecord(repository, args) },
+		"delete": func(args []string) error { return deleteRecord(repository, args) },
+	}, args)
+}
+
+// 按条件查询记录 按ID倒序输出
+func listRecords(repository *dao.GormRepository, args []string) error {
+	flagSet := newFlagSet("records list")
+	statuses := flagSet.String("status", "", "逗号分隔的状态 如 open,claimed 默认为已归档以外的状态")
+	kind := flagSet.String("type", "", "lost 或 found")
+	user := flagSet.String("user", "", "登记人")
+	keyword := flagSet.String("keyword", "", "关键词 匹配物品名称、描述和标签")
+	location := flagSet.String("location", "", "地点路径 包含下级地点")
+	limit := flagSet.Int("limit", 50, "最多输出的记录数 0为不限制")
+	if _, err := parseArgs(flagSet, args, 0); err != nil {
+		return err
+	}
+	filter := dao.RecordFilter{User: *user, Keyword: *keyword, Location: *location}
+	if *kind != "" {
+		var err error
+		if filter.Type, err = conversation.ParseKind(*kind); err != nil {
+			return fmt.Errorf("无效的类型%s", *kind)
+		}
+	}
+	for _, status := range splitList(*statuses) {
+		if !dao.RecordStatus(status).IsValid() {
+			return fmt.Errorf("无效的状态%s", status)
+		}
+		filter.Statuses = append(filter.Statuses, dao.RecordStatus(status))
+	}
+	records := repository.GetRecord(filter)
+	sort.Slice(records, func(i, j int) bool { return records[i].Id > records[j].Id })
+	if *limit > 0 && len(records) > *limit {
+		records = records[:*limit]
+	}
+	writer := newTable()
+	fmt.Fprintln(writer, "ID\t类型\t状态\t物品\t地点\t登记人\t创建时间")
+	for _, record := range records {
+		location := record.Location
+		if location == "" {
+			location = record.City
+		}
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", record.Id, record.Type, record.Status,
+			record.ItemName, location, record.User, formatTime(&record.CreatedAt))
+	}
+	return writer.Flush()
+}
+
+// 记录详情 包括状态历史、流转记录和历史版本
+func showRecord(repository *dao.GormRepository, args []string) error {
+	values, err := parseArgs(newFlagSet("records show"), args, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseId(values[0])
+	if err != nil {
+		return err
+	}
+	record, err := repository.GetRecordById(id)
+	if err != nil {
+		return fmt.Errorf("查询记录%d出错 %s", id, err.Error())
+	}
+	writer := newTable()
+	for _, field := range [][2]string{
+		{"ID", fmt.Sprint(record.Id)},
+		{"类型", record.Type.String()},
+		{"状态", string(record.Status)},
+		{"物品", record.ItemName},
+		{"描述", record.Description},
+		{"标签", record.Tags},
+		{"城市", record.City},
+		{"地点", record.Location},
+		{"取回地点", record.PickupLocation},
+		{"敏感", fmt.Sprint(record.Sensitive)},
+		{"验证问题", record.VerifyQuestion},
+		{"验证答案", record.VerifyAnswer},
+		{"图片", record.ImgName},
+		{"登记人", record.User},
+		{"完成人", record.CompleteUser},
+		{"时间", formatTime(record.OccurredAt)},
+		{"创建时间", formatTime(&record.CreatedAt)},
+	} {
+		fmt.Fprintf(writer, "%s\t%s\n", field[0], field[1])
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if histories := repository.GetStatusHistory(id); len(histories) > 0 {
+		fmt.Fprintln(output, "\n状态历史")
+		writer = newTable()
+		for _, history := range histories {
+			fmt.Fprintf(writer, "%s\t%s -> %s\t%s(%s)\t%s\n", formatTime(&history.CreatedAt), history.FromStatus, history.ToStatus,
+				history.Operator, history.Role, history.Note)
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+	if custodyRecords := repository.GetCustodyRecords(id); len(custodyRecords) > 0 {
+		fmt.Fprintln(output, "\n流转记录")
+		writer = newTable()
+		for _, custody := range custodyRecords {
+			fmt.Fprintf(writer, "%s\t%s -> %s\t%s\t%s\n", formatTime(&custody.CreatedAt), custody.FromLocation, custody.ToLocation,
+				custody.Operator, custody.Note)
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+	if revisions := repository.GetRevisions(id); len(revisions) > 0 {
+		fmt.Fprintln(output, "\n历史版本")
+		writer = newTable()
+		for _, revision := range revisions {
+			fmt.Fprintf(writer, "%d\t%s\t%s\t%s\n", revision.Version, formatTime(&revision.CreatedAt), revision.Action, revision.Editor)
+		}
+		return writer.Flush()
+	}
+	return nil
+}
+
+// 以管理员身份将记录变更为已完成
+func closeRecord(repository *dao.GormRepository, args []string) error {
+	flagSet := newFlagSet("records close")
+	note := flagSet.String("note", "", "备注 记录在状态历史中")
+	values, err := parseArgs(flagSet, args, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseId(values[0])
+	if err != nil {
+		return err
+	}
+	record, err := repository.TransitionRecord(id, dao.StatusCompleted, operator, dao.RoleAdmin, *note)
+	if err != nil {
+		return fmt.Errorf("完成记录%d出错 %s", id, err.Error())
+	}
+	fmt.Fprintf(output, "记录%d已完成\n", record.Id)
+	return nil
+}
+
+// 软删除记录 可以在管理员会话中恢复
+func deleteRecord(repository *dao.GormRepository, args []string) error {
+	values, err := parseArgs(newFlagSet("records delete"), args, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseId(values[0])
+	if err != nil {
+		return err
+	}
+	if err := repository.DeleteRecord(id, operator); err != nil {
+		return fmt.Errorf("删除记录%d出错 %s", id, err.Error())
+	}
+	fmt.Fprintf(output, "记录%d已删除\n", id)
+	return nil
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"wxbot-lostandfound/dao"
+)
+
+// tags list|merge|rename
+func tags(repository *dao.GormRepository, args []string) error {
+	return runSubcommand("tags", map[string]func(args []string) error{
+		"list":   func(args []string) error { return listTags(repository, args) },
+		"merge":  func(args []string) error { return mergeTags(repository, args) },
+		"rename": func(args []string) error { return renameTag(repository, args) },
+	}, args)
+}
+
+func listTags(repository *dao.GormRepository, args []string) error {
+	if _, err := parseArgs(newFlagSet("tags list"), args, 0); err != nil {
+		return err
+	}
+	tags := repository.GetAllTag()
+	sort.Slice(tags, func(i, j int) bool { return tags[i].TagName < tags[j].TagName })
+	writer := newTable()
+	for _, tag := range tags {
+		fmt.Fprintf(writer, "%d\t%s\n", tag.Id, tag.TagName)
+	}
+	return writer.Flush()
+}
+
+// tags merge 手机,电话 手机 将多个标签合并为一个
+func mergeTags(repository *dao.GormRepository, args []string) error {
+	values, err := parseArgs(newFlagSet("tags merge"), args, 2)
+	if err != nil {
+		return err
+	}
+	sources := splitList(values[0])
+	if len(sources) == 0 {
+		return fmt.Errorf("没有需要合并的标签")
+	}
+	count, err := repository.MergeTags(sources, values[1])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(output, "已合并到标签%s 修改了%d条记录\n", values[1], count)
+	return nil
+}
+
+// tags rename 旧名称 新名称 新名称已存在时与其合并
+func renameTag(repository *dao.GormRepository, args []string) error {
+	values, err := parseArgs(newFlagSet("tags rename"), args, 2)
+	if err != nil {
+		return err
+	}
+	count, err := repository.MergeTags(values[:1], values[1])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(output, "标签%s已重命名为%s 修改了%d条记录\n", values[0], values[1], count)
+	return nil
+}
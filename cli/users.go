@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"fmt"
+	"wxbot-lostandfound/dao"
+)
+
+// users ban|unban 用户名
+func users(repository *dao.GormRepository, args []string) error {
+	return runSubcommand("users", map[string]func(args []string) error{
+		"ban":   func(args []string) error { return setBanned(repository, args, true) },
+		"unban": func(args []string) error { return setBanned(repository, args, false) },
+	}, args)
+}
+
+// 禁用后用户发送的下一条消息即不再处理 已有的记录不受影响
+func setBanned(repository *dao.GormRepository, args []string, banned bool) error {
+	name := "users unban"
+	if banned {
+		name = "users ban"
+	}
+	values, err := parseArgs(newFlagSet(name), args, 1)
+	if err != nil {
+		return err
+	}
+	if err := repository.SetBanned(values[0], banned); err != nil {
+		return err
+	}
+	if banned {
+		fmt.Fprintf(output, "已禁用用户%s\n", values[0])
+	} else {
+		fmt.Fprintf(output, "已解禁用户%s\n", values[0])
+	}
+	return nil
+}
@@ -10,19 +10,23 @@ type Conversation struct {
 	ConversationId int64
 	UserName       string
 	LastActive     time.Time
-	Stage          int64    // 表单阶段
-	Type           int64   //捡到东西或者是丢失东西   丢失物品-1 捡到东西-2
-	Operation      string // 采取的操作 如添加记录或者查看列表
+	Stage          int64      // 表单阶段
+	Type           RecordKind // 丢失物品、捡到物品或管理员会话
+	Operation      string     // 采取的操作 如添加记录或者查看列表
 	Form           Form
 	Status         string
-	Edited         bool //编辑状态 在最终确认时可以选择编辑某一阶段,编辑该阶段后直接跳转到最终确认，而不是下一阶段
+	Edited         bool     //编辑状态 在最终确认时可以选择编辑某一阶段,编辑该阶段后直接跳转到最终确认，而不是下一阶段
+	ClaimId        int64    // 正在认领的记录ID
+	PendingClaim   string   // 等待用户确认放弃当前登记后认领的记录ID
+	Candidates     []string // 等待用户选择的候选地点路径
+	TaskId         string   // 最近发送的模板卡片的任务id 收到其他输入后清空,只响应该卡片的点击
 }
 
 var (
-	MsgContentPool, ImgMsgContentPool, ReplyTextMsgPool, InitiativeTextMsgPool sync.Pool
+	MsgContentPool, ImgMsgContentPool, LocationMsgContentPool, VoiceMsgContentPool, ReplyTextMsgPool, InitiativeTextMsgPool sync.Pool
 )
 
-func init()  {
+func init() {
 	MsgContentPool = sync.Pool{
 		New: func() interface{} {
 			return new(MsgContent)
@@ -33,6 +37,16 @@ func init()  {
 			return new(ImgContent)
 		},
 	}
+	LocationMsgContentPool = sync.Pool{
+		New: func() interface{} {
+			return new(LocationContent)
+		},
+	}
+	VoiceMsgContentPool = sync.Pool{
+		New: func() interface{} {
+			return new(VoiceContent)
+		},
+	}
 	ReplyTextMsgPool = sync.Pool{
 		New: func() interface{} {
 			return new(ReplyTextMsg)
@@ -45,25 +59,33 @@ func init()  {
 	}
 }
 
-
-
 type Form struct {
-	Who         string
-	City        string   // 城市
-	ItemName    string   // 物品名词
-	ItemTags    []string // 标签，用于查找
-	ItemImg     string   // 物品图片链接
-	ItemImgName string
-	Description string // 完整描述
+	Who            string
+	City           string   // 城市
+	Location       string   // 地点完整路径 城市/园区/楼层/会议室
+	ItemName       string   // 物品名词
+	ItemTags       []string // 标签，用于查找
+	ItemImg        string   // 物品图片链接
+	ItemImgName    string
+	Description    string // 完整描述
+	Sensitive      bool   // 是否为敏感物品,根据标签自动判断,用户也可以手动切换
+	VerifyQuestion string // 验证问题 仅捡到物品时可以设置
+	VerifyAnswer   string
+	PickupLocation string    // 取回地点 仅捡到物品时需要填写
+	OccurredAt     time.Time // 丢失或捡到物品的时间 零值表示不清楚
+	Latitude       float64   // 用户发送的位置消息 没有发送时为0
+	Longitude      float64
+	LocationLabel  string
 }
 
 type ConversationContext struct {
-	ReceiveContent *MsgContent
-	ImgContent     *ImgContent
-	Conversation   *Conversation
-	W              http.ResponseWriter
-	Timestamp      string
-	Nonce          string
+	ReceiveContent  *MsgContent
+	ImgContent      *ImgContent
+	LocationContent *LocationContent
+	Conversation    *Conversation
+	W               http.ResponseWriter
+	Timestamp       string
+	Nonce           string
 }
 
 // 各类消息定义
@@ -81,8 +103,6 @@ type ReplyTextMsg struct {
 	Content      string `xml:"Content"`
 }
 
-
-
 type NewsMsg struct {
 	Touser  string `json:"touser"`
 	Toparty string `json:"toparty"`
@@ -90,18 +110,37 @@ type NewsMsg struct {
 	Msgtype string `json:"msgtype"`
 	Agentid int    `json:"agentid"`
 	News    struct {
-		Articles []struct {
-			Title       string `json:"title"`
-			Description string `json:"description"`
-			Url         string `json:"url"`
-			Picurl      string `json:"picurl"`
-		} `json:"articles"`
+		Articles []NewsArticle `json:"articles"`
 	} `json:"news"`
 	EnableIdTrans          int `json:"enable_id_trans"`
 	EnableDuplicateCheck   int `json:"enable_duplicate_check"`
 	DuplicateCheckInterval int `json:"duplicate_check_interval"`
 }
 
+type NewsArticle struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Url         string `json:"url"`
+	Picurl      string `json:"picurl"`
+}
+
+type TextCardMsg struct {
+	Touser   string `json:"touser"`
+	Toparty  string `json:"toparty"`
+	Totag    string `json:"totag"`
+	Msgtype  string `json:"msgtype"`
+	Agentid  int    `json:"agentid"`
+	TextCard struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Url         string `json:"url"`
+		Btntxt      string `json:"btntxt"`
+	} `json:"textcard"`
+	EnableIdTrans          int `json:"enable_id_trans"`
+	EnableDuplicateCheck   int `json:"enable_duplicate_check"`
+	DuplicateCheckInterval int `json:"duplicate_check_interval"`
+}
+
 type MarkDownMsg struct {
 	Touser   string `json:"touser"`
 	Toparty  string `json:"toparty"`
@@ -115,6 +154,30 @@ type MarkDownMsg struct {
 	DuplicateCheckInterval int `json:"duplicate_check_interval"`
 }
 
+// 按钮交互型模板卡片 点击按钮后以template_card_event事件推送到回调地址
+type TemplateCardMsg struct {
+	Touser       string `json:"touser"`
+	Msgtype      string `json:"msgtype"`
+	Agentid      int    `json:"agentid"`
+	TemplateCard struct {
+		CardType  string `json:"card_type"`
+		MainTitle struct {
+			Title string `json:"title"`
+			Desc  string `json:"desc,omitempty"`
+		} `json:"main_title"`
+		TaskId     string       `json:"task_id"`
+		ButtonList []CardButton `json:"button_list"`
+	} `json:"template_card"`
+	EnableIdTrans          int `json:"enable_id_trans"`
+	EnableDuplicateCheck   int `json:"enable_duplicate_check"`
+	DuplicateCheckInterval int `json:"duplicate_check_interval"`
+}
+
+type CardButton struct {
+	Text  string `json:"text"`
+	Style int    `json:"style"`
+	Key   string `json:"key"`
+}
 
 // 主动发送消息
 
@@ -149,8 +212,22 @@ type MsgContent struct {
 	Content      string `xml:"Content"`
 	Msgid        string `xml:"MsgId"`
 	Agentid      uint32 `xml:"AgentId"`
+	Event        string `xml:"Event"`    // 事件类型 MsgType为event时有效 如 enter_agent click view subscribe
+	EventKey     string `xml:"EventKey"` // 事件KEY值 click事件为自定义菜单的key view事件为跳转的url 模板卡片事件为按钮的key
+	TaskId       string `xml:"TaskId"`   // 模板卡片的任务id
+	CardType     string `xml:"CardType"`
 }
 
+// 事件类型
+const (
+	EventEnterAgent   = "enter_agent"
+	EventClick        = "click"
+	EventView         = "view"
+	EventSubscribe    = "subscribe"
+	EventUnsubscribe  = "unsubscribe"
+	EventTemplateCard = "template_card_event"
+)
+
 type ImgContent struct {
 	ToUsername   string `xml:"ToUserName"`
 	FromUsername string `xml:"FromUserName"`
@@ -161,3 +238,27 @@ type ImgContent struct {
 	Msgid        string `xml:"MsgId"`
 	Agentid      uint32 `xml:"AgentId"`
 }
+
+type LocationContent struct {
+	ToUsername   string  `xml:"ToUserName"`
+	FromUsername string  `xml:"FromUserName"`
+	CreateTime   uint32  `xml:"CreateTime"`
+	MsgType      string  `xml:"MsgType"`
+	LocationX    float64 `xml:"Location_X"` // 纬度
+	LocationY    float64 `xml:"Location_Y"` // 经度
+	Scale        int     `xml:"Scale"`
+	Label        string  `xml:"Label"`
+	Msgid        string  `xml:"MsgId"`
+	Agentid      uint32  `xml:"AgentId"`
+}
+
+type VoiceContent struct {
+	ToUsername   string `xml:"ToUserName"`
+	FromUsername string `xml:"FromUserName"`
+	CreateTime   uint32 `xml:"CreateTime"`
+	MsgType      string `xml:"MsgType"`
+	MediaId      string `xml:"MediaId"`
+	Format       string `xml:"Format"` // 语音格式 如amr
+	Msgid        string `xml:"MsgId"`
+	Agentid      uint32 `xml:"AgentId"`
+}
@@ -0,0 +1,68 @@
+package conversation
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"wxbot-lostandfound/i18n"
+)
+
+// 记录类型 会话和记录共用 管理员类型只用于会话,不能保存为记录
+type RecordKind int64
+
+const (
+	KindUnknown RecordKind = 0
+	KindLost    RecordKind = 1 // 丢失物品
+	KindFound   RecordKind = 2 // 捡到物品
+	KindAdmin   RecordKind = 3 // 管理员会话
+)
+
+var ErrInvalidKind = errors.New("无效的记录类型")
+
+// 是否为可以保存的记录类型
+func (k RecordKind) IsRecord() bool {
+	return k == KindLost || k == KindFound
+}
+
+// 相反的记录类型 丢失物品应该查找捡到物品的记录,反之亦然
+func (k RecordKind) Opposite() RecordKind {
+	switch k {
+	case KindLost:
+		return KindFound
+	case KindFound:
+		return KindLost
+	}
+	return KindUnknown
+}
+
+// 类型代码 用于配置和文案的键
+func (k RecordKind) String() string {
+	switch k {
+	case KindLost:
+		return "lost"
+	case KindFound:
+		return "found"
+	case KindAdmin:
+		return "admin"
+	}
+	return "unknown"
+}
+
+// 展示名称 如 丢失物品
+func (k RecordKind) DisplayName(lang string) string {
+	if !k.IsRecord() {
+		return ""
+	}
+	return i18n.T(lang, "kind_"+k.String())
+}
+
+// 解析类型代码或数字 只接受可以保存的记录类型
+func ParseKind(text string) (RecordKind, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	for _, kind := range []RecordKind{KindLost, KindFound} {
+		if text == kind.String() || text == strconv.FormatInt(int64(kind), 10) {
+			return kind, nil
+		}
+	}
+	return KindUnknown, ErrInvalidKind
+}
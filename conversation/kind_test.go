@@ -0,0 +1,88 @@
+package conversation
+
+import (
+	"testing"
+	"wxbot-lostandfound/i18n"
+)
+
+var allKinds = []RecordKind{KindUnknown, KindLost, KindFound, KindAdmin, RecordKind(9)}
+
+func TestIsRecord(t *testing.T) {
+	want := map[RecordKind]bool{KindLost: true, KindFound: true}
+	for _, kind := range allKinds {
+		if got := kind.IsRecord(); got != want[kind] {
+			t.Errorf("%d.IsRecord() = %v", kind, got)
+		}
+	}
+}
+
+func TestOpposite(t *testing.T) {
+	want := map[RecordKind]RecordKind{KindLost: KindFound, KindFound: KindLost}
+	for _, kind := range allKinds {
+		if got := kind.Opposite(); got != want[kind] {
+			t.Errorf("%d.Opposite() = %d", kind, got)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	want := map[RecordKind]string{KindUnknown: "unknown", KindLost: "lost", KindFound: "found", KindAdmin: "admin", RecordKind(9): "unknown"}
+	for _, kind := range allKinds {
+		if got := kind.String(); got != want[kind] {
+			t.Errorf("%d.String() = %s", kind, got)
+		}
+	}
+}
+
+func TestDisplayName(t *testing.T) {
+	if err := i18n.Load("../locales", "zh"); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		kind RecordKind
+		lang string
+		want string
+	}{
+		{KindLost, "zh", "丢失物品"},
+		{KindFound, "zh", "捡到物品"},
+		{KindLost, "en", "Lost item"},
+		{KindFound, "en", "Found item"},
+		// 不支持的语言使用默认语言
+		{KindFound, "fr", "捡到物品"},
+		// 不是记录的类型没有展示名称
+		{KindAdmin, "zh", ""},
+		{KindUnknown, "en", ""},
+	}
+	for _, c := range cases {
+		if got := c.kind.DisplayName(c.lang); got != c.want {
+			t.Errorf("%d.DisplayName(%s) = %s", c.kind, c.lang, got)
+		}
+	}
+}
+
+func TestParseKind(t *testing.T) {
+	cases := map[string]RecordKind{
+		"lost":    KindLost,
+		" Found ": KindFound,
+		"LOST":    KindLost,
+		"1":       KindLost,
+		"2":       KindFound,
+	}
+	for text, want := range cases {
+		if got, err := ParseKind(text); err != nil || got != want {
+			t.Errorf("ParseKind(%q) = %d, %v", text, got, err)
+		}
+	}
+	// 管理员等非记录类型不能解析
+	for _, text := range []string{"", "admin", "3", "0", "unknown", "丢失"} {
+		if got, err := ParseKind(text); err != ErrInvalidKind || got != KindUnknown {
+			t.Errorf("ParseKind(%q) = %d, %v", text, got, err)
+		}
+	}
+	// 与String互为逆操作
+	for _, kind := range []RecordKind{KindLost, KindFound} {
+		if got, _ := ParseKind(kind.String()); got != kind {
+			t.Errorf("ParseKind(%s) = %d", kind, got)
+		}
+	}
+}
@@ -1,117 +1,366 @@
 package dao
 
 import (
-	"errors"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"log"
 	"strings"
-	"sync"
+	"time"
 	"wxbot-lostandfound/conversation"
 	"wxbot-lostandfound/utils"
 )
 
-var (
-	db                                   *gorm.DB
-	itemRecordPool, tagPool, tagItemPool sync.Pool
-)
+// user在PostgreSQL中是保留字 原生SQL中需要由gorm加上引号
+var userColumn = clause.Column{Name: "user"}
 
-func init() {
-	var err error
-	db, err = gorm.Open(sqlite.Open("database.db"), &gorm.Config{})
-	utils.CheckError(err, "数据库连接")
-	err = db.AutoMigrate(&ItemRecord{}, &Tag{}, &TagItem{})
-	utils.CheckError(err, "数据库初始化")
-	itemRecordPool = sync.Pool{
-		New: func() interface{} {
-			return new(ItemRecord)
-		},
-	}
-	tagPool = sync.Pool{
-		New: func() interface{} {
-			return new(Tag)
-		},
-	}
-	tagItemPool = sync.Pool{
-		New: func() interface{} {
-			return new(TagItem)
-		},
-	}
-}
-
-func GetDB() *gorm.DB {
-	return db
-}
-
-func AddRecord(ctx conversation.ConversationContext) (err error) {
-	// 读取出标签进行储存
-	itemRecord := itemRecordPool.Get().(*ItemRecord)
-	defer itemRecordPool.Put(itemRecord)
-	itemRecord.User = ctx.ReceiveContent.FromUsername
-	itemRecord.ItemName = ctx.Conversation.Form.ItemName
-	itemRecord.Type = ctx.Conversation.Type
-	itemRecord.City = ctx.Conversation.Form.City
-	itemRecord.Status = "未完成"
-	itemRecord.Description = ctx.Conversation.Form.Description
-	itemRecord.ImgName = ctx.Conversation.Form.ItemImgName
-	// 记录TAG关系
-	itemRecord.Tags = strings.Join(ctx.Conversation.Form.ItemTags, ",")
-	db.Omit("Id").Create(itemRecord)
-	// 解析所有tag
-	// BUG sync.Pool和gorm共用出现异常
-	for _, tagName := range ctx.Conversation.Form.ItemTags {
-		tag := tagPool.Get().(*Tag)
-		tag.TagName = tagName
-		// 添加标签，如果存在就改为获取
-		err = db.Where(tag).First(tag).Error
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			// 新增标签
-			db.Omit("Id").Create(tag)
-		} else if err == nil {
-			// 已有标签
-		} else {
-			log.Println("创建标签出错", err.Error())
-			return
+// 添加记录 记录、标签和标签关联在同一个事务中创建 返回添加后的记录
+func (r *GormRepository) AddRecord(ctx conversation.ConversationContext) (record ItemRecord, err error) {
+	// 管理员会话等非记录类型不能保存
+	if !ctx.Conversation.Type.IsRecord() {
+		return record, conversation.ErrInvalidKind
+	}
+	form := ctx.Conversation.Form
+	tags := uniqueTags(form.ItemTags)
+	record = ItemRecord{
+		User:           ctx.ReceiveContent.FromUsername,
+		ItemName:       form.ItemName,
+		Type:           ctx.Conversation.Type,
+		City:           form.City,
+		Location:       form.Location,
+		Status:         StatusOpen,
+		Description:    form.Description,
+		ImgName:        form.ItemImgName,
+		Sensitive:      form.Sensitive,
+		VerifyQuestion: form.VerifyQuestion,
+		VerifyAnswer:   form.VerifyAnswer,
+		PickupLocation: form.PickupLocation,
+		Latitude:       form.Latitude,
+		Longitude:      form.Longitude,
+		LocationLabel:  form.LocationLabel,
+		Tags:           strings.Join(tags, ","),
+	}
+	if occurredAt := form.OccurredAt; !occurredAt.IsZero() {
+		record.OccurredAt = &occurredAt
+	}
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Id").Create(&record).Error; err != nil {
+			return err
 		}
-		// 添加 物品——标签关联关系
-		//tagItemRecord := tagItemPool.Get().(*TagItem)
-		tagItemRecord := &TagItem{
-			TagId:  tag.Id,
-			ItemId: itemRecord.Id,
-			Type:   ctx.Conversation.Type,
+		return linkTags(tx, record, tags)
+	})
+	if err != nil {
+		record = ItemRecord{}
+	}
+	return
+}
+
+// 添加 物品——标签关联关系 标签不存在时创建
+func linkTags(tx *gorm.DB, record ItemRecord, tags []string) error {
+	for _, tagName := range tags {
+		tag, err := upsertTag(tx, tagName)
+		if err != nil {
+			return err
+		}
+		if err := tx.Omit("Id").Create(&TagItem{TagId: tag.Id, ItemId: record.Id, Type: record.Type}).Error; err != nil {
+			return err
 		}
-		//tagItemRecord.ItemId = itemRecord.Id
-		//tagItemRecord.TagId = tag.Id
-		//tagItemRecord.Type = ctx.Conversation.Type
-		db.Omit("Id").Create(tagItemRecord)
-		tagItemRecord.Id = 0
-		tagItemPool.Put(tagItemRecord)
-		// 必须要手动清空 Pool 没有做任何“清空”的处理
-		tag.Id = 0
-		tagPool.Put(tag)
 	}
+	return nil
+}
+
+// 创建标签 已存在时返回已有的标签
+func upsertTag(tx *gorm.DB, tagName string) (tag Tag, err error) {
+	tag.TagName = tagName
+	result := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "tag_name"}}, DoNothing: true}).Omit("Id").Create(&tag)
+	if result.Error != nil || result.RowsAffected > 0 {
+		return tag, result.Error
+	}
+	err = tx.Where("tag_name = ?", tagName).First(&tag).Error
 	return
 }
 
+// 去除空白和重复的标签 保持原有顺序
+func uniqueTags(tags []string) (result []string) {
+	seen := map[string]struct{}{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if _, exist := seen[tag]; exist || tag == "" {
+			continue
+		}
+		seen[tag] = struct{}{}
+		result = append(result, tag)
+	}
+	return
+}
+
+// 记录查询条件 零值表示不进行筛选
+type RecordFilter struct {
+	Type     conversation.RecordKind
+	User     string         // 创建记录的用户
+	Statuses []RecordStatus // 为空时返回已归档以外的记录
+	Tags     []string
+	Keyword  string    // 关键词 多个关键词用空格分隔 匹配物品名称、描述或标签
+	Location string    // 地点路径 包含其下级地点 如 杭州/西溪园区
+	Since    time.Time // 丢失或捡到物品的时间范围 没有填写时间的记录使用创建时间
+	Until    time.Time
+	Near     *utils.GeoPoint // 只查找在该坐标一定范围内发送了位置的记录
+	RadiusKm float64
+	// 记录创建时间的范围 用于定时汇总
+	CreatedSince  time.Time
+	CreatedBefore time.Time
+}
+
 // 直接返回markdown列表
-func GetRecord(recordType int64, status string, tags []string) (records []ItemRecord) {
-	queryDB := db.Where(&ItemRecord{Type: recordType, Status: status})
-	if tags != nil {
-		for _, tag := range tags {
+func (r *GormRepository) GetRecord(filter RecordFilter) (records []ItemRecord) {
+	queryDB := r.db.Where(&ItemRecord{Type: filter.Type, User: filter.User})
+	if len(filter.Statuses) > 0 {
+		queryDB = queryDB.Where("status IN ?", filter.Statuses)
+	} else {
+		queryDB = queryDB.Where("status <> ?", StatusArchived)
+	}
+	if filter.Tags != nil {
+		for _, tag := range filter.Tags {
 			// 不考虑性能的实现...
-			log.Printf("模糊查找标签%s 类型:%d\n", tag, recordType)
+			log.Printf("模糊查找标签%s 类型:%s\n", tag, filter.Type)
 			queryDB = queryDB.Where("tags like ?", "%"+tag+"%")
 		}
 	}
+	for _, keyword := range strings.Fields(filter.Keyword) {
+		queryDB = r.search.match(queryDB, keyword)
+	}
+	if filter.Location != "" {
+		if strings.Contains(filter.Location, utils.LocationSeparator) {
+			queryDB = queryDB.Where("location = ? OR location LIKE ?", filter.Location, filter.Location+utils.LocationSeparator+"%")
+		} else {
+			// 按城市筛选时包含只填写了城市的旧记录
+			queryDB = queryDB.Where("location = ? OR location LIKE ? OR city = ?", filter.Location, filter.Location+utils.LocationSeparator+"%", filter.Location)
+		}
+	}
+	if !filter.Since.IsZero() {
+		queryDB = queryDB.Where("COALESCE(occurred_at, created_at) >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		queryDB = queryDB.Where("COALESCE(occurred_at, created_at) < ?", filter.Until)
+	}
+	if !filter.CreatedSince.IsZero() {
+		queryDB = queryDB.Where("created_at >= ?", filter.CreatedSince)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		queryDB = queryDB.Where("created_at < ?", filter.CreatedBefore)
+	}
+	if filter.Near != nil {
+		min, max := utils.BoundingBox(*filter.Near, filter.RadiusKm)
+		queryDB = queryDB.Where("latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?", min.Latitude, max.Latitude, min.Longitude, max.Longitude)
+	}
 	if err := queryDB.Find(&records).Error; err != nil {
 		log.Println("查询记录出错", err.Error())
 	}
+	if filter.Near != nil {
+		// 数据库中按经纬度范围初步筛选 这里再按实际距离筛选
+		nearRecords := records[:0]
+		for _, record := range records {
+			if utils.Distance(*filter.Near, utils.GeoPoint{Latitude: record.Latitude, Longitude: record.Longitude}) <= filter.RadiusKm {
+				nearRecords = append(nearRecords, record)
+			}
+		}
+		records = nearRecords
+	}
+	return
+}
+
+// 根据ID查找记录
+func (r *GormRepository) GetRecordById(id int64) (record ItemRecord, err error) {
+	err = r.db.First(&record, id).Error
+	return
+}
+
+// 需要登记人跟进的状态 存在争议的记录由管理员处理
+var staleStatuses = []RecordStatus{StatusOpen, StatusClaimed, StatusInCustody}
+
+// 创建时间早于before仍未完成 且在before之后没有提醒过的记录
+func (r *GormRepository) GetStaleRecords(before time.Time) (records []ItemRecord) {
+	if err := r.db.Where("status IN ? AND created_at < ? AND (reminded_at IS NULL OR reminded_at < ?)", staleStatuses, before, before).
+		Order(clause.OrderByColumn{Column: userColumn}).Order("id").Find(&records).Error; err != nil {
+		log.Println("查询未完成记录出错", err.Error())
+	}
+	return
+}
+
+// 记录已经提醒过登记人
+func (r *GormRepository) MarkReminded(ids []int64, now time.Time) error {
+	return r.db.Model(&ItemRecord{}).Where("id IN ?", ids).Update("reminded_at", now).Error
+}
+
+// 归档创建时间早于before的记录 返回归档的数量
+func (r *GormRepository) ArchiveRecords(before time.Time) (count int64, err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		var records []ItemRecord
+		if err := tx.Where("created_at < ? AND status <> ?", before, StatusArchived).Find(&records).Error; err != nil {
+			return err
+		}
+		for i := range records {
+			if err := transition(tx, &records[i], StatusArchived, "", RoleSystem, ""); err != nil {
+				return err
+			}
+		}
+		count = int64(len(records))
+		return nil
+	})
+	return
+}
+
+// 记录一次认领尝试
+func (r *GormRepository) AddClaimAttempt(attempt *ClaimAttempt) error {
+	return r.db.Omit("Id").Create(attempt).Error
+}
+
+// 用户对某条记录回答错误的次数
+func (r *GormRepository) CountFailedClaimAttempts(itemId int64, user string) (count int64) {
+	if err := r.db.Model(&ClaimAttempt{}).Where("item_id = ? AND ? = ? AND passed = ?", itemId, userColumn, user, false).Count(&count).Error; err != nil {
+		log.Println("查询认领记录出错", err.Error())
+	}
+	return
+}
+
+// 用户是否已经通过了某条记录的验证
+func (r *GormRepository) IsClaimVerified(itemId int64, user string) bool {
+	var count int64
+	if err := r.db.Model(&ClaimAttempt{}).Where("item_id = ? AND ? = ? AND passed = ?", itemId, userColumn, user, true).Count(&count).Error; err != nil {
+		log.Println("查询认领记录出错", err.Error())
+	}
+	return count > 0
+}
+
+// 登记物品移交 更新取回地点并记录流转 未完成的记录变更为已移交
+func (r *GormRepository) HandOverItem(itemId int64, toLocation string, operator string, note string) (record ItemRecord, err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&record, itemId).Error; err != nil {
+			return err
+		}
+		custody := &CustodyRecord{
+			ItemId:       itemId,
+			FromLocation: record.PickupLocation,
+			ToLocation:   toLocation,
+			Operator:     operator,
+			Note:         note,
+		}
+		if err := tx.Omit("Id").Create(custody).Error; err != nil {
+			return err
+		}
+		record.PickupLocation = toLocation
+		if err := tx.Model(&record).Update("pickup_location", toLocation).Error; err != nil {
+			return err
+		}
+		if CanTransition(record.Status, StatusInCustody, RoleAdmin) {
+			return transition(tx, &record, StatusInCustody, operator, RoleAdmin, toLocation)
+		}
+		return nil
+	})
+	return
+}
+
+// 查询物品的流转记录
+func (r *GormRepository) GetCustodyRecords(itemId int64) (custodyRecords []CustodyRecord) {
+	if err := r.db.Where("item_id = ?", itemId).Order("created_at").Find(&custodyRecords).Error; err != nil {
+		log.Println("查询流转记录出错", err.Error())
+	}
+	return
+}
+
+// 查询用户设置 没有设置过时返回空的设置
+func (r *GormRepository) GetUserSetting(userName string) (setting UserSetting) {
+	if err := r.db.Where("user_name = ?", userName).Limit(1).Find(&setting).Error; err != nil {
+		log.Println("查询用户设置出错", err.Error())
+	}
+	setting.UserName = userName
+	return
+}
+
+// 保存用户设置
+func (r *GormRepository) SaveUserSetting(setting *UserSetting) error {
+	return r.db.Save(setting).Error
+}
+
+// 禁用或解禁用户 保留用户的其他设置
+func (r *GormRepository) SetBanned(userName string, banned bool) error {
+	return r.updateUserSetting(UserSetting{UserName: userName, Banned: banned}, "banned")
+}
+
+// 设置用户语言 保留禁用状态等其他设置
+func (r *GormRepository) SetLanguage(userName string, lang string) error {
+	return r.updateUserSetting(UserSetting{UserName: userName, Language: lang}, "language")
+}
+
+// 只更新设置中的一列 用户没有设置时插入 并发修改不同的列时不会互相覆盖
+func (r *GormRepository) updateUserSetting(setting UserSetting, column string) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_name"}},
+		DoUpdates: clause.AssignmentColumns([]string{column, "updated_at"}),
+	}).Create(&setting).Error
+}
+
+// 添加订阅
+func (r *GormRepository) AddSubscription(subscription *Subscription) error {
+	return r.db.Omit("Id").Create(subscription).Error
+}
+
+// 用户未过期的订阅
+func (r *GormRepository) GetSubscriptions(user string, now time.Time) (subscriptions []Subscription) {
+	if err := r.db.Where("? = ? AND expires_at > ?", userColumn, user, now).Order("id").Find(&subscriptions).Error; err != nil {
+		log.Println("查询订阅出错", err.Error())
+	}
+	return
+}
+
+// 取消订阅 只能取消自己的订阅
+func (r *GormRepository) DeleteSubscription(id int64, user string) error {
+	result := r.db.Where("id = ? AND ? = ?", id, userColumn, user).Delete(&Subscription{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// 删除过期的订阅
+func (r *GormRepository) DeleteExpiredSubscriptions(now time.Time) {
+	if err := r.db.Where("expires_at <= ?", now).Delete(&Subscription{}).Error; err != nil {
+		log.Println("删除过期订阅出错", err.Error())
+	}
+}
+
+// 与记录匹配的订阅 城市相同(订阅不限城市时忽略)且关键词与记录的标签或物品名称有重合
+func (r *GormRepository) MatchSubscriptions(record ItemRecord, now time.Time) (matches []Subscription) {
+	var subscriptions []Subscription
+	if err := r.db.Where("expires_at > ? AND (city = '' OR city = ?) AND ? <> ?", now, record.City, userColumn, record.User).
+		Find(&subscriptions).Error; err != nil {
+		log.Println("查询订阅出错", err.Error())
+		return
+	}
+	tags := map[string]struct{}{}
+	for _, tag := range strings.Split(record.Tags, ",") {
+		tags[strings.ToLower(tag)] = struct{}{}
+	}
+	itemName := strings.ToLower(record.ItemName)
+	for _, subscription := range subscriptions {
+		for _, keyword := range strings.Split(subscription.Keywords, ",") {
+			if keyword == "" {
+				continue
+			}
+			if _, exist := tags[keyword]; exist || strings.Contains(itemName, keyword) {
+				matches = append(matches, subscription)
+				break
+			}
+		}
+	}
 	return
 }
 
 // TODO 给tag加一个TYPE字段
-func GetAllTag() (tags []Tag) {
-	if err := db.Find(&tags).Error; err != nil {
+func (r *GormRepository) GetAllTag() (tags []Tag) {
+	if err := r.db.Find(&tags).Error; err != nil {
 		log.Println("查询记录出错", err.Error())
 	}
 	return
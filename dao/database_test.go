@@ -0,0 +1,218 @@
+package dao
+
+import (
+	"errors"
+	"testing"
+	"wxbot-lostandfound/conversation"
+)
+
+func newTestRepository(t *testing.T) *GormRepository {
+	repository, err := OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repository
+}
+
+// 用户在会话中确认后提交的表单
+func formContext(user string, kind conversation.RecordKind, form conversation.Form) conversation.ConversationContext {
+	return conversation.ConversationContext{
+		ReceiveContent: &conversation.MsgContent{FromUsername: user},
+		Conversation:   &conversation.Conversation{UserName: user, Type: kind, Form: form},
+	}
+}
+
+func TestAddRecordRejectsInvalidKind(t *testing.T) {
+	repository := newTestRepository(t)
+	for _, kind := range []conversation.RecordKind{conversation.KindAdmin, conversation.KindUnknown} {
+		_, err := repository.AddRecord(formContext("u1", kind, conversation.Form{ItemName: "雨伞", ItemTags: []string{"雨伞"}}))
+		if !errors.Is(err, conversation.ErrInvalidKind) {
+			t.Errorf("类型%s应该不能保存 %v", kind, err)
+		}
+	}
+	var count int64
+	repository.DB().Model(&ItemRecord{}).Count(&count)
+	if count != 0 {
+		t.Errorf("不应该保存记录 %d", count)
+	}
+}
+
+func addRecord(t *testing.T, repository *GormRepository, user string, kind conversation.RecordKind, form conversation.Form) ItemRecord {
+	t.Helper()
+	record, err := repository.AddRecord(formContext(user, kind, form))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func TestAddAndGetRecord(t *testing.T) {
+	repository := newTestRepository(t)
+	added := addRecord(t, repository, "u1", conversation.KindFound, conversation.Form{
+		City:           "杭州",
+		Location:       "杭州/西溪园区",
+		ItemName:       "黑色雨伞",
+		ItemTags:       []string{"雨伞", "黑色", "雨伞"},
+		Description:    "在3楼会议室捡到",
+		VerifyQuestion: "伞柄是什么颜色",
+		VerifyAnswer:   "红色",
+		PickupLocation: "前台",
+	})
+	if added.Id == 0 || added.Status != StatusOpen {
+		t.Fatalf("新记录 %+v", added)
+	}
+	record, err := repository.GetRecordById(added.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.User != "u1" || record.Type != conversation.KindFound || record.ItemName != "黑色雨伞" ||
+		record.Location != "杭州/西溪园区" || record.PickupLocation != "前台" || record.VerifyAnswer != "红色" {
+		t.Errorf("读取的记录 %+v", record)
+	}
+	if record.Tags != "雨伞,黑色" {
+		t.Errorf("标签应该去重 %s", record.Tags)
+	}
+	if record.OccurredAt != nil {
+		t.Errorf("没有填写时间 %v", record.OccurredAt)
+	}
+	if _, err := repository.GetRecordById(added.Id + 1); err == nil {
+		t.Error("不存在的记录应该报错")
+	}
+}
+
+func recordIds(records []ItemRecord) map[int64]bool {
+	ids := map[int64]bool{}
+	for _, record := range records {
+		ids[record.Id] = true
+	}
+	return ids
+}
+
+func TestGetRecordFilter(t *testing.T) {
+	repository := newTestRepository(t)
+	umbrella := addRecord(t, repository, "u1", conversation.KindLost, conversation.Form{City: "杭州", Location: "杭州/西溪园区/3楼", ItemName: "黑色雨伞", ItemTags: []string{"雨伞"}})
+	headphone := addRecord(t, repository, "u2", conversation.KindFound, conversation.Form{City: "杭州", Location: "杭州/滨江园区", ItemName: "耳机", Description: "索尼降噪耳机", ItemTags: []string{"耳机"}})
+	card := addRecord(t, repository, "u2", conversation.KindFound, conversation.Form{City: "上海", ItemName: "工牌", ItemTags: []string{"工牌", "证件"}})
+	archived := addRecord(t, repository, "u3", conversation.KindFound, conversation.Form{City: "杭州", ItemName: "雨伞", ItemTags: []string{"雨伞"}})
+	repository.DB().Model(&ItemRecord{}).Where("id = ?", archived.Id).Update("status", StatusArchived)
+
+	cases := []struct {
+		name   string
+		filter RecordFilter
+		want   []int64
+	}{
+		{"全部 不包含已归档", RecordFilter{}, []int64{umbrella.Id, headphone.Id, card.Id}},
+		{"类型", RecordFilter{Type: conversation.KindFound}, []int64{headphone.Id, card.Id}},
+		{"用户", RecordFilter{User: "u2"}, []int64{headphone.Id, card.Id}},
+		{"名称关键词", RecordFilter{Keyword: "雨伞"}, []int64{umbrella.Id}},
+		{"描述关键词", RecordFilter{Keyword: "索尼"}, []int64{headphone.Id}},
+		{"标签关键词", RecordFilter{Keyword: "证件"}, []int64{card.Id}},
+		{"多个关键词同时匹配", RecordFilter{Keyword: "耳机 索尼"}, []int64{headphone.Id}},
+		{"地点包含下级地点", RecordFilter{Location: "杭州/西溪园区"}, []int64{umbrella.Id}},
+		{"城市包含只填写了城市的记录", RecordFilter{Location: "上海"}, []int64{card.Id}},
+		{"城市", RecordFilter{Location: "杭州"}, []int64{umbrella.Id, headphone.Id}},
+		{"状态", RecordFilter{Statuses: []RecordStatus{StatusArchived}}, []int64{archived.Id}},
+		{"标签", RecordFilter{Tags: []string{"雨伞"}, Statuses: OpenStatuses}, []int64{umbrella.Id}},
+	}
+	for _, c := range cases {
+		got := recordIds(repository.GetRecord(c.filter))
+		if len(got) != len(c.want) {
+			t.Errorf("%s: 期望 %v 实际 %v", c.name, c.want, got)
+			continue
+		}
+		for _, id := range c.want {
+			if !got[id] {
+				t.Errorf("%s: 期望 %v 实际 %v", c.name, c.want, got)
+				break
+			}
+		}
+	}
+}
+
+func TestGetAllTag(t *testing.T) {
+	repository := newTestRepository(t)
+	addRecord(t, repository, "u1", conversation.KindLost, conversation.Form{ItemName: "雨伞", ItemTags: []string{"雨伞", "黑色"}})
+	addRecord(t, repository, "u2", conversation.KindFound, conversation.Form{ItemName: "雨伞", ItemTags: []string{"雨伞", "红色"}})
+	tags := map[string]bool{}
+	for _, tag := range repository.GetAllTag() {
+		if tags[tag.TagName] {
+			t.Errorf("标签%s重复", tag.TagName)
+		}
+		tags[tag.TagName] = true
+	}
+	if len(tags) != 3 || !tags["雨伞"] || !tags["黑色"] || !tags["红色"] {
+		t.Errorf("所有标签 %v", tags)
+	}
+}
+
+// 重复的标签只创建一次 已有的标签直接复用
+func TestAddRecordUpsertTags(t *testing.T) {
+	repository := newTestRepository(t)
+	first := addRecord(t, repository, "u1", conversation.KindLost, conversation.Form{ItemName: "雨伞", ItemTags: []string{"雨伞", " 雨伞 ", "", "黑色", "雨伞"}})
+	second := addRecord(t, repository, "u2", conversation.KindFound, conversation.Form{ItemName: "雨伞", ItemTags: []string{"雨伞", "黑色"}})
+	var tagCount int64
+	repository.DB().Model(&Tag{}).Count(&tagCount)
+	if tagCount != 2 {
+		t.Errorf("标签数量 %d", tagCount)
+	}
+	for _, record := range []ItemRecord{first, second} {
+		var links []TagItem
+		repository.DB().Where("item_id = ?", record.Id).Find(&links)
+		if len(links) != 2 {
+			t.Errorf("记录%d的标签关联 %+v", record.Id, links)
+		}
+		for _, link := range links {
+			if link.Type != record.Type {
+				t.Errorf("标签关联的类型 %+v", link)
+			}
+		}
+	}
+}
+
+// 关联标签失败时记录也不会保存
+func TestAddRecordRollback(t *testing.T) {
+	repository := newTestRepository(t)
+	if err := repository.DB().Migrator().DropTable(&TagItem{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repository.AddRecord(formContext("u1", conversation.KindLost, conversation.Form{ItemName: "雨伞", ItemTags: []string{"雨伞"}})); err == nil {
+		t.Fatal("关联标签失败时应该报错")
+	}
+	var recordCount, tagCount int64
+	repository.DB().Model(&ItemRecord{}).Count(&recordCount)
+	repository.DB().Model(&Tag{}).Count(&tagCount)
+	if recordCount != 0 || tagCount != 0 {
+		t.Errorf("应该回滚 记录%d 标签%d", recordCount, tagCount)
+	}
+}
+
+// 分别设置语言和禁用状态 互不覆盖
+func TestUserSetting(t *testing.T) {
+	repository := newTestRepository(t)
+	if setting := repository.GetUserSetting("u1"); setting.UserName != "u1" || setting.Language != "" || setting.Banned {
+		t.Errorf("没有设置时 %+v", setting)
+	}
+	if err := repository.SetLanguage("u1", "en"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.SetBanned("u1", true); err != nil {
+		t.Fatal(err)
+	}
+	if setting := repository.GetUserSetting("u1"); setting.Language != "en" || !setting.Banned {
+		t.Errorf("禁用后 %+v", setting)
+	}
+	if err := repository.SetLanguage("u1", "zh"); err != nil {
+		t.Fatal(err)
+	}
+	if setting := repository.GetUserSetting("u1"); setting.Language != "zh" || !setting.Banned {
+		t.Errorf("切换语言后 %+v", setting)
+	}
+	if err := repository.SetBanned("u2", true); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	repository.DB().Model(&UserSetting{}).Count(&count)
+	if count != 2 {
+		t.Errorf("用户设置数量 %d", count)
+	}
+}
@@ -0,0 +1,61 @@
+package dao
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+)
+
+// 导入的记录及其状态历史
+type RecordImport struct {
+	Record  ItemRecord
+	History []RecordStatusHistory
+}
+
+// 导入失败的记录 Index为记录在批次中的位置
+type ImportError struct {
+	Index int
+	Err   error
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("第%d条记录导入失败 %s", e.Index+1, e.Err.Error())
+}
+
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+// 在同一个事务中导入一批记录 任何一条失败时整批回滚 成功后回填记录的ID
+func (r *GormRepository) ImportRecords(imports []RecordImport) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for i := range imports {
+			if err := importRecord(tx, &imports[i]); err != nil {
+				return &ImportError{Index: i, Err: err}
+			}
+		}
+		return nil
+	})
+}
+
+func importRecord(tx *gorm.DB, recordImport *RecordImport) error {
+	record := &recordImport.Record
+	if !record.Type.IsRecord() {
+		return fmt.Errorf("无效的记录类型%d", record.Type)
+	}
+	tags := uniqueTags(strings.Split(record.Tags, ","))
+	record.Tags = strings.Join(tags, ",")
+	if err := tx.Omit("Id").Create(record).Error; err != nil {
+		return err
+	}
+	if err := linkTags(tx, *record, tags); err != nil {
+		return err
+	}
+	for i := range recordImport.History {
+		recordImport.History[i].ItemId = record.Id
+		if err := tx.Omit("Id").Create(&recordImport.History[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
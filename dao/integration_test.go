@@ -0,0 +1,89 @@
+package dao
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"wxbot-lostandfound/conversation"
+)
+
+// 在各个数据库上执行迁移和关键词搜索
+// SQLite总是执行 PostgreSQL和MySQL需要设置环境变量 如
+// TEST_POSTGRES_DSN="host=localhost user=postgres password=postgres dbname=lostandfound_test sslmode=disable"
+// TEST_MYSQL_DSN="root:root@tcp(localhost:3306)/lostandfound_test?charset=utf8mb4&parseTime=True"
+func TestDrivers(t *testing.T) {
+	drivers := []struct {
+		driver string
+		env    string
+	}{
+		{"postgres", "TEST_POSTGRES_DSN"},
+		{"mysql", "TEST_MYSQL_DSN"},
+	}
+	t.Run("sqlite", func(t *testing.T) {
+		testDriver(t, Config{Driver: "sqlite", Dsn: filepath.Join(t.TempDir(), "test.db")})
+	})
+	for _, d := range drivers {
+		config := Config{Driver: d.driver, Dsn: os.Getenv(d.env)}
+		t.Run(d.driver, func(t *testing.T) {
+			if config.Dsn == "" {
+				t.Skipf("没有设置%s", d.env)
+			}
+			testDriver(t, config)
+		})
+	}
+}
+
+func testDriver(t *testing.T, config Config) {
+	repository, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repository.MigrateUp(0); err != nil {
+		t.Fatal(err)
+	}
+	// 再次执行不会重复迁移
+	if done, err := repository.MigrateUp(0); err != nil || len(done) != 0 {
+		t.Fatalf("重复迁移 %v %v", done, err)
+	}
+	if sqlDB, err := repository.DB().DB(); err == nil {
+		t.Cleanup(func() { sqlDB.Close() })
+	}
+
+	// 外部数据库可能已有数据 只检查本次添加的记录 结束后删除
+	var ids []int64
+	add := func(form conversation.Form) int64 {
+		record := addRecord(t, repository, "integration", conversation.KindFound, form)
+		ids = append(ids, record.Id)
+		return record.Id
+	}
+	t.Cleanup(func() {
+		repository.DB().Where("item_id IN ?", ids).Delete(&TagItem{})
+		repository.DB().Where("id IN ?", ids).Delete(&ItemRecord{})
+	})
+	umbrella := add(conversation.Form{City: "杭州", ItemName: "黑色雨伞", ItemTags: []string{"雨伞", "黑色"}})
+	headphone := add(conversation.Form{City: "杭州", ItemName: "耳机", Description: "索尼降噪耳机", ItemTags: []string{"耳机"}})
+	card := add(conversation.Form{City: "上海", ItemName: "工牌", ItemTags: []string{"工牌", "证件"}})
+
+	cases := []struct {
+		keyword string
+		want    []int64
+	}{
+		{"雨伞", []int64{umbrella}},
+		{"索尼", []int64{headphone}},
+		{"证件", []int64{card}},
+		{"耳机 降噪", []int64{headphone}},
+		{"雨伞 耳机", nil},
+	}
+	for _, c := range cases {
+		got := recordIds(repository.GetRecord(RecordFilter{Keyword: c.keyword}))
+		want := map[int64]bool{}
+		for _, id := range c.want {
+			want[id] = true
+		}
+		for _, id := range ids {
+			if got[id] != want[id] {
+				t.Errorf("%s: 记录%d 期望%v", c.keyword, id, want[id])
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package dao
+
+import (
+	"gorm.io/gorm"
+	"log"
+	"wxbot-lostandfound/utils"
+)
+
+// 保存的地点 上级地点在下级地点之前
+func (r *GormRepository) GetLocations() (paths []utils.LocationPath) {
+	var locations []Location
+	if err := r.db.Order("id").Find(&locations).Error; err != nil {
+		log.Println("查询地点出错", err.Error())
+	}
+	for _, location := range locations {
+		paths = append(paths, utils.LocationPath{Path: location.Path, Latitude: location.Latitude, Longitude: location.Longitude})
+	}
+	return
+}
+
+// 替换全部地点 地点数量很少,每次修改都整体保存
+func (r *GormRepository) ReplaceLocations(paths []utils.LocationPath) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&Location{}).Error; err != nil {
+			return err
+		}
+		for _, path := range paths {
+			location := Location{Path: path.Path, Latitude: path.Latitude, Longitude: path.Longitude}
+			if err := tx.Omit("Id").Create(&location).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,329 @@
+package dao
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// 数据库迁移 按版本号依次执行,已执行的版本记录在schema_migrations表中
+// 迁移中使用当时的表结构定义,之后修改model不会影响已有的迁移
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// 已执行的迁移
+type SchemaMigration struct {
+	Version   int `gorm:"primary_key;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// 迁移的执行状态 未执行时AppliedAt为空
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+var migrations = []Migration{
+	{1, "initial_schema", migrateInitialSchema, dropTables("tag_items", "tags", "item_records")},
+	{2, "claims_custody_settings_subscriptions", migrateAuxiliaryTables,
+		dropTables("record_status_histories", "subscriptions", "user_settings", "custody_records", "claim_attempts")},
+	{3, "status_codes", migrateStatusCodes, revertStatusCodes},
+	{4, "search_index", migrateSearchIndex, dropSearchIndex},
+	{5, "soft_delete_and_revisions", migrateSoftDelete, revertSoftDelete},
+	{6, "user_banned", migrateUserBanned, revertUserBanned},
+	{7, "locations", migrateLocations, dropTables("locations")},
+}
+
+// 记录、标签和标签关联 在AutoMigrate生成的表结构上补充类型、状态和标签关联的索引
+func migrateInitialSchema(tx *gorm.DB) error {
+	type ItemRecord struct {
+		Id             int64 `gorm:"column:id;primary_key"`
+		Type           int64 `gorm:"index"`
+		ItemName       string
+		User           string
+		CompleteUser   string
+		Tags           string
+		City           string
+		Location       string
+		Description    string
+		ImgName        string
+		Status         string `gorm:"index"`
+		OccurredAt     *time.Time
+		Latitude       float64
+		Longitude      float64
+		LocationLabel  string
+		Sensitive      bool
+		VerifyQuestion string
+		VerifyAnswer   string
+		PickupLocation string
+		RemindedAt     *time.Time
+		CreatedAt      time.Time
+	}
+	type Tag struct {
+		Id      int64  `gorm:"column:id;primary_key"`
+		TagName string `gorm:"unique;size:191"`
+	}
+	type TagItem struct {
+		Id     int64 `gorm:"column:id;primary_key"`
+		TagId  int64 `gorm:"index:idx_tag_items_tag_item"`
+		ItemId int64 `gorm:"index:idx_tag_items_tag_item"`
+		Type   int64
+	}
+	return tx.AutoMigrate(&ItemRecord{}, &Tag{}, &TagItem{})
+}
+
+// 认领、流转、用户设置、订阅和状态历史
+func migrateAuxiliaryTables(tx *gorm.DB) error {
+	type ClaimAttempt struct {
+		Id        int64 `gorm:"column:id;primary_key"`
+		ItemId    int64
+		User      string
+		Answer    string
+		Passed    bool
+		CreatedAt time.Time
+	}
+	type CustodyRecord struct {
+		Id           int64 `gorm:"column:id;primary_key"`
+		ItemId       int64
+		FromLocation string
+		ToLocation   string
+		Operator     string
+		Note         string
+		CreatedAt    time.Time
+	}
+	type UserSetting struct {
+		UserName  string `gorm:"primary_key;size:191"`
+		Language  string
+		UpdatedAt time.Time
+	}
+	type Subscription struct {
+		Id        int64 `gorm:"column:id;primary_key"`
+		User      string
+		Keywords  string
+		City      string
+		ItemId    int64
+		ExpiresAt time.Time
+		CreatedAt time.Time
+	}
+	type RecordStatusHistory struct {
+		Id         int64 `gorm:"column:id;primary_key"`
+		ItemId     int64
+		FromStatus string
+		ToStatus   string
+		Operator   string
+		Role       string
+		Note       string
+		CreatedAt  time.Time
+	}
+	return tx.AutoMigrate(&ClaimAttempt{}, &CustodyRecord{}, &UserSetting{}, &Subscription{}, &RecordStatusHistory{})
+}
+
+// 旧版本中状态为中文字符串 转换为状态代码
+var legacyStatuses = map[string]RecordStatus{
+	"未完成": StatusOpen,
+	"已完成": StatusCompleted,
+	"已归档": StatusArchived,
+}
+
+func migrateStatusCodes(tx *gorm.DB) error {
+	for legacy, status := range legacyStatuses {
+		if err := tx.Table("item_records").Where("status = ?", legacy).Update("status", status).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 回退时旧版本没有的状态按是否仍在处理中归为 未完成 或 已完成
+func revertStatusCodes(tx *gorm.DB) error {
+	for _, status := range Statuses {
+		legacy := "已完成"
+		if status == StatusArchived {
+			legacy = "已归档"
+		} else if status.IsOpen() {
+			legacy = "未完成"
+		}
+		if err := tx.Table("item_records").Where("status = ?", status).Update("status", legacy).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateSearchIndex(tx *gorm.DB) error {
+	return searchFor(tx.Dialector.Name()).prepare(tx)
+}
+
+func dropSearchIndex(tx *gorm.DB) error {
+	return searchFor(tx.Dialector.Name()).drop(tx)
+}
+
+// 记录的软删除和历史版本
+func migrateSoftDelete(tx *gorm.DB) error {
+	type ItemRecord struct {
+		Id        int64          `gorm:"column:id;primary_key"`
+		DeletedAt gorm.DeletedAt `gorm:"index"`
+	}
+	// 同一记录的版本号唯一 并发修改时后提交的事务失败而不是产生重复的版本
+	type RecordRevision struct {
+		Id        int64 `gorm:"column:id;primary_key"`
+		ItemId    int64 `gorm:"uniqueIndex:idx_record_revisions_item_version"`
+		Version   int   `gorm:"uniqueIndex:idx_record_revisions_item_version"`
+		Action    string
+		Editor    string
+		Data      string
+		CreatedAt time.Time
+	}
+	return tx.AutoMigrate(&ItemRecord{}, &RecordRevision{})
+}
+
+func revertSoftDelete(tx *gorm.DB) error {
+	// 回退前彻底删除已软删除的记录 旧版本无法识别
+	if err := tx.Exec("DELETE FROM item_records WHERE deleted_at IS NOT NULL").Error; err != nil {
+		return err
+	}
+	type ItemRecord struct {
+		DeletedAt gorm.DeletedAt `gorm:"index"`
+	}
+	if err := tx.Migrator().DropIndex(&ItemRecord{}, "idx_item_records_deleted_at"); err != nil {
+		return err
+	}
+	if err := tx.Migrator().DropColumn(&ItemRecord{}, "DeletedAt"); err != nil {
+		return err
+	}
+	// SQLite删除列时会重建表 需要重新创建初始迁移中的索引
+	if err := migrateInitialSchema(tx); err != nil {
+		return err
+	}
+	return tx.Migrator().DropTable("record_revisions")
+}
+
+// 禁用用户
+func migrateUserBanned(tx *gorm.DB) error {
+	type UserSetting struct {
+		UserName string `gorm:"primary_key;size:191"`
+		Banned   bool
+	}
+	return tx.AutoMigrate(&UserSetting{})
+}
+
+func revertUserBanned(tx *gorm.DB) error {
+	type UserSetting struct {
+		Banned bool
+	}
+	return tx.Migrator().DropColumn(&UserSetting{}, "Banned")
+}
+
+// 管理后台编辑的地点
+func migrateLocations(tx *gorm.DB) error {
+	type Location struct {
+		Id        int64  `gorm:"column:id;primary_key"`
+		Path      string `gorm:"unique;size:191"`
+		Latitude  float64
+		Longitude float64
+	}
+	return tx.AutoMigrate(&Location{})
+}
+
+func dropTables(tables ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, table := range tables {
+			if err := tx.Migrator().DropTable(table); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// 所有迁移的执行状态
+func (r *GormRepository) MigrationStatus() (states []MigrationState, err error) {
+	applied, err := r.appliedMigrations()
+	if err != nil {
+		return
+	}
+	for _, migration := range migrations {
+		state := MigrationState{Migration: migration}
+		if schemaMigration, exist := applied[migration.Version]; exist {
+			appliedAt := schemaMigration.AppliedAt
+			state.AppliedAt = &appliedAt
+		}
+		states = append(states, state)
+	}
+	return
+}
+
+// 依次执行未执行的迁移直到target版本 target不大于0时执行到最新版本 返回执行了的迁移
+func (r *GormRepository) MigrateUp(target int) (done []Migration, err error) {
+	applied, err := r.appliedMigrations()
+	if err != nil {
+		return
+	}
+	for _, migration := range migrations {
+		if target > 0 && migration.Version > target {
+			break
+		}
+		if _, exist := applied[migration.Version]; exist {
+			continue
+		}
+		err = r.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("迁移%d_%s失败: %w", migration.Version, migration.Name, err)
+		}
+		log.Printf("已执行迁移%d_%s\n", migration.Version, migration.Name)
+		done = append(done, migration)
+	}
+	return
+}
+
+// 按版本倒序回退steps个已执行的迁移 返回回退了的迁移
+func (r *GormRepository) MigrateDown(steps int) (done []Migration, err error) {
+	applied, err := r.appliedMigrations()
+	if err != nil {
+		return
+	}
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := migrations[i]
+		if _, exist := applied[migration.Version]; !exist {
+			continue
+		}
+		err = r.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("回退迁移%d_%s失败: %w", migration.Version, migration.Name, err)
+		}
+		log.Printf("已回退迁移%d_%s\n", migration.Version, migration.Name)
+		done = append(done, migration)
+	}
+	return
+}
+
+func (r *GormRepository) appliedMigrations() (map[int]SchemaMigration, error) {
+	if err := r.db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	var schemaMigrations []SchemaMigration
+	if err := r.db.Find(&schemaMigrations).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int]SchemaMigration, len(schemaMigrations))
+	for _, schemaMigration := range schemaMigrations {
+		applied[schemaMigration.Version] = schemaMigration
+	}
+	return applied, nil
+}
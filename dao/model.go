@@ -1,33 +1,106 @@
 package dao
 
-import "time"
+import (
+	"gorm.io/gorm"
+	"time"
+	"wxbot-lostandfound/conversation"
+)
 
 // 失物
 type ItemRecord struct {
-	Id           int64 `gorm:"column:id;primary_key"`
-	Type         int64 // 1 丢失物品 2 捡到物品
-	ItemName     string
-	User         string // 创建记录的用户名
-	CompleteUser string // 完成记录(取走失物或者是捡到失物)的用户
-	Tags         string
-	City         string
-	Description  string
-	ImgName      string // 在本地文件夹中的图片名称
-	Status       string //完成与否
-	CreatedAt    time.Time
+	Id             int64                   `gorm:"column:id;primary_key"`
+	Type           conversation.RecordKind `gorm:"index"`
+	ItemName       string
+	User           string // 创建记录的用户名
+	CompleteUser   string // 完成记录(取走失物或者是捡到失物)的用户
+	Tags           string
+	City           string
+	Location       string // 地点完整路径 如 杭州/西溪园区/3楼
+	Description    string
+	ImgName        string       // 在本地文件夹中的图片名称
+	Status         RecordStatus `gorm:"index"`
+	OccurredAt     *time.Time   // 丢失或捡到物品的时间 用户不清楚时为空
+	Latitude       float64      // 用户发送的位置 没有发送位置时为0
+	Longitude      float64
+	LocationLabel  string
+	Sensitive      bool   // 敏感物品(证件、银行卡等),公开列表中隐藏图片并对描述打码
+	VerifyQuestion string // 捡到物品的用户设置的验证问题,认领人回答正确后才展示联系方式
+	VerifyAnswer   string
+	PickupLocation string     // 捡到物品的取回地点 如前台、储物柜
+	RemindedAt     *time.Time // 最近一次提醒登记人更新记录的时间
+	CreatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"` // 软删除 查询时自动排除已删除的记录
 }
 
 // 标签
 type Tag struct {
-	Id      int64   `gorm:"column:id;primary_key"`
-	TagName string `gorm:"unique"`
+	Id      int64  `gorm:"column:id;primary_key"`
+	TagName string `gorm:"unique;size:191"` // MySQL中唯一索引不能建在text列上
 }
 
 // 标签关联
 type TagItem struct {
-	Id     int64 `gorm:"column:id;primary_key"`
-	TagId  int64
-	ItemId int64
-	Type   int64 // 捡到物品的记录和丢失物品的记录的标签分开处理
+	Id     int64                   `gorm:"column:id;primary_key"`
+	TagId  int64                   `gorm:"index:idx_tag_items_tag_item"`
+	ItemId int64                   `gorm:"index:idx_tag_items_tag_item"`
+	Type   conversation.RecordKind // 捡到物品的记录和丢失物品的记录的标签分开处理
+}
+
+// 认领尝试 每次回答验证问题都会记录
+type ClaimAttempt struct {
+	Id        int64 `gorm:"column:id;primary_key"`
+	ItemId    int64
+	User      string // 认领人
+	Answer    string
+	Passed    bool
+	CreatedAt time.Time
+}
+
+// 物品流转记录 如捡到的物品被移交到前台
+type CustodyRecord struct {
+	Id           int64 `gorm:"column:id;primary_key"`
+	ItemId       int64
+	FromLocation string
+	ToLocation   string
+	Operator     string // 进行移交登记的用户
+	Note         string
+	CreatedAt    time.Time
+}
+
+// 用户设置 如界面语言
+type UserSetting struct {
+	UserName  string `gorm:"primary_key;size:191"`
+	Language  string
+	Banned    bool // 被管理员禁用 机器人不再处理该用户的消息
+	UpdatedAt time.Time
+}
+
+// 订阅 登记的捡到物品与关键词匹配时通知订阅人
+type Subscription struct {
+	Id        int64  `gorm:"column:id;primary_key"`
+	User      string // 订阅人
+	Keywords  string // 逗号分隔的关键词 均为小写
+	City      string // 为空时不限城市
+	ItemId    int64  // 根据丢失物品的记录自动创建时为该记录的ID
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// 记录的历史版本 修改、删除和恢复前保存记录原来的内容
+type RecordRevision struct {
+	Id        int64          `gorm:"column:id;primary_key"`
+	ItemId    int64          `gorm:"uniqueIndex:idx_record_revisions_item_version"`
+	Version   int            `gorm:"uniqueIndex:idx_record_revisions_item_version"` // 每条记录从1开始递增
+	Action    RevisionAction // 保存该版本的操作
+	Editor    string         // 进行操作的用户
+	Data      string         // 操作前记录的JSON
+	CreatedAt time.Time
+}
 
-}
\ No newline at end of file
+// 地点 管理后台修改地点层级后保存 没有记录时使用配置中的地点
+type Location struct {
+	Id        int64  `gorm:"column:id;primary_key"`
+	Path      string `gorm:"unique;size:191"` // 完整路径 如 杭州/西溪园区/3楼
+	Latitude  float64
+	Longitude float64
+}
@@ -0,0 +1,130 @@
+package dao
+
+import (
+	"fmt"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/utils"
+)
+
+// 记录的存储 bot和handler通过接口访问数据库 便于替换实现
+type RecordRepository interface {
+	AddRecord(ctx conversation.ConversationContext) (ItemRecord, error)
+	ImportRecords(imports []RecordImport) error
+	GetRecordById(id int64) (ItemRecord, error)
+	GetRecord(filter RecordFilter) []ItemRecord
+	TransitionRecord(id int64, to RecordStatus, operator string, role Role, note string) (ItemRecord, error)
+	GetStatusHistory(itemId int64) []RecordStatusHistory
+	GetAllTag() []Tag
+	MergeTags(sources []string, target string) (int64, error)
+	GetTagUsage() []TagUsage
+	MatchCandidates(record ItemRecord, limit int) []ItemRecord
+	// 修改、软删除和恢复 操作前的内容保存为历史版本
+	UpdateRecord(id int64, editor string, update func(record *ItemRecord)) (ItemRecord, error)
+	DeleteRecord(id int64, editor string) error
+	RestoreRecord(id int64, version int, editor string) (ItemRecord, error)
+	GetRevisions(itemId int64) []RecordRevision
+}
+
+// 机器人使用的全部数据访问
+type Repository interface {
+	RecordRepository
+	// 定时任务
+	GetStaleRecords(before time.Time) []ItemRecord
+	MarkReminded(ids []int64, now time.Time) error
+	ArchiveRecords(before time.Time) (int64, error)
+	// 认领
+	AddClaimAttempt(attempt *ClaimAttempt) error
+	CountFailedClaimAttempts(itemId int64, user string) int64
+	IsClaimVerified(itemId int64, user string) bool
+	// 物品流转
+	HandOverItem(itemId int64, toLocation string, operator string, note string) (ItemRecord, error)
+	GetCustodyRecords(itemId int64) []CustodyRecord
+	// 用户设置
+	GetUserSetting(userName string) UserSetting
+	SaveUserSetting(setting *UserSetting) error
+	SetBanned(userName string, banned bool) error
+	SetLanguage(userName string, lang string) error
+	// 地点
+	GetLocations() []utils.LocationPath
+	ReplaceLocations(paths []utils.LocationPath) error
+	// 订阅
+	AddSubscription(subscription *Subscription) error
+	GetSubscriptions(user string, now time.Time) []Subscription
+	DeleteSubscription(id int64, user string) error
+	DeleteExpiredSubscriptions(now time.Time)
+	MatchSubscriptions(record ItemRecord, now time.Time) []Subscription
+}
+
+// 数据库配置
+type Config struct {
+	Driver string // sqlite postgres mysql 默认为sqlite
+	Dsn    string // sqlite为数据库文件路径 默认为database.db; mysql需要带上parseTime=True
+}
+
+// 基于gorm的实现
+type GormRepository struct {
+	db     *gorm.DB
+	search searchDialect
+}
+
+// 按配置连接数据库 需要执行MigrateUp创建或更新表结构
+func Open(config Config) (*GormRepository, error) {
+	var dialector gorm.Dialector
+	switch config.Driver {
+	case "", "sqlite":
+		dsn := config.Dsn
+		if dsn == "" {
+			dsn = "database.db"
+		}
+		// 服务运行时命令行工具也会读写数据库 等待锁释放而不是直接返回database is locked
+		if !strings.Contains(dsn, "?") {
+			dsn += "?_busy_timeout=5000&_journal_mode=WAL"
+		}
+		dialector = sqlite.Open(dsn)
+	case "postgres":
+		dialector = postgres.Open(config.Dsn)
+	case "mysql":
+		dialector = mysql.Open(config.Dsn)
+	default:
+		return nil, fmt.Errorf("不支持的数据库%s", config.Driver)
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	return newGormRepository(db), nil
+}
+
+// 内存数据库 每次调用都是独立的已迁移的空数据库 用于测试
+func OpenMemory() (*GormRepository, error) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	// 内存数据库只存在于单个连接中
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+	repository := newGormRepository(db)
+	if _, err := repository.MigrateUp(0); err != nil {
+		return nil, err
+	}
+	return repository, nil
+}
+
+func newGormRepository(db *gorm.DB) *GormRepository {
+	return &GormRepository{db: db, search: searchFor(db.Dialector.Name())}
+}
+
+// 底层的数据库连接
+func (r *GormRepository) DB() *gorm.DB {
+	return r.db
+}
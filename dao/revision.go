@@ -0,0 +1,141 @@
+package dao
+
+import (
+	"encoding/json"
+	"errors"
+	"gorm.io/gorm"
+	"log"
+	"strings"
+)
+
+// 修改记录的操作
+type RevisionAction string
+
+const (
+	RevisionEdit    RevisionAction = "edit"
+	RevisionDelete  RevisionAction = "delete"
+	RevisionRestore RevisionAction = "restore"
+)
+
+// 可以修改和从历史版本恢复的列 状态通过TransitionRecord变更
+var editableColumns = []string{"item_name", "description", "city", "location", "pickup_location", "tags", "sensitive"}
+
+var ErrNotDeleted = errors.New("记录没有被删除")
+
+// 历史版本中保存的记录
+func (v RecordRevision) Record() (record ItemRecord, err error) {
+	err = json.Unmarshal([]byte(v.Data), &record)
+	return
+}
+
+// 保存记录当前的内容为新的历史版本
+func saveRevision(tx *gorm.DB, record ItemRecord, action RevisionAction, editor string) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	// 使用最大的版本号而不是版本数量 与唯一索引一起保证版本号不重复
+	var version int
+	if err := tx.Model(&RecordRevision{}).Where("item_id = ?", record.Id).Select("COALESCE(MAX(version), 0)").Scan(&version).Error; err != nil {
+		return err
+	}
+	return tx.Omit("Id").Create(&RecordRevision{
+		ItemId:  record.Id,
+		Version: version + 1,
+		Action:  action,
+		Editor:  editor,
+		Data:    string(data),
+	}).Error
+}
+
+// 修改记录 保存原来的内容为历史版本 标签变化时重建标签关联
+func (r *GormRepository) UpdateRecord(id int64, editor string, update func(record *ItemRecord)) (record ItemRecord, err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&record, id).Error; err != nil {
+			return err
+		}
+		if err := saveRevision(tx, record, RevisionEdit, editor); err != nil {
+			return err
+		}
+		tags := record.Tags
+		update(&record)
+		record.Id = id
+		return saveEditable(tx, record, tags != record.Tags)
+	})
+	return
+}
+
+// 删除记录 软删除前保存历史版本
+func (r *GormRepository) DeleteRecord(id int64, editor string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var record ItemRecord
+		if err := tx.First(&record, id).Error; err != nil {
+			return err
+		}
+		if err := saveRevision(tx, record, RevisionDelete, editor); err != nil {
+			return err
+		}
+		return tx.Delete(&record).Error
+	})
+}
+
+// 恢复记录 version为0时恢复已删除的记录,否则恢复到指定历史版本的内容(同时取消删除)
+func (r *GormRepository) RestoreRecord(id int64, version int, editor string) (record ItemRecord, err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().First(&record, id).Error; err != nil {
+			return err
+		}
+		if version == 0 && !record.DeletedAt.Valid {
+			return ErrNotDeleted
+		}
+		if err := saveRevision(tx, record, RevisionRestore, editor); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&record).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		record.DeletedAt = gorm.DeletedAt{}
+		if version == 0 {
+			return nil
+		}
+		var revision RecordRevision
+		if err := tx.Where("item_id = ? AND version = ?", id, version).First(&revision).Error; err != nil {
+			return err
+		}
+		previous, err := revision.Record()
+		if err != nil {
+			return err
+		}
+		tags := record.Tags
+		record.ItemName = previous.ItemName
+		record.Description = previous.Description
+		record.City = previous.City
+		record.Location = previous.Location
+		record.PickupLocation = previous.PickupLocation
+		record.Tags = previous.Tags
+		return saveEditable(tx, record, tags != record.Tags)
+	})
+	return
+}
+
+// 记录的历史版本 按版本号排序
+func (r *GormRepository) GetRevisions(itemId int64) (revisions []RecordRevision) {
+	if err := r.db.Where("item_id = ?", itemId).Order("version").Find(&revisions).Error; err != nil {
+		log.Println("查询历史版本出错", err.Error())
+	}
+	return
+}
+
+// 保存可修改的列 标签变化时重建标签关联
+func saveEditable(tx *gorm.DB, record ItemRecord, tagsChanged bool) error {
+	if err := tx.Model(&record).Select(editableColumns).Updates(&record).Error; err != nil {
+		return err
+	}
+	if !tagsChanged {
+		return nil
+	}
+	if err := tx.Where("item_id = ?", record.Id).Delete(&TagItem{}).Error; err != nil {
+		return err
+	}
+	return linkTags(tx, record, uniqueTags(strings.Split(record.Tags, ",")))
+}
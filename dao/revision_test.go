@@ -0,0 +1,39 @@
+package dao
+
+import (
+	"testing"
+	"wxbot-lostandfound/conversation"
+)
+
+func TestRevisionVersions(t *testing.T) {
+	repository := newTestRepository(t)
+	record := addRecord(t, repository, "u1", conversation.KindFound, conversation.Form{ItemName: "雨伞", ItemTags: []string{"雨伞"}})
+	for _, name := range []string{"黑色雨伞", "折叠伞"} {
+		if _, err := repository.UpdateRecord(record.Id, "u1", func(r *ItemRecord) { r.ItemName = name }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 删除中间的版本后 新版本号仍然大于已有的版本号
+	repository.DB().Where("item_id = ? AND version = ?", record.Id, 1).Delete(&RecordRevision{})
+	if err := repository.DeleteRecord(record.Id, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	revisions := repository.GetRevisions(record.Id)
+	if len(revisions) != 2 || revisions[0].Version != 2 || revisions[1].Version != 3 || revisions[1].Action != RevisionDelete {
+		t.Fatalf("历史版本 %+v", revisions)
+	}
+	if previous, _ := revisions[0].Record(); previous.ItemName != "黑色雨伞" {
+		t.Errorf("第2个版本的内容 %+v", previous)
+	}
+
+	// 版本号重复时保存失败
+	duplicate := RecordRevision{ItemId: record.Id, Version: 3, Action: RevisionEdit}
+	if err := repository.DB().Omit("Id").Create(&duplicate).Error; err == nil {
+		t.Error("同一记录的版本号应该唯一")
+	}
+	// 其他记录可以使用相同的版本号
+	other := RecordRevision{ItemId: record.Id + 1, Version: 3, Action: RevisionEdit}
+	if err := repository.DB().Omit("Id").Create(&other).Error; err != nil {
+		t.Error(err)
+	}
+}
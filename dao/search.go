@@ -0,0 +1,100 @@
+package dao
+
+import (
+	"gorm.io/gorm"
+	"log"
+	"strings"
+)
+
+// 按关键词搜索物品名称、描述和标签 不同数据库使用各自的全文索引
+type searchDialect interface {
+	// 创建和删除搜索使用的索引 在迁移中执行
+	prepare(db *gorm.DB) error
+	drop(db *gorm.DB) error
+	// 加入单个关键词的搜索条件
+	match(query *gorm.DB, keyword string) *gorm.DB
+}
+
+const searchIndex = "idx_item_records_search"
+
+// 根据gorm的方言名称选择搜索方式
+func searchFor(dialect string) searchDialect {
+	switch dialect {
+	case "postgres":
+		return postgresSearch{}
+	case "mysql":
+		return mysqlSearch{}
+	}
+	return likeSearch{}
+}
+
+// SQLite 直接使用LIKE
+type likeSearch struct{}
+
+func (likeSearch) prepare(db *gorm.DB) error {
+	return nil
+}
+
+func (likeSearch) drop(db *gorm.DB) error {
+	return nil
+}
+
+func (likeSearch) match(query *gorm.DB, keyword string) *gorm.DB {
+	pattern := "%" + keyword + "%"
+	return query.Where("item_name LIKE ? OR description LIKE ? OR tags LIKE ?", pattern, pattern, pattern)
+}
+
+// PostgreSQL 英文等按词切分的内容使用tsvector,中文没有分词插件时使用pg_trgm三元组索引加速的ILIKE
+type postgresSearch struct{}
+
+const postgresSearchText = "(coalesce(item_name, '') || ' ' || coalesce(description, '') || ' ' || coalesce(tags, ''))"
+
+func (postgresSearch) prepare(db *gorm.DB) error {
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_item_records_tsv ON item_records USING gin (to_tsvector('simple', " + postgresSearchText + "))").Error; err != nil {
+		return err
+	}
+	// 创建扩展需要权限 失败时回滚到保存点继续迁移 ILIKE仍然可用 只是没有索引
+	if err := db.SavePoint("pg_trgm").Error; err != nil {
+		return err
+	}
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+		log.Println("创建pg_trgm扩展失败 关键词搜索将不使用三元组索引", err.Error())
+		return db.RollbackTo("pg_trgm").Error
+	}
+	return db.Exec("CREATE INDEX IF NOT EXISTS " + searchIndex + " ON item_records USING gin (" + postgresSearchText + " gin_trgm_ops)").Error
+}
+
+func (postgresSearch) drop(db *gorm.DB) error {
+	if err := db.Exec("DROP INDEX IF EXISTS " + searchIndex).Error; err != nil {
+		return err
+	}
+	return db.Exec("DROP INDEX IF EXISTS idx_item_records_tsv").Error
+}
+
+func (postgresSearch) match(query *gorm.DB, keyword string) *gorm.DB {
+	return query.Where("to_tsvector('simple', "+postgresSearchText+") @@ plainto_tsquery('simple', ?) OR "+postgresSearchText+" ILIKE ?", keyword, "%"+keyword+"%")
+}
+
+// MySQL 使用ngram分词的全文索引 支持中文
+type mysqlSearch struct{}
+
+// MySQL中DDL会隐式提交事务 索引已存在时跳过
+func (mysqlSearch) prepare(db *gorm.DB) error {
+	if db.Migrator().HasIndex("item_records", searchIndex) {
+		return nil
+	}
+	return db.Exec("ALTER TABLE item_records ADD FULLTEXT INDEX " + searchIndex + " (item_name, description, tags) WITH PARSER ngram").Error
+}
+
+func (mysqlSearch) drop(db *gorm.DB) error {
+	if !db.Migrator().HasIndex("item_records", searchIndex) {
+		return nil
+	}
+	return db.Migrator().DropIndex("item_records", searchIndex)
+}
+
+func (mysqlSearch) match(query *gorm.DB, keyword string) *gorm.DB {
+	// 作为短语搜索 ngram会按相邻的字进行匹配
+	phrase := `"` + strings.ReplaceAll(keyword, `"`, "") + `"`
+	return query.Where("MATCH (item_name, description, tags) AGAINST (? IN BOOLEAN MODE)", phrase)
+}
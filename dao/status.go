@@ -0,0 +1,203 @@
+package dao
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"log"
+	"time"
+	"wxbot-lostandfound/conversation"
+)
+
+// 记录状态
+type RecordStatus string
+
+const (
+	StatusOpen      RecordStatus = "open"       // 未完成
+	StatusClaimed   RecordStatus = "claimed"    // 已认领 等待取回
+	StatusInCustody RecordStatus = "in_custody" // 已移交前台等保管点
+	StatusCompleted RecordStatus = "completed"  // 已完成
+	StatusExpired   RecordStatus = "expired"    // 已过期 无人认领
+	StatusWithdrawn RecordStatus = "withdrawn"  // 登记人撤回
+	StatusDisputed  RecordStatus = "disputed"   // 存在争议 等待管理员处理
+	StatusArchived  RecordStatus = "archived"   // 超过保存期限 查询时不指定状态则不返回
+)
+
+// 所有状态 按展示顺序
+var Statuses = []RecordStatus{StatusOpen, StatusClaimed, StatusInCustody, StatusDisputed, StatusCompleted, StatusExpired, StatusWithdrawn, StatusArchived}
+
+// 仍在处理中的状态 即原来的 未完成
+var OpenStatuses = []RecordStatus{StatusOpen, StatusClaimed, StatusInCustody, StatusDisputed}
+
+// 记录是否仍在处理中
+func (s RecordStatus) IsOpen() bool {
+	for _, status := range OpenStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// 是否为已定义的状态
+func (s RecordStatus) IsValid() bool {
+	for _, status := range Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// 修改记录状态的角色
+type Role string
+
+const (
+	RoleOwner    Role = "owner"    // 登记人
+	RoleClaimant Role = "claimant" // 认领人 即回答过验证问题或直接认领过记录的用户
+	RoleAdmin    Role = "admin"
+	RoleSystem   Role = "system" // 定时任务
+	RoleNone     Role = "none"   // 与记录无关的用户 不能变更状态
+)
+
+// 是否为会记录在状态历史中的角色
+func (r Role) IsValid() bool {
+	switch r {
+	case RoleOwner, RoleClaimant, RoleAdmin, RoleSystem:
+		return true
+	}
+	return false
+}
+
+// 状态流转表 当前状态 -> 目标状态 -> 允许进行流转的角色
+var transitions = map[RecordStatus]map[RecordStatus][]Role{
+	StatusOpen: {
+		StatusClaimed:   {RoleClaimant, RoleAdmin},
+		StatusInCustody: {RoleOwner, RoleAdmin},
+		StatusCompleted: {RoleOwner, RoleAdmin},
+		StatusWithdrawn: {RoleOwner, RoleAdmin},
+		StatusDisputed:  {RoleOwner, RoleClaimant, RoleAdmin},
+		StatusExpired:   {RoleAdmin, RoleSystem},
+		StatusArchived:  {RoleSystem},
+	},
+	StatusClaimed: {
+		StatusOpen:      {RoleOwner, RoleAdmin},
+		StatusCompleted: {RoleOwner, RoleClaimant, RoleAdmin},
+		StatusDisputed:  {RoleOwner, RoleClaimant, RoleAdmin},
+		StatusArchived:  {RoleSystem},
+	},
+	StatusInCustody: {
+		StatusClaimed:   {RoleClaimant, RoleAdmin},
+		StatusCompleted: {RoleOwner, RoleAdmin},
+		StatusDisputed:  {RoleOwner, RoleClaimant, RoleAdmin},
+		StatusExpired:   {RoleAdmin, RoleSystem},
+		StatusArchived:  {RoleSystem},
+	},
+	StatusDisputed: {
+		StatusOpen:      {RoleAdmin},
+		StatusClaimed:   {RoleAdmin},
+		StatusCompleted: {RoleAdmin},
+		StatusWithdrawn: {RoleAdmin},
+		StatusArchived:  {RoleSystem},
+	},
+	StatusExpired: {
+		StatusOpen:     {RoleOwner, RoleAdmin},
+		StatusArchived: {RoleSystem},
+	},
+	StatusCompleted: {
+		StatusOpen:     {RoleAdmin},
+		StatusArchived: {RoleSystem},
+	},
+	StatusWithdrawn: {
+		StatusOpen:     {RoleOwner, RoleAdmin},
+		StatusArchived: {RoleSystem},
+	},
+}
+
+var ErrInvalidTransition = errors.New("不允许的状态变更")
+
+// 角色是否可以将记录从from变更为to
+func CanTransition(from RecordStatus, to RecordStatus, role Role) bool {
+	for _, allowed := range transitions[from][to] {
+		if allowed == role {
+			return true
+		}
+	}
+	return false
+}
+
+// 角色是否可以将记录变更为to 丢失物品的记录不能被认领
+func CanTransitionRecord(record ItemRecord, to RecordStatus, role Role) bool {
+	if to == StatusClaimed && record.Type == conversation.KindLost {
+		return false
+	}
+	return CanTransition(record.Status, to, role)
+}
+
+// 角色可以将记录变更到的状态
+func NextStatuses(record ItemRecord, role Role) (statuses []RecordStatus) {
+	for _, status := range Statuses {
+		if CanTransitionRecord(record, status, role) {
+			statuses = append(statuses, status)
+		}
+	}
+	return
+}
+
+// 状态变更历史
+type RecordStatusHistory struct {
+	Id         int64 `gorm:"column:id;primary_key"`
+	ItemId     int64
+	FromStatus RecordStatus
+	ToStatus   RecordStatus
+	Operator   string // 进行变更的用户 定时任务为空
+	Role       Role
+	Note       string
+	CreatedAt  time.Time
+}
+
+// 变更记录状态并记录历史 变更为已完成时记录完成人
+func (r *GormRepository) TransitionRecord(id int64, to RecordStatus, operator string, role Role, note string) (record ItemRecord, err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&record, id).Error; err != nil {
+			return err
+		}
+		return transition(tx, &record, to, operator, role, note)
+	})
+	return
+}
+
+func transition(tx *gorm.DB, record *ItemRecord, to RecordStatus, operator string, role Role, note string) error {
+	from := record.Status
+	if !CanTransitionRecord(*record, to, role) {
+		return ErrInvalidTransition
+	}
+	updates := map[string]interface{}{"status": to}
+	if to == StatusCompleted {
+		updates["complete_user"] = operator
+	}
+	// 带上原状态作为条件 避免并发修改
+	result := tx.Model(&ItemRecord{}).Where("id = ? AND status = ?", record.Id, from).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTransition
+	}
+	record.Status = to
+	return tx.Omit("Id").Create(&RecordStatusHistory{
+		ItemId:     record.Id,
+		FromStatus: from,
+		ToStatus:   to,
+		Operator:   operator,
+		Role:       role,
+		Note:       note,
+	}).Error
+}
+
+// 查询记录的状态变更历史
+func (r *GormRepository) GetStatusHistory(itemId int64) (histories []RecordStatusHistory) {
+	if err := r.db.Where("item_id = ?", itemId).Order("created_at, id").Find(&histories).Error; err != nil {
+		log.Println("查询状态历史出错", err.Error())
+	}
+	return
+}
@@ -0,0 +1,72 @@
+package dao
+
+import (
+	"errors"
+	"testing"
+	"wxbot-lostandfound/conversation"
+)
+
+func TestTransitionRecord(t *testing.T) {
+	repository := newTestRepository(t)
+	found := addRecord(t, repository, "owner", conversation.KindFound, conversation.Form{ItemName: "雨伞", ItemTags: []string{"雨伞"}})
+
+	// 与记录无关的用户不能变更状态
+	for _, status := range Statuses {
+		if _, err := repository.TransitionRecord(found.Id, status, "other", RoleNone, ""); !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("无关用户变更为%s %v", status, err)
+		}
+	}
+	if _, err := repository.TransitionRecord(found.Id, StatusInCustody, "claimant", RoleClaimant, ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("认领人不能移交 %v", err)
+	}
+
+	record, err := repository.TransitionRecord(found.Id, StatusClaimed, "claimant", RoleClaimant, "")
+	if err != nil || record.Status != StatusClaimed {
+		t.Fatalf("认领 %v %+v", err, record)
+	}
+	record, err = repository.TransitionRecord(found.Id, StatusCompleted, "owner", RoleOwner, "已取走")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record, _ = repository.GetRecordById(found.Id); record.Status != StatusCompleted || record.CompleteUser != "owner" {
+		t.Errorf("完成后的记录 %+v", record)
+	}
+	// 已完成的记录只有管理员可以重新打开
+	if _, err := repository.TransitionRecord(found.Id, StatusOpen, "owner", RoleOwner, ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("登记人重新打开 %v", err)
+	}
+
+	histories := repository.GetStatusHistory(found.Id)
+	if len(histories) != 2 {
+		t.Fatalf("状态历史 %+v", histories)
+	}
+	if h := histories[0]; h.FromStatus != StatusOpen || h.ToStatus != StatusClaimed || h.Operator != "claimant" || h.Role != RoleClaimant {
+		t.Errorf("第一条历史 %+v", h)
+	}
+	if h := histories[1]; h.FromStatus != StatusClaimed || h.ToStatus != StatusCompleted || h.Note != "已取走" {
+		t.Errorf("第二条历史 %+v", h)
+	}
+
+	if _, err := repository.TransitionRecord(found.Id+1, StatusCompleted, "owner", RoleAdmin, ""); err == nil {
+		t.Error("不存在的记录应该报错")
+	}
+}
+
+// 丢失物品的记录不能被认领 管理员也不行
+func TestLostRecordCannotBeClaimed(t *testing.T) {
+	repository := newTestRepository(t)
+	lost := addRecord(t, repository, "owner", conversation.KindLost, conversation.Form{ItemName: "雨伞", ItemTags: []string{"雨伞"}})
+	for _, role := range []Role{RoleClaimant, RoleAdmin} {
+		if _, err := repository.TransitionRecord(lost.Id, StatusClaimed, "someone", role, ""); !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("%s认领丢失物品 %v", role, err)
+		}
+	}
+	for _, status := range NextStatuses(lost, RoleAdmin) {
+		if status == StatusClaimed {
+			t.Error("丢失物品的可选状态不应该包含已认领")
+		}
+	}
+	if len(repository.GetStatusHistory(lost.Id)) != 0 {
+		t.Error("失败的变更不应该记录历史")
+	}
+}
@@ -0,0 +1,144 @@
+package dao
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"sort"
+	"strings"
+)
+
+// 将标签合并到目标标签 目标标签不存在时创建,同时修改记录中保存的标签 返回修改的记录数
+// 只有一个标签时即为重命名
+func (r *GormRepository) MergeTags(sources []string, target string) (count int64, err error) {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return 0, fmt.Errorf("目标标签不能为空")
+	}
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		targetTag, err := upsertTag(tx, target)
+		if err != nil {
+			return err
+		}
+		renamed := map[string]struct{}{}
+		var itemIds []int64
+		for _, source := range uniqueTags(sources) {
+			if source == target {
+				continue
+			}
+			var tag Tag
+			if err := tx.Where("tag_name = ?", source).Limit(1).Find(&tag).Error; err != nil {
+				return err
+			}
+			if tag.Id == 0 {
+				return fmt.Errorf("标签%s不存在", source)
+			}
+			renamed[source] = struct{}{}
+			var ids []int64
+			if err := tx.Model(&TagItem{}).Where("tag_id = ?", tag.Id).Pluck("item_id", &ids).Error; err != nil {
+				return err
+			}
+			itemIds = append(itemIds, ids...)
+			// 已有目标标签的记录直接删除原来的关联 避免重复
+			var linked []int64
+			if err := tx.Model(&TagItem{}).Where("tag_id = ?", targetTag.Id).Pluck("item_id", &linked).Error; err != nil {
+				return err
+			}
+			if len(linked) > 0 {
+				if err := tx.Where("tag_id = ? AND item_id IN ?", tag.Id, linked).Delete(&TagItem{}).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(&TagItem{}).Where("tag_id = ?", tag.Id).Update("tag_id", targetTag.Id).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&tag).Error; err != nil {
+				return err
+			}
+		}
+		if len(itemIds) == 0 {
+			return nil
+		}
+		// 已删除的记录也要修改 恢复后标签保持一致
+		var records []ItemRecord
+		if err := tx.Unscoped().Where("id IN ?", itemIds).Find(&records).Error; err != nil {
+			return err
+		}
+		for _, record := range records {
+			tags := strings.Split(record.Tags, ",")
+			for i, tag := range tags {
+				if _, exist := renamed[strings.TrimSpace(tag)]; exist {
+					tags[i] = target
+				}
+			}
+			if err := tx.Unscoped().Model(&record).Update("tags", strings.Join(uniqueTags(tags), ",")).Error; err != nil {
+				return err
+			}
+		}
+		count = int64(len(records))
+		return nil
+	})
+	if err != nil {
+		count = 0
+	}
+	return
+}
+
+// 标签及使用该标签的记录数
+type TagUsage struct {
+	Tag
+	Count int64
+}
+
+// 所有标签的使用情况 按使用次数倒序
+func (r *GormRepository) GetTagUsage() (usages []TagUsage) {
+	if err := r.db.Model(&Tag{}).Select("tags.id, tags.tag_name, COUNT(tag_items.id) AS count").
+		Joins("LEFT JOIN tag_items ON tag_items.tag_id = tags.id").
+		Group("tags.id, tags.tag_name").Order("count DESC, tags.tag_name").Scan(&usages).Error; err != nil {
+		log.Println("查询标签出错", err.Error())
+	}
+	return
+}
+
+// 可能与记录匹配的相反类型的记录 仍在处理中且有相同的标签 按相同标签数倒序
+func (r *GormRepository) MatchCandidates(record ItemRecord, limit int) (candidates []ItemRecord) {
+	var shared []struct {
+		ItemId int64
+		Count  int64
+	}
+	if err := r.db.Model(&TagItem{}).Select("item_id, COUNT(*) AS count").
+		Where("tag_id IN (?) AND type = ?", r.db.Model(&TagItem{}).Select("tag_id").Where("item_id = ?", record.Id), record.Type.Opposite()).
+		Group("item_id").Scan(&shared).Error; err != nil {
+		log.Println("查询匹配记录出错", err.Error())
+		return
+	}
+	if len(shared) == 0 {
+		return
+	}
+	counts := make(map[int64]int64, len(shared))
+	ids := make([]int64, 0, len(shared))
+	for _, item := range shared {
+		counts[item.ItemId] = item.Count
+		ids = append(ids, item.ItemId)
+	}
+	queryDB := r.db.Where("id IN ? AND status IN ?", ids, OpenStatuses)
+	// 不同城市的记录不会匹配 没有填写城市的记录不限制
+	if record.City != "" {
+		queryDB = queryDB.Where("city = ? OR city = ''", record.City)
+	}
+	if err := queryDB.Find(&candidates).Error; err != nil {
+		log.Println("查询匹配记录出错", err.Error())
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if counts[a.Id] != counts[b.Id] {
+			return counts[a.Id] > counts[b.Id]
+		}
+		return a.Id > b.Id
+	})
+	if limit > 0 && len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return
+}
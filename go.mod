@@ -4,9 +4,13 @@ go 1.15
 
 require (
 	github.com/spf13/viper v1.8.1
+	github.com/xuri/excelize/v2 v2.4.1
 	github.com/yanyiwu/gojieba v1.1.2
+	gopkg.in/yaml.v2 v2.4.0
+	gorm.io/driver/mysql v1.2.0
+	gorm.io/driver/postgres v1.2.3
 	gorm.io/driver/sqlite v1.1.4
-	gorm.io/gorm v1.21.12
+	gorm.io/gorm v1.22.3
 )
 
 replace github.com/yanyiwu/gojieba v1.1.2 => github.com/ttys3/gojieba v1.1.3
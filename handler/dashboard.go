@@ -0,0 +1,336 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 管理后台 路径为/admin/ 管理员通过企业微信网页授权或本地密码登录
+// 可以查询、修改和完成记录,查看图片和可能匹配的记录,管理标签和地点
+
+// 管理后台配置
+type DashboardConfig struct {
+	Password       string   // 本地登录密码 为空时只能通过企业微信登录
+	SessionHours   int      // 登录的有效时间 默认为8小时
+	TrustedProxies []string // 可信的反向代理地址 来自本机和这些地址的请求才使用X-Forwarded-For判断来源IP
+}
+
+// 企业微信网页授权 由bot实现
+type OAuth interface {
+	AuthorizeUrl(redirectUri string, state string) string
+	UserId(code string) (string, error)
+}
+
+// 本地密码登录的用户 记录在状态历史和修改历史中
+const localAdmin = "admin"
+
+const (
+	sessionCookie   = "admin_session"
+	stateCookie     = "admin_oauth_state"
+	loginCsrfCookie = "admin_login_csrf"
+)
+
+// 同一IP在窗口内密码错误达到次数后 直到窗口结束都不能再用密码登录
+const (
+	maxLoginFailures   = 5
+	loginFailureWindow = 15 * time.Minute
+)
+
+type session struct {
+	User    string
+	Csrf    string // 提交表单时需要带上的令牌 其他站点无法读取
+	Expires time.Time
+}
+
+// 密码登录失败的次数 从窗口内第一次失败开始计算
+type loginFailure struct {
+	Count int
+	Since time.Time
+}
+
+// 请求上下文中当前会话的表单令牌
+type csrfKey struct{}
+
+type Dashboard struct {
+	config   DashboardConfig
+	isAdmin  func(userName string) bool
+	oauth    OAuth
+	mux      *http.ServeMux
+	lock     sync.Mutex
+	sessions map[string]session       // 登录后的会话 重启后需要重新登录
+	failures map[string]*loginFailure // 按IP记录的登录失败
+}
+
+// 需要登录的页面 user为当前登录的用户
+type dashboardHandler func(w http.ResponseWriter, r *http.Request, user string)
+
+// isAdmin判断企业微信用户是否为管理员 oauth为空时不能通过企业微信登录
+func NewDashboard(config DashboardConfig, isAdmin func(userName string) bool, oauth OAuth) *Dashboard {
+	if config.SessionHours <= 0 {
+		config.SessionHours = 8
+	}
+	d := &Dashboard{config: config, isAdmin: isAdmin, oauth: oauth, mux: http.NewServeMux(),
+		sessions: map[string]session{}, failures: map[string]*loginFailure{}}
+	d.mux.HandleFunc("/admin/login", d.login)
+	d.mux.HandleFunc("/admin/logout", d.protect(d.logout))
+	d.mux.HandleFunc("/admin/oauth", d.oauthStart)
+	d.mux.HandleFunc("/admin/oauth/callback", d.oauthCallback)
+	d.mux.HandleFunc("/admin/", d.protect(d.recordList))
+	d.mux.HandleFunc("/admin/records/", d.protect(d.record))
+	d.mux.HandleFunc("/admin/tags", d.protect(d.tags))
+	d.mux.HandleFunc("/admin/locations", d.protect(d.locations))
+	return d
+}
+
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 页面中的表单只提交到后台自身 禁止被其他页面嵌入
+	w.Header().Set("X-Frame-Options", "DENY")
+	d.mux.ServeHTTP(w, r)
+}
+
+// 未登录时跳转到登录页 提交的表单需要带上会话的令牌
+func (d *Dashboard) protect(handler dashboardHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s, ok := d.currentSession(r)
+		if !ok {
+			http.Redirect(w, r, "/admin/login", http.StatusFound)
+			return
+		}
+		if r.Method == http.MethodPost && !tokenEqual(r.PostFormValue("csrf"), s.Csrf) {
+			log.Printf("管理员%s提交的表单令牌无效 %s %s\n", s.User, r.URL.Path, r.Header.Get("Referer"))
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		handler(w, r.WithContext(context.WithValue(r.Context(), csrfKey{}, s.Csrf)), s.User)
+	}
+}
+
+func (d *Dashboard) currentSession(r *http.Request) (session, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return session{}, false
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	s, exist := d.sessions[cookie.Value]
+	if !exist {
+		return session{}, false
+	}
+	if time.Now().After(s.Expires) {
+		delete(d.sessions, cookie.Value)
+		return session{}, false
+	}
+	return s, true
+}
+
+// 页面中表单使用的令牌 未登录时为空
+func csrfToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfKey{}).(string)
+	return token
+}
+
+func tokenEqual(token string, expected string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// 创建会话并跳转到记录列表
+func (d *Dashboard) startSession(w http.ResponseWriter, r *http.Request, user string) {
+	token := randomToken()
+	expires := time.Now().Add(time.Duration(d.config.SessionHours) * time.Hour)
+	d.lock.Lock()
+	// 顺便清理过期的会话
+	for key, s := range d.sessions {
+		if time.Now().After(s.Expires) {
+			delete(d.sessions, key)
+		}
+	}
+	d.sessions[token] = session{User: user, Csrf: randomToken(), Expires: expires}
+	d.lock.Unlock()
+	http.SetCookie(w, d.cookie(sessionCookie, token, expires))
+	log.Printf("管理员%s登录管理后台\n", user)
+	http.Redirect(w, r, "/admin/", http.StatusSeeOther)
+}
+
+// 只在后台路径下发送 SameSite=Lax时其他站点提交的表单不会带上cookie
+// 不使用Strict 从企业微信授权页跳转回来时需要带上cookie
+func (d *Dashboard) cookie(name string, value string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/admin",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(BaseUrl, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func randomToken() string {
+	buffer := make([]byte, 32)
+	if _, err := rand.Read(buffer); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buffer)
+}
+
+// 登录页 本地密码登录
+// 登录表单的令牌保存在cookie中 同一IP密码错误次数过多时暂时锁定
+func (d *Dashboard) login(w http.ResponseWriter, r *http.Request) {
+	page := d.loginPage(w, r, d.oauth != nil)
+	if r.Method == http.MethodPost {
+		ip := d.clientIP(r)
+		cookie, err := r.Cookie(loginCsrfCookie)
+		switch {
+		case err != nil || !tokenEqual(r.PostFormValue("csrf"), cookie.Value):
+			page.Error = "dashboard_login_failed"
+			w.WriteHeader(http.StatusForbidden)
+		case d.loginLocked(ip):
+			log.Println("管理后台密码错误次数过多", ip)
+			page.Error = "dashboard_login_locked"
+			w.WriteHeader(http.StatusTooManyRequests)
+		case d.config.Password != "" && subtle.ConstantTimeCompare([]byte(r.PostFormValue("password")), []byte(d.config.Password)) == 1:
+			d.lock.Lock()
+			delete(d.failures, ip)
+			d.lock.Unlock()
+			d.startSession(w, r, localAdmin)
+			return
+		default:
+			log.Println("管理后台密码错误", ip)
+			d.addLoginFailure(ip)
+			page.Error = "dashboard_login_failed"
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}
+	render(w, "login", page)
+}
+
+// 登录页的内容 没有登录表单令牌时生成
+func (d *Dashboard) loginPage(w http.ResponseWriter, r *http.Request, oauth bool) loginPage {
+	page := loginPage{dashboardPage: newDashboardPage(r, ""), Password: d.config.Password != "", OAuth: oauth}
+	if cookie, err := r.Cookie(loginCsrfCookie); err == nil && cookie.Value != "" {
+		page.Csrf = cookie.Value
+	} else {
+		page.Csrf = randomToken()
+	}
+	http.SetCookie(w, d.cookie(loginCsrfCookie, page.Csrf, time.Now().Add(time.Duration(d.config.SessionHours)*time.Hour)))
+	return page
+}
+
+func (d *Dashboard) loginLocked(ip string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	failure, exist := d.failures[ip]
+	return exist && failure.Count >= maxLoginFailures && time.Since(failure.Since) < loginFailureWindow
+}
+
+func (d *Dashboard) addLoginFailure(ip string) {
+	now := time.Now()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	// 顺便清理窗口已经结束的记录
+	for key, failure := range d.failures {
+		if now.Sub(failure.Since) >= loginFailureWindow {
+			delete(d.failures, key)
+		}
+	}
+	if failure, exist := d.failures[ip]; exist {
+		failure.Count++
+		return
+	}
+	d.failures[ip] = &loginFailure{Count: 1, Since: now}
+}
+
+// 请求的来源IP 只有来自本机或配置的反向代理的请求才使用代理添加的最后一个X-Forwarded-For
+// 直接访问时X-Forwarded-For可以被客户端任意伪造
+func (d *Dashboard) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	forwarded := r.Header.Get("X-Forwarded-For")
+	if forwarded == "" || !d.trustedProxy(host) {
+		return host
+	}
+	parts := strings.Split(forwarded, ",")
+	if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+		return ip
+	}
+	return host
+}
+
+func (d *Dashboard) trustedProxy(host string) bool {
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	for _, proxy := range d.config.TrustedProxies {
+		if proxy == host {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Dashboard) logout(w http.ResponseWriter, r *http.Request, user string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		d.lock.Lock()
+		delete(d.sessions, cookie.Value)
+		d.lock.Unlock()
+	}
+	http.SetCookie(w, d.cookie(sessionCookie, "", time.Unix(0, 0)))
+	http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+}
+
+// 跳转到企业微信网页授权 state保存在cookie中用于校验回调
+func (d *Dashboard) oauthStart(w http.ResponseWriter, r *http.Request) {
+	if d.oauth == nil {
+		http.NotFound(w, r)
+		return
+	}
+	state := randomToken()
+	http.SetCookie(w, d.cookie(stateCookie, state, time.Now().Add(10*time.Minute)))
+	http.Redirect(w, r, d.oauth.AuthorizeUrl(BaseUrl+"/admin/oauth/callback", state), http.StatusFound)
+}
+
+func (d *Dashboard) oauthCallback(w http.ResponseWriter, r *http.Request) {
+	if d.oauth == nil {
+		http.NotFound(w, r)
+		return
+	}
+	page := d.loginPage(w, r, true)
+	state, err := r.Cookie(stateCookie)
+	if err != nil || state.Value == "" || state.Value != r.URL.Query().Get("state") {
+		page.Error = "dashboard_login_failed"
+		w.WriteHeader(http.StatusBadRequest)
+		render(w, "login", page)
+		return
+	}
+	http.SetCookie(w, d.cookie(stateCookie, "", time.Unix(0, 0)))
+	user, err := d.oauth.UserId(r.URL.Query().Get("code"))
+	if err != nil {
+		log.Println("企业微信网页授权出错", err.Error())
+		page.Error = "dashboard_login_failed"
+		w.WriteHeader(http.StatusUnauthorized)
+		render(w, "login", page)
+		return
+	}
+	if !d.isAdmin(user) {
+		log.Printf("非管理员%s尝试登录管理后台\n", user)
+		page.Error = "dashboard_not_admin"
+		w.WriteHeader(http.StatusForbidden)
+		render(w, "login", page)
+		return
+	}
+	d.startSession(w, r, user)
+}
@@ -0,0 +1,312 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/dao"
+	"wxbot-lostandfound/i18n"
+	"wxbot-lostandfound/utils"
+)
+
+// 列表页最多展示的记录数
+const dashboardPageSize = 100
+
+// 记录详情页最多展示的匹配记录数
+const maxCandidates = 10
+
+// 所有页面共用的内容 Msg和Error为文案的key
+type dashboardPage struct {
+	Lang  string
+	User  string
+	Csrf  string // POST表单中的令牌
+	Msg   string
+	Error string
+}
+
+// 页面使用登录用户设置的语言 操作结果通过跳转参数传递
+func newDashboardPage(r *http.Request, user string) dashboardPage {
+	page := dashboardPage{Lang: i18n.DefaultLanguage, User: user, Csrf: csrfToken(r)}
+	if user != "" {
+		if lang := repo.GetUserSetting(user).Language; i18n.Supported(lang) {
+			page.Lang = lang
+		}
+	}
+	// 只接受后台自己的文案 避免通过链接展示任意内容
+	if msg := r.URL.Query().Get("msg"); strings.HasPrefix(msg, "dashboard_msg_") {
+		page.Msg = msg
+	}
+	if e := r.URL.Query().Get("error"); strings.HasPrefix(e, "dashboard_err_") {
+		page.Error = e
+	}
+	return page
+}
+
+type loginPage struct {
+	dashboardPage
+	Password bool // 是否可以使用密码登录
+	OAuth    bool
+}
+
+type recordListPage struct {
+	dashboardPage
+	Keyword  string
+	Type     string
+	Status   string
+	Location string
+	Statuses []dao.RecordStatus
+	Records  []dao.ItemRecord
+	Total    int
+}
+
+type recordPage struct {
+	dashboardPage
+	Record       dao.ItemRecord
+	Histories    []dao.RecordStatusHistory
+	Custody      []dao.CustodyRecord
+	Revisions    []dao.RecordRevision
+	Candidates   []dao.ItemRecord
+	NextStatuses []dao.RecordStatus
+	Locations    []utils.LocationPath
+}
+
+type tagsPage struct {
+	dashboardPage
+	Tags []dao.TagUsage
+}
+
+type locationsPage struct {
+	dashboardPage
+	Locations []utils.LocationPath
+}
+
+// 操作完成后跳转 避免刷新页面时重复提交
+func redirectResult(w http.ResponseWriter, r *http.Request, path string, param string, key string) {
+	http.Redirect(w, r, path+"?"+url.Values{param: {key}}.Encode(), http.StatusSeeOther)
+}
+
+// 记录列表 可以按关键词、类型、状态和地点筛选
+func (d *Dashboard) recordList(w http.ResponseWriter, r *http.Request, user string) {
+	if r.URL.Path != "/admin/" {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query()
+	page := recordListPage{
+		dashboardPage: newDashboardPage(r, user),
+		Keyword:       strings.TrimSpace(query.Get("keyword")),
+		Type:          query.Get("type"),
+		Status:        query.Get("status"),
+		Location:      strings.TrimSpace(query.Get("location")),
+		Statuses:      dao.Statuses,
+	}
+	filter := dao.RecordFilter{Keyword: page.Keyword, Location: page.Location}
+	if kind, err := conversation.ParseKind(page.Type); err == nil {
+		filter.Type = kind
+	}
+	if status := dao.RecordStatus(page.Status); status.IsValid() {
+		filter.Statuses = []dao.RecordStatus{status}
+	}
+	page.Records = repo.GetRecord(filter)
+	sort.Slice(page.Records, func(i, j int) bool { return page.Records[i].Id > page.Records[j].Id })
+	page.Total = len(page.Records)
+	if page.Total > dashboardPageSize {
+		page.Records = page.Records[:dashboardPageSize]
+	}
+	render(w, "records", page)
+}
+
+// 记录详情 路径为/admin/records/{id} 修改和变更状态提交到同一路径
+func (d *Dashboard) record(w http.ResponseWriter, r *http.Request, user string) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/admin/records/"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method == http.MethodPost {
+		d.updateRecord(w, r, user, id)
+		return
+	}
+	record, err := repo.GetRecordById(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	render(w, "record", recordPage{
+		dashboardPage: newDashboardPage(r, user),
+		Record:        record,
+		Histories:     repo.GetStatusHistory(id),
+		Custody:       repo.GetCustodyRecords(id),
+		Revisions:     repo.GetRevisions(id),
+		Candidates:    repo.MatchCandidates(record, maxCandidates),
+		NextStatuses:  dao.NextStatuses(record, dao.RoleAdmin),
+		Locations:     utils.LocationPaths(),
+	})
+}
+
+func (d *Dashboard) updateRecord(w http.ResponseWriter, r *http.Request, user string, id int64) {
+	path := fmt.Sprintf("/admin/records/%d", id)
+	var err error
+	var msg string
+	switch r.PostFormValue("action") {
+	case "edit":
+		itemName := strings.TrimSpace(r.PostFormValue("item_name"))
+		if itemName == "" {
+			redirectResult(w, r, path, "error", "dashboard_err_name")
+			return
+		}
+		var location *utils.Location
+		if locationPath := strings.TrimSpace(r.PostFormValue("location")); locationPath != "" {
+			if location = utils.FindLocation(locationPath); location == nil {
+				redirectResult(w, r, path, "error", "dashboard_err_location")
+				return
+			}
+		}
+		_, err = repo.UpdateRecord(id, user, func(record *dao.ItemRecord) {
+			record.ItemName = itemName
+			record.Description = strings.TrimSpace(r.PostFormValue("description"))
+			record.PickupLocation = strings.TrimSpace(r.PostFormValue("pickup_location"))
+			tags := strings.Fields(strings.NewReplacer(",", " ", "，", " ").Replace(r.PostFormValue("tags")))
+			// 修改标签后和登记时一样根据标签判断是否为敏感物品 未修改标签时保留登记人的选择
+			if joined := strings.Join(tags, ","); joined != record.Tags {
+				record.Tags = joined
+				record.Sensitive = utils.IsSensitive(tags)
+			}
+			record.Location = ""
+			if location != nil {
+				record.City = location.City()
+				record.Location = location.Path()
+			}
+		})
+		msg = "dashboard_msg_saved"
+	case "status":
+		_, err = repo.TransitionRecord(id, dao.RecordStatus(r.PostFormValue("status")), user, dao.RoleAdmin, strings.TrimSpace(r.PostFormValue("note")))
+		msg = "dashboard_msg_status"
+	default:
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, dao.ErrInvalidTransition) {
+		redirectResult(w, r, path, "error", "dashboard_err_transition")
+		return
+	}
+	if err != nil {
+		log.Printf("管理后台修改记录%d出错 %s\n", id, err.Error())
+		redirectResult(w, r, path, "error", "dashboard_err_save")
+		return
+	}
+	redirectResult(w, r, path, "msg", msg)
+}
+
+// 标签列表 选中多个标签合并为一个 只选中一个时即为重命名
+func (d *Dashboard) tags(w http.ResponseWriter, r *http.Request, user string) {
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sources, target := r.PostForm["tag"], strings.TrimSpace(r.PostFormValue("target"))
+		if len(sources) == 0 || target == "" {
+			redirectResult(w, r, "/admin/tags", "error", "dashboard_err_merge")
+			return
+		}
+		if _, err := repo.MergeTags(sources, target); err != nil {
+			log.Println("管理后台合并标签出错", err.Error())
+			redirectResult(w, r, "/admin/tags", "error", "dashboard_err_merge")
+			return
+		}
+		redirectResult(w, r, "/admin/tags", "msg", "dashboard_msg_merged")
+		return
+	}
+	render(w, "tags", tagsPage{dashboardPage: newDashboardPage(r, user), Tags: repo.GetTagUsage()})
+}
+
+// 地点层级 添加地点或修改坐标,删除地点时同时删除下级地点
+// 修改后保存到数据库并立即生效 之后启动时不再使用配置中的地点
+func (d *Dashboard) locations(w http.ResponseWriter, r *http.Request, user string) {
+	if r.Method != http.MethodPost {
+		render(w, "locations", locationsPage{dashboardPage: newDashboardPage(r, user), Locations: utils.LocationPaths()})
+		return
+	}
+	path, errKey := normalizeLocationPath(r.PostFormValue("path"))
+	if errKey != "" {
+		redirectResult(w, r, "/admin/locations", "error", errKey)
+		return
+	}
+	paths := utils.LocationPaths()
+	var msg string
+	switch r.PostFormValue("action") {
+	case "save":
+		latitude, latErr := parseCoordinate(r.PostFormValue("latitude"), 90)
+		longitude, lngErr := parseCoordinate(r.PostFormValue("longitude"), 180)
+		if latErr != nil || lngErr != nil {
+			redirectResult(w, r, "/admin/locations", "error", "dashboard_err_coordinate")
+			return
+		}
+		saved := false
+		for i := range paths {
+			if paths[i].Path == path {
+				paths[i].Latitude, paths[i].Longitude = latitude, longitude
+				saved = true
+			}
+		}
+		if !saved {
+			paths = append(paths, utils.LocationPath{Path: path, Latitude: latitude, Longitude: longitude})
+		}
+		msg = "dashboard_msg_location_saved"
+	case "delete":
+		remaining := paths[:0]
+		for _, location := range paths {
+			if location.Path != path && !strings.HasPrefix(location.Path, path+utils.LocationSeparator) {
+				remaining = append(remaining, location)
+			}
+		}
+		if len(remaining) == 0 {
+			redirectResult(w, r, "/admin/locations", "error", "dashboard_err_last_location")
+			return
+		}
+		paths = remaining
+		msg = "dashboard_msg_location_deleted"
+	default:
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// 保存成功后再替换当前的地点层级 缺少的上级地点在创建层级时自动补充
+	if err := repo.ReplaceLocations(paths); err != nil {
+		log.Println("管理后台保存地点出错", err.Error())
+		redirectResult(w, r, "/admin/locations", "error", "dashboard_err_save")
+		return
+	}
+	utils.SetLocations(utils.BuildLocations(paths))
+	log.Printf("管理员%s修改了地点 %s\n", user, path)
+	redirectResult(w, r, "/admin/locations", "msg", msg)
+}
+
+// 去除每一级名称两边的空白 任何一级为空时无效
+func normalizeLocationPath(path string) (string, string) {
+	names := strings.Split(path, utils.LocationSeparator)
+	for i, name := range names {
+		if names[i] = strings.TrimSpace(name); names[i] == "" {
+			return "", "dashboard_err_path"
+		}
+	}
+	return strings.Join(names, utils.LocationSeparator), ""
+}
+
+// 坐标为空时为0 即不设置坐标
+func parseCoordinate(text string, limit float64) (float64, error) {
+	if text = strings.TrimSpace(text); text == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err == nil && (value < -limit || value > limit) {
+		err = fmt.Errorf("坐标超出范围 %s", text)
+	}
+	return value, err
+}
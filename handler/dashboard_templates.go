@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/dao"
+	"wxbot-lostandfound/i18n"
+	"wxbot-lostandfound/utils"
+)
+
+var dashboardFuncs = template.FuncMap{
+	// 文案 第三个参数为模板参数
+	"t": func(lang string, key string, data ...interface{}) string {
+		return i18n.T(lang, key, data...)
+	},
+	"status": func(lang string, status dao.RecordStatus) string {
+		return StatusName(status, lang)
+	},
+	"kind": func(lang string, kind conversation.RecordKind) string {
+		return kind.DisplayName(lang)
+	},
+	"time": func(t interface{}) string {
+		switch value := t.(type) {
+		case time.Time:
+			return utils.FormatTime(value)
+		case *time.Time:
+			if value != nil {
+				return utils.FormatTime(*value)
+			}
+		}
+		return ""
+	},
+	// 管理员可以看到敏感物品的图片 使用相对路径
+	"img": imagePath,
+	// 地点的层级 用于缩进
+	"depth": func(path string) int {
+		return strings.Count(path, utils.LocationSeparator)
+	},
+}
+
+var dashboardTemplates = template.Must(template.New("dashboard").Funcs(dashboardFuncs).Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{t .Lang "dashboard_title"}}</title>
+<style>
+body { font-family: -apple-system, "PingFang SC", sans-serif; margin: 0; color: #333; }
+nav { background: #2b3a4a; padding: 12px 16px; }
+nav a, nav button { color: #fff; margin-right: 16px; text-decoration: none; background: none; border: none; font-size: 16px; cursor: pointer; }
+nav form { display: inline; float: right; }
+main { padding: 16px; }
+table { border-collapse: collapse; width: 100%; margin: 12px 0; }
+th, td { border-bottom: 1px solid #eee; padding: 6px 8px; text-align: left; vertical-align: top; }
+th { color: #999; font-weight: normal; }
+dt { color: #999; font-size: 14px; margin-top: 12px; }
+dd { margin: 4px 0 0 0; }
+img { max-width: 360px; margin-top: 16px; }
+input[type=text], input[type=password], textarea, select { padding: 4px; margin: 2px 4px 2px 0; }
+textarea { width: 360px; height: 60px; }
+section { margin-top: 24px; }
+.msg { color: #5cb85c; }
+.error { color: #d9534f; }
+.comment { color: #999; font-size: 14px; }
+</style>
+</head>
+<body>
+{{if .User}}<nav>
+<a href="/admin/">{{t .Lang "dashboard_records"}}</a>
+<a href="/admin/tags">{{t .Lang "dashboard_tags"}}</a>
+<a href="/admin/locations">{{t .Lang "dashboard_locations"}}</a>
+<form method="post" action="/admin/logout"><input type="hidden" name="csrf" value="{{.Csrf}}"><span class="comment">{{.User}}</span> <button type="submit">{{t .Lang "dashboard_logout"}}</button></form>
+</nav>{{end}}
+<main>
+{{if .Msg}}<p class="msg">{{t .Lang .Msg}}</p>{{end}}
+{{if .Error}}<p class="error">{{t .Lang .Error}}</p>{{end}}
+{{end}}
+
+{{define "footer"}}</main>
+</body>
+</html>
+{{end}}
+
+{{define "login"}}{{template "header" .}}
+<h1>{{t .Lang "dashboard_title"}}</h1>
+{{if .Password}}<form method="post" action="/admin/login">
+<input type="hidden" name="csrf" value="{{$.Csrf}}">
+<input type="password" name="password" placeholder="{{t .Lang "dashboard_password"}}" autofocus>
+<button type="submit">{{t .Lang "dashboard_login"}}</button>
+</form>{{end}}
+{{if .OAuth}}<p><a href="/admin/oauth">{{t .Lang "dashboard_login_oauth"}}</a></p>{{end}}
+{{template "footer" .}}{{end}}
+
+{{define "records"}}{{template "header" .}}
+<form method="get" action="/admin/">
+<input type="text" name="keyword" value="{{.Keyword}}" placeholder="{{t .Lang "dashboard_keyword"}}">
+<select name="type">
+<option value="">{{t .Lang "dashboard_all"}}</option>
+<option value="lost"{{if eq .Type "lost"}} selected{{end}}>{{t .Lang "kind_lost"}}</option>
+<option value="found"{{if eq .Type "found"}} selected{{end}}>{{t .Lang "kind_found"}}</option>
+</select>
+<select name="status">
+<option value="">{{t .Lang "dashboard_all"}}</option>
+{{range .Statuses}}<option value="{{.}}"{{if eq (print .) $.Status}} selected{{end}}>{{status $.Lang .}}</option>{{end}}
+</select>
+<input type="text" name="location" value="{{.Location}}" placeholder="{{t .Lang "label_location"}}">
+<button type="submit">{{t .Lang "dashboard_search"}}</button>
+</form>
+<p class="comment">{{t .Lang "dashboard_total" .}}</p>
+{{if .Records}}<table>
+<tr><th>{{t .Lang "label_id"}}</th><th>{{t .Lang "dashboard_kind"}}</th><th>{{t .Lang "dashboard_item_name"}}</th><th>{{t .Lang "label_location"}}</th><th>{{t .Lang "label_status"}}</th><th>{{t .Lang "dashboard_user"}}</th><th>{{t .Lang "dashboard_created"}}</th></tr>
+{{range .Records}}<tr>
+<td><a href="/admin/records/{{.Id}}">{{.Id}}</a></td>
+<td>{{kind $.Lang .Type}}</td>
+<td><a href="/admin/records/{{.Id}}">{{.ItemName}}</a></td>
+<td>{{if .Location}}{{.Location}}{{else}}{{.City}}{{end}}</td>
+<td>{{status $.Lang .Status}}</td>
+<td>{{.User}}</td>
+<td>{{time .CreatedAt}}</td>
+</tr>{{end}}
+</table>{{else}}<p>{{t .Lang "dashboard_empty"}}</p>{{end}}
+{{template "footer" .}}{{end}}
+
+{{define "record"}}{{template "header" .}}
+{{with .Record}}
+<h1>{{.Id}} {{kind $.Lang .Type}} - {{.ItemName}}</h1>
+<dl>
+<dt>{{t $.Lang "label_status"}}</dt><dd>{{status $.Lang .Status}}</dd>
+<dt>{{t $.Lang "label_location"}}</dt><dd>{{if .Location}}{{.Location}}{{else}}{{.City}}{{end}}</dd>
+{{if .LocationLabel}}<dt>{{t $.Lang "label_position"}}</dt><dd>{{.LocationLabel}}</dd>{{end}}
+{{if .OccurredAt}}<dt>{{t $.Lang "label_time"}}</dt><dd>{{time .OccurredAt}}</dd>{{end}}
+<dt>{{t $.Lang "label_description"}}</dt><dd>{{.Description}}</dd>
+{{if .PickupLocation}}<dt>{{t $.Lang "label_pickup"}}</dt><dd>{{.PickupLocation}}</dd>{{end}}
+<dt>{{t $.Lang "label_tags"}}</dt><dd>{{.Tags}}</dd>
+<dt>{{t $.Lang "dashboard_user"}}</dt><dd>{{.User}}</dd>
+{{if .CompleteUser}}<dt>{{t $.Lang "dashboard_complete_user"}}</dt><dd>{{.CompleteUser}}</dd>{{end}}
+{{if .VerifyQuestion}}<dt>{{t $.Lang "dashboard_verify"}}</dt><dd>{{.VerifyQuestion}} / {{.VerifyAnswer}}</dd>{{end}}
+<dt>{{t $.Lang "dashboard_created"}}</dt><dd>{{time .CreatedAt}}</dd>
+</dl>
+{{if .ImgName}}<a href="{{img .ImgName}}" target="_blank"><img src="{{img .ImgName}}" alt="{{.ItemName}}"></a>{{end}}
+
+<section>
+<h2>{{t $.Lang "dashboard_change_status"}}</h2>
+{{if $.NextStatuses}}<form method="post" action="/admin/records/{{.Id}}">
+<input type="hidden" name="csrf" value="{{$.Csrf}}">
+<input type="hidden" name="action" value="status">
+<select name="status">{{range $.NextStatuses}}<option value="{{.}}">{{status $.Lang .}}</option>{{end}}</select>
+<input type="text" name="note" placeholder="{{t $.Lang "dashboard_note"}}">
+<button type="submit">{{t $.Lang "dashboard_save"}}</button>
+</form>{{else}}<p class="comment">{{t $.Lang "dashboard_no_status"}}</p>{{end}}
+</section>
+
+<section>
+<h2>{{t $.Lang "dashboard_edit"}}</h2>
+<form method="post" action="/admin/records/{{.Id}}">
+<input type="hidden" name="csrf" value="{{$.Csrf}}">
+<input type="hidden" name="action" value="edit">
+<dl>
+<dt>{{t $.Lang "dashboard_item_name"}}</dt><dd><input type="text" name="item_name" value="{{.ItemName}}"></dd>
+<dt>{{t $.Lang "label_location"}}</dt><dd><input type="text" name="location" value="{{.Location}}" list="locations"></dd>
+<dt>{{t $.Lang "label_pickup"}}</dt><dd><input type="text" name="pickup_location" value="{{.PickupLocation}}"></dd>
+<dt>{{t $.Lang "label_tags"}}</dt><dd><input type="text" name="tags" value="{{.Tags}}"></dd>
+<dt>{{t $.Lang "label_description"}}</dt><dd><textarea name="description">{{.Description}}</textarea></dd>
+</dl>
+<datalist id="locations">{{range $.Locations}}<option value="{{.Path}}">{{end}}</datalist>
+<button type="submit">{{t $.Lang "dashboard_save"}}</button>
+</form>
+</section>
+{{end}}
+
+<section>
+<h2>{{t .Lang "dashboard_candidates"}}</h2>
+{{if .Candidates}}<table>
+{{range .Candidates}}<tr>
+<td><a href="/admin/records/{{.Id}}">{{.Id}}</a></td>
+<td>{{kind $.Lang .Type}}</td>
+<td><a href="/admin/records/{{.Id}}">{{.ItemName}}</a></td>
+<td>{{if .Location}}{{.Location}}{{else}}{{.City}}{{end}}</td>
+<td>{{.Tags}}</td>
+<td>{{status $.Lang .Status}}</td>
+<td>{{time .CreatedAt}}</td>
+</tr>{{end}}
+</table>{{else}}<p class="comment">{{t .Lang "dashboard_no_candidates"}}</p>{{end}}
+</section>
+
+{{if .Histories}}<section>
+<h2>{{t .Lang "dashboard_history"}}</h2>
+<table>
+{{range .Histories}}<tr><td>{{time .CreatedAt}}</td><td>{{status $.Lang .FromStatus}} → {{status $.Lang .ToStatus}}</td><td>{{.Operator}}</td><td>{{.Note}}</td></tr>{{end}}
+</table>
+</section>{{end}}
+
+{{if .Custody}}<section>
+<h2>{{t .Lang "dashboard_custody"}}</h2>
+<table>
+{{range .Custody}}<tr><td>{{time .CreatedAt}}</td><td>{{.FromLocation}} → {{.ToLocation}}</td><td>{{.Operator}}</td><td>{{.Note}}</td></tr>{{end}}
+</table>
+</section>{{end}}
+
+{{if .Revisions}}<section>
+<h2>{{t .Lang "dashboard_revisions"}}</h2>
+<table>
+{{range .Revisions}}<tr><td>v{{.Version}}</td><td>{{time .CreatedAt}}</td><td>{{t $.Lang (print "revision_action_" .Action)}}</td><td>{{.Editor}}</td></tr>{{end}}
+</table>
+</section>{{end}}
+{{template "footer" .}}{{end}}
+
+{{define "tags"}}{{template "header" .}}
+<form method="post" action="/admin/tags">
+<input type="hidden" name="csrf" value="{{$.Csrf}}">
+<p>
+<input type="text" name="target" placeholder="{{t .Lang "dashboard_merge_target"}}">
+<button type="submit">{{t .Lang "dashboard_merge"}}</button>
+</p>
+<p class="comment">{{t .Lang "dashboard_merge_hint"}}</p>
+{{if .Tags}}<table>
+<tr><th></th><th>{{t .Lang "label_tags"}}</th><th>{{t .Lang "dashboard_tag_count"}}</th></tr>
+{{range .Tags}}<tr>
+<td><input type="checkbox" name="tag" value="{{.TagName}}"></td>
+<td><a href="/admin/?keyword={{.TagName}}">{{.TagName}}</a></td>
+<td>{{.Count}}</td>
+</tr>{{end}}
+</table>{{else}}<p>{{t .Lang "no_tags"}}</p>{{end}}
+</form>
+{{template "footer" .}}{{end}}
+
+{{define "locations"}}{{template "header" .}}
+<form method="post" action="/admin/locations">
+<input type="hidden" name="csrf" value="{{$.Csrf}}">
+<input type="hidden" name="action" value="save">
+<input type="text" name="path" placeholder="{{t .Lang "dashboard_path"}}">
+<input type="text" name="latitude" placeholder="{{t .Lang "dashboard_latitude"}}">
+<input type="text" name="longitude" placeholder="{{t .Lang "dashboard_longitude"}}">
+<button type="submit">{{t .Lang "dashboard_save"}}</button>
+</form>
+<p class="comment">{{t .Lang "dashboard_location_hint"}}</p>
+<table>
+<tr><th>{{t .Lang "dashboard_path"}}</th><th>{{t .Lang "dashboard_latitude"}}</th><th>{{t .Lang "dashboard_longitude"}}</th><th></th></tr>
+{{range .Locations}}<tr>
+<td style="padding-left: {{depth .Path}}em"><a href="/admin/?location={{.Path}}">{{.Path}}</a></td>
+<td>{{if or .Latitude .Longitude}}{{.Latitude}}{{end}}</td>
+<td>{{if or .Latitude .Longitude}}{{.Longitude}}{{end}}</td>
+<td><form method="post" action="/admin/locations" onsubmit="return confirm({{t $.Lang "dashboard_delete_confirm" .}})">
+<input type="hidden" name="csrf" value="{{$.Csrf}}">
+<input type="hidden" name="action" value="delete">
+<input type="hidden" name="path" value="{{.Path}}">
+<button type="submit">{{t $.Lang "dashboard_delete"}}</button>
+</form></td>
+</tr>{{end}}
+</table>
+{{template "footer" .}}{{end}}
+`))
+
+func render(w http.ResponseWriter, name string, page interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplates.ExecuteTemplate(w, name, page); err != nil {
+		log.Printf("渲染管理后台页面%s出错 %s\n", name, err.Error())
+	}
+}
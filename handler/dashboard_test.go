@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/dao"
+	"wxbot-lostandfound/i18n"
+)
+
+var csrfInput = regexp.MustCompile(`name="csrf" value="([0-9a-f]+)"`)
+
+func newTestDashboard(t *testing.T) *Dashboard {
+	if err := i18n.Load("../locales", "zh"); err != nil {
+		t.Fatal(err)
+	}
+	repository, err := dao.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetRepository(repository)
+	return NewDashboard(DashboardConfig{Password: "secret"}, func(string) bool { return false }, nil)
+}
+
+// 发送请求 cookies中保存返回的cookie
+func serve(d *Dashboard, method string, path string, form url.Values, cookies map[string]string, ip string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	if method == http.MethodPost {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	r.RemoteAddr = ip + ":12345"
+	for name, value := range cookies {
+		r.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, r)
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie.Value
+	}
+	return w
+}
+
+func formToken(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	match := csrfInput.FindStringSubmatch(w.Body.String())
+	if match == nil {
+		t.Fatalf("页面中没有表单令牌 %s", w.Body.String())
+	}
+	return match[1]
+}
+
+func TestDashboardCsrf(t *testing.T) {
+	d := newTestDashboard(t)
+	cookies := map[string]string{}
+	loginToken := formToken(t, serve(d, http.MethodGet, "/admin/login", nil, cookies, "10.0.0.1"))
+	if cookies[loginCsrfCookie] != loginToken {
+		t.Fatalf("登录表单令牌与cookie不一致 %v", cookies)
+	}
+	if w := serve(d, http.MethodPost, "/admin/login", url.Values{"password": {"secret"}}, cookies, "10.0.0.1"); w.Code != http.StatusForbidden {
+		t.Errorf("登录时没有令牌 %d", w.Code)
+	}
+	if w := serve(d, http.MethodPost, "/admin/login", url.Values{"password": {"secret"}, "csrf": {loginToken}}, cookies, "10.0.0.1"); w.Code != http.StatusSeeOther || cookies[sessionCookie] == "" {
+		t.Fatalf("登录 %d %v", w.Code, cookies)
+	}
+
+	token := formToken(t, serve(d, http.MethodGet, "/admin/tags", nil, cookies, "10.0.0.1"))
+	if token == loginToken {
+		t.Error("登录后应该使用会话的令牌")
+	}
+	merge := url.Values{"tag": {"雨伞"}, "target": {"伞"}}
+	for _, invalid := range []string{"", loginToken, strings.Repeat("0", len(token))} {
+		merge.Set("csrf", invalid)
+		if w := serve(d, http.MethodPost, "/admin/tags", merge, cookies, "10.0.0.1"); w.Code != http.StatusForbidden {
+			t.Errorf("令牌%q %d", invalid, w.Code)
+		}
+	}
+	merge.Set("csrf", token)
+	if w := serve(d, http.MethodPost, "/admin/tags", merge, cookies, "10.0.0.1"); w.Code != http.StatusSeeOther {
+		t.Errorf("带上令牌提交 %d", w.Code)
+	}
+
+	if w := serve(d, http.MethodPost, "/admin/logout", nil, cookies, "10.0.0.1"); w.Code != http.StatusForbidden {
+		t.Errorf("退出时没有令牌 %d", w.Code)
+	}
+	session := cookies[sessionCookie]
+	if w := serve(d, http.MethodPost, "/admin/logout", url.Values{"csrf": {token}}, cookies, "10.0.0.1"); w.Code != http.StatusSeeOther {
+		t.Errorf("退出 %d", w.Code)
+	}
+	cookies[sessionCookie] = session
+	if w := serve(d, http.MethodGet, "/admin/tags", nil, cookies, "10.0.0.1"); w.Code != http.StatusFound {
+		t.Errorf("退出后会话应该失效 %d", w.Code)
+	}
+}
+
+// 登录后返回会话的表单令牌
+func login(t *testing.T, d *Dashboard, cookies map[string]string) string {
+	t.Helper()
+	token := formToken(t, serve(d, http.MethodGet, "/admin/login", nil, cookies, "10.0.0.1"))
+	if w := serve(d, http.MethodPost, "/admin/login", url.Values{"password": {"secret"}, "csrf": {token}}, cookies, "10.0.0.1"); w.Code != http.StatusSeeOther {
+		t.Fatalf("登录 %d", w.Code)
+	}
+	return formToken(t, serve(d, http.MethodGet, "/admin/tags", nil, cookies, "10.0.0.1"))
+}
+
+func TestDashboardEditSensitive(t *testing.T) {
+	d := newTestDashboard(t)
+	cookies := map[string]string{}
+	token := login(t, d, cookies)
+	tests := []struct {
+		name      string
+		sensitive bool // 登记时的隐私保护
+		tags      string
+		want      bool
+	}{
+		{"添加敏感标签", false, "工牌,蓝色", true},
+		{"去掉敏感标签", true, "雨伞", false},
+		{"未修改标签时保留登记时的选择", true, "雨伞,黑色", true},
+	}
+	for _, test := range tests {
+		record, err := repo.AddRecord(conversation.ConversationContext{
+			ReceiveContent: &conversation.MsgContent{FromUsername: "alice"},
+			Conversation: &conversation.Conversation{UserName: "alice", Type: conversation.KindFound, Form: conversation.Form{
+				ItemName: "雨伞", ItemTags: []string{"雨伞", "黑色"}, Sensitive: test.sensitive,
+			}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		edit := url.Values{"action": {"edit"}, "item_name": {"雨伞"}, "tags": {test.tags}, "csrf": {token}}
+		if w := serve(d, http.MethodPost, fmt.Sprintf("/admin/records/%d", record.Id), edit, cookies, "10.0.0.1"); w.Code != http.StatusSeeOther {
+			t.Fatalf("%s 修改记录 %d", test.name, w.Code)
+		}
+		record, err = repo.GetRecordById(record.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.Sensitive != test.want {
+			t.Errorf("%s 敏感物品应该为%v 标签为%s", test.name, test.want, record.Tags)
+		}
+	}
+}
+
+func TestDashboardLoginLocked(t *testing.T) {
+	d := newTestDashboard(t)
+	cookies := map[string]string{}
+	token := formToken(t, serve(d, http.MethodGet, "/admin/login", nil, cookies, "10.0.0.1"))
+	login := func(password string, ip string) int {
+		return serve(d, http.MethodPost, "/admin/login", url.Values{"password": {password}, "csrf": {token}}, cookies, ip).Code
+	}
+	for i := 0; i < maxLoginFailures; i++ {
+		if code := login("wrong", "10.0.0.1"); code != http.StatusUnauthorized {
+			t.Fatalf("第%d次密码错误 %d", i+1, code)
+		}
+	}
+	// 锁定后正确的密码也不能登录
+	if code := login("secret", "10.0.0.1"); code != http.StatusTooManyRequests {
+		t.Errorf("锁定后登录 %d", code)
+	}
+	// 其他IP不受影响
+	if code := login("secret", "10.0.0.2"); code != http.StatusSeeOther {
+		t.Errorf("其他IP登录 %d", code)
+	}
+	d.failures["10.0.0.1"].Since = d.failures["10.0.0.1"].Since.Add(-loginFailureWindow)
+	if code := login("secret", "10.0.0.1"); code != http.StatusSeeOther {
+		t.Errorf("窗口结束后登录 %d", code)
+	}
+	if _, exist := d.failures["10.0.0.1"]; exist {
+		t.Error("登录成功后清除失败次数")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	d := NewDashboard(DashboardConfig{TrustedProxies: []string{"10.0.0.2"}}, func(string) bool { return false }, nil)
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{"直接访问", "127.0.0.1:5000", "", "127.0.0.1"},
+		// 客户端可以伪造前面的地址 只使用代理添加的最后一个
+		{"经过本机的代理", "127.0.0.1:5000", "1.2.3.4, 10.0.0.9", "10.0.0.9"},
+		{"经过本机IPv6的代理", "[::1]:5000", "10.0.0.9", "10.0.0.9"},
+		{"经过配置的代理", "10.0.0.2:5000", "10.0.0.9", "10.0.0.9"},
+		{"直接访问时伪造", "10.0.0.3:5000", "10.0.0.9", "10.0.0.3"},
+		{"代理没有添加地址", "127.0.0.1:5000", "10.0.0.9, ", "127.0.0.1"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/admin/login", nil)
+		r.RemoteAddr = test.remote
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		if ip := d.clientIP(r); ip != test.want {
+			t.Errorf("%s 应该为%s 实际为%s", test.name, test.want, ip)
+		}
+	}
+}
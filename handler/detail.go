@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"wxbot-lostandfound/i18n"
+)
+
+// 记录详情页 链接可能被转发,因此按匿名用户展示,敏感物品的图片和联系方式不可见
+// 页面语言由链接中的lang参数决定
+var detailTemplate = template.Must(template.New("detail").Parse(`<!DOCTYPE html>
+<html lang="{{.View.Language}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.View.Kind}} - {{.View.ItemName}}</title>
+<style>
+body { font-family: -apple-system, "PingFang SC", sans-serif; margin: 0; padding: 16px; color: #333; }
+h1 { font-size: 20px; }
+dt { color: #999; font-size: 14px; margin-top: 12px; }
+dd { margin: 4px 0 0 0; }
+img { max-width: 100%; margin-top: 16px; }
+.warning { color: #f0ad4e; }
+.info { color: #5cb85c; }
+.comment { color: #999; font-size: 14px; }
+</style>
+</head>
+<body>
+{{with .View}}
+<h1>{{$.T "record_title"}}</h1>
+<dl>
+<dt>{{$.T "label_id"}}</dt><dd>{{.Id}}</dd>
+<dt>{{$.T "label_location"}}</dt><dd>{{.Location}}</dd>
+{{if .LocationLabel}}<dt>{{$.T "label_position"}}</dt><dd>{{.LocationLabel}}</dd>{{end}}
+{{if .Time}}<dt>{{$.T "label_time"}}</dt><dd>{{.Time}}</dd>{{end}}
+<dt>{{$.T "label_description"}}</dt><dd>{{.Description}}</dd>
+{{if .PickupLocation}}<dt>{{$.T "label_pickup"}}</dt><dd>{{.PickupLocation}}</dd>{{end}}
+<dt>{{$.T "label_tags"}}</dt><dd>{{.Tags}}</dd>
+<dt>{{$.T "label_status"}}</dt><dd class="{{if .Completed}}info{{else}}warning{{end}}">{{.Status}}</dd>
+</dl>
+{{if .NeedVerify}}<p>{{$.T "detail_need_verify"}}</p>{{end}}
+{{if .Hidden}}<p class="comment">{{$.T "hidden_notice"}}</p>{{end}}
+{{if .ImgUrl}}<img src="{{.ImgUrl}}" alt="{{.ItemName}}">{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+type detailPage struct {
+	View recordView
+}
+
+// 页面上的文案 以记录作为模板参数
+func (p detailPage) T(key string) string {
+	return i18n.T(p.View.Language, key, p.View)
+}
+
+// 记录详情页 路径为 /api/bot/records/{id}?sig={签名}
+func RecordDetail(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/bot/records/"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	// 签名错误时和记录不存在一样处理
+	if !hmac.Equal([]byte(r.URL.Query().Get("sig")), []byte(detailSignature(id))) {
+		http.NotFound(w, r)
+		return
+	}
+	record, err := repo.GetRecordById(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	page := detailPage{View: newRecordView(record, Viewer{Language: r.URL.Query().Get("lang")})}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := detailTemplate.Execute(w, page); err != nil {
+		log.Println("渲染记录详情页出错", err.Error())
+	}
+}
+
+// 图片保存的目录
+var imgDir = "imgs"
+
+// 记录的图片 路径为 /api/bot/imgs/{图片名称}?sig={签名} 不提供目录列表
+func RecordImage(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/bot/imgs/")
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		http.NotFound(w, r)
+		return
+	}
+	if !hmac.Equal([]byte(r.URL.Query().Get("sig")), []byte(imageSignature(name))) {
+		http.NotFound(w, r)
+		return
+	}
+	file, err := os.Open(filepath.Join(imgDir, name))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"wxbot-lostandfound/dao"
+)
+
+func TestRecordImage(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.png"), []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	oldDir := imgDir
+	imgDir = dir
+	t.Cleanup(func() { imgDir = oldDir })
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"带签名的图片", imagePath("a.png"), http.StatusOK},
+		{"没有签名", "/api/bot/imgs/a.png", http.StatusNotFound},
+		{"签名错误", "/api/bot/imgs/a.png?sig=" + imageSignature("b.png"), http.StatusNotFound},
+		{"详情页的签名", "/api/bot/imgs/1?sig=" + detailSignature(1), http.StatusNotFound},
+		{"目录列表", "/api/bot/imgs/", http.StatusNotFound},
+		{"带签名的目录", imagePath("sub"), http.StatusNotFound},
+		{"上级目录", "/api/bot/imgs/..?sig=" + imageSignature(".."), http.StatusNotFound},
+		{"子目录中的文件", "/api/bot/imgs/sub%2Fa.png?sig=" + imageSignature("sub/a.png"), http.StatusNotFound},
+		{"不存在的图片", imagePath("c.png"), http.StatusNotFound},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		RecordImage(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != test.status {
+			t.Errorf("%s %s 应该返回%d 实际为%d", test.name, test.path, test.status, w.Code)
+		}
+		if test.status == http.StatusOK && w.Body.String() != "png" {
+			t.Errorf("%s 图片内容错误 %q", test.name, w.Body.String())
+		}
+	}
+}
+
+func TestRecordViewImageUrl(t *testing.T) {
+	newTestDashboard(t)
+	tests := []struct {
+		name      string
+		sensitive bool
+		viewer    Viewer
+		visible   bool
+	}{
+		{"普通物品", false, Viewer{}, true},
+		{"敏感物品匿名查看", true, Viewer{}, false},
+		{"敏感物品其他用户查看", true, Viewer{UserName: "bob"}, false},
+		{"敏感物品登记人查看", true, Viewer{UserName: "alice"}, true},
+		{"敏感物品管理员查看", true, Viewer{UserName: "admin", IsAdmin: true}, true},
+	}
+	for _, test := range tests {
+		record := dao.ItemRecord{Id: 1, User: "alice", ImgName: "a.png", Sensitive: test.sensitive, Status: dao.StatusOpen}
+		view := newRecordView(record, test.viewer)
+		if visible := view.ImgUrl != ""; visible != test.visible {
+			t.Errorf("%s 图片可见应该为%v %q", test.name, test.visible, view.ImgUrl)
+		}
+		if test.visible && view.ImgUrl != BaseUrl+imagePath("a.png") {
+			t.Errorf("%s 图片链接应该带上签名 %q", test.name, view.ImgUrl)
+		}
+	}
+}
@@ -1,46 +1,202 @@
 package handler
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log"
+	"net/url"
+	"strconv"
 	"strings"
 	"wxbot-lostandfound/dao"
+	"wxbot-lostandfound/i18n"
+	"wxbot-lostandfound/utils"
 )
 
-func GetRecordMarkdown(recordType int64, status string,tags []string) (mds []string) {
-	records := dao.GetRecord(recordType, status,tags)
-	log.Printf("类型:%d查找了%d条记录\n",recordType,len(records))
-	builder := strings.Builder{}
-	for _, record := range records {
-		builder.Reset()
-		switch record.Type {
-		case 1:
-			builder.WriteString(fmt.Sprintf("丢失物品记录 ID:%d\n",record.Id))
-		case 2:
-			builder.WriteString(fmt.Sprintf("捡到物品记录 ID:%d\n",record.Id))
-		}
-		builder.WriteString(fmt.Sprintf("所在城市:%s\n", record.City))
-		builder.WriteString(fmt.Sprintf("物品名称:%s\n", record.ItemName))
+// 查看记录的用户 用于判断敏感物品的详细信息是否可见
+type Viewer struct {
+	UserName string
+	IsAdmin  bool
+	Language string // 展示使用的语言 为空时使用默认语言
+}
+
+// 敏感物品只对登记人、管理员以及通过验证问题的认领人展示完整信息
+func canViewDetail(record dao.ItemRecord, viewer Viewer) bool {
+	if !record.Sensitive || viewer.IsAdmin {
+		return true
+	}
+	return isVerifiedViewer(record, viewer)
+}
+
+// 取回地点在设置了验证问题时只对登记人、管理员以及通过验证的认领人展示
+func canViewPickup(record dao.ItemRecord, viewer Viewer) bool {
+	if !canViewDetail(record, viewer) {
+		return false
+	}
+	return record.VerifyQuestion == "" || viewer.IsAdmin || isVerifiedViewer(record, viewer)
+}
+
+func isVerifiedViewer(record dao.ItemRecord, viewer Viewer) bool {
+	if viewer.UserName == "" {
+		return false
+	}
+	return viewer.UserName == record.User || repo.IsClaimVerified(record.Id, viewer.UserName)
+}
+
+// 状态的展示名称
+func StatusName(status dao.RecordStatus, lang string) string {
+	return i18n.T(lang, "status_"+string(status))
+}
+
+// 记录的存储 启动时注入
+var repo dao.Repository
+
+func SetRepository(repository dao.Repository) {
+	repo = repository
+}
+
+// 图片和详情页链接的前缀
+var BaseUrl = "https://thk.ifine.eu"
+
+func SetBaseUrl(baseUrl string) {
+	if baseUrl != "" {
+		BaseUrl = strings.TrimSuffix(baseUrl, "/")
+	}
+}
+
+// 详情页链接的签名密钥 未设置时使用随机密钥,重启后之前的链接失效
+var detailKey = []byte(randomToken())
+
+// 由配置中的密钥派生签名密钥 避免直接使用消息加解密的密钥
+func SetDetailSecret(secret string) {
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte("record-detail"))
+		detailKey = mac.Sum(nil)
+	}
+}
+
+// 记录ID的签名 详情页的ID是连续的,没有签名时无法通过遍历ID查看所有记录
+func detailSignature(id int64) string {
+	mac := hmac.New(sha256.New, detailKey)
+	mac.Write([]byte(strconv.FormatInt(id, 10)))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// 图片名称的签名 图片只能通过展示记录时生成的链接查看
+func imageSignature(name string) string {
+	mac := hmac.New(sha256.New, detailKey)
+	mac.Write([]byte("img/" + name))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// 图片的相对路径 带上签名
+func imagePath(name string) string {
+	return "/api/bot/imgs/" + url.PathEscape(name) + "?" + url.Values{"sig": {imageSignature(name)}}.Encode()
+}
+
+// 记录详情页的链接 带上签名,非默认语言时带上语言参数
+func RecordDetailUrl(id int64, lang string) string {
+	query := url.Values{"sig": {detailSignature(id)}}
+	if lang != "" && lang != i18n.DefaultLanguage {
+		query.Set("lang", lang)
+	}
+	return fmt.Sprintf("%s/api/bot/records/%d?%s", BaseUrl, id, query.Encode())
+}
+
+// 查找记录
+func GetRecords(filter dao.RecordFilter) []dao.ItemRecord {
+	records := repo.GetRecord(filter)
+	log.Printf("类型:%s查找了%d条记录\n", filter.Type, len(records))
+	return records
+}
+
+// 展示用的记录 敏感信息已经根据查看人处理
+type recordView struct {
+	Id             int64
+	Kind           string
+	ItemName       string
+	Location       string
+	LocationLabel  string
+	Time           string
+	Description    string
+	ImgUrl         string
+	PickupLocation string
+	Tags           string
+	Status         string
+	Completed      bool // 不再处理中的记录 如已完成、已撤回
+	NeedVerify     bool
+	Hidden         bool // 敏感物品的图片和完整信息不可见
+	DetailUrl      string
+	Language       string
+}
+
+func newRecordView(record dao.ItemRecord, viewer Viewer) recordView {
+	view := recordView{
+		Id:            record.Id,
+		ItemName:      record.ItemName,
+		Location:      record.Location,
+		LocationLabel: record.LocationLabel,
+		Tags:          record.Tags,
+		Completed:     !record.Status.IsOpen(),
+		NeedVerify:    record.VerifyQuestion != "",
+		Language:      viewer.Language,
+	}
+	if view.Language == "" {
+		view.Language = i18n.DefaultLanguage
+	}
+	view.DetailUrl = RecordDetailUrl(record.Id, view.Language)
+	view.Kind = record.Type.DisplayName(view.Language)
+	view.Status = StatusName(record.Status, view.Language)
+	if view.Location == "" {
+		view.Location = record.City
+	}
+	if record.OccurredAt != nil {
+		view.Time = utils.FormatTime(*record.OccurredAt)
+	}
+	if canViewPickup(record, viewer) {
+		view.PickupLocation = record.PickupLocation
+	}
+	if canViewDetail(record, viewer) {
+		view.Description = record.Description
 		if record.ImgName != "" {
-			// TODO 当前链接为硬编码需要修改
-			builder.WriteString(fmt.Sprintf("[图片链接](https://thk.ifine.eu/api/bot/imgs/%s)\n", record.ImgName))
+			view.ImgUrl = BaseUrl + imagePath(record.ImgName)
+		}
+	} else {
+		view.Hidden = true
+		view.Description = utils.RedactNumbers(record.Description)
+	}
+	return view
+}
+
+// 物品流转记录
+func GetCustodyText(itemId int64, lang string) string {
+	custodyRecords := repo.GetCustodyRecords(itemId)
+	data := i18n.Data{"Id": itemId}
+	if len(custodyRecords) == 0 {
+		return i18n.T(lang, "custody_empty", data)
+	}
+	builder := strings.Builder{}
+	builder.WriteString(i18n.T(lang, "custody_title", data) + "\n")
+	for _, custody := range custodyRecords {
+		from := custody.FromLocation
+		if from == "" {
+			from = i18n.T(lang, "custody_reporter")
 		}
-		builder.WriteString(fmt.Sprintf("描述:%s\n", record.Description))
-		builder.WriteString(fmt.Sprintf(">标签:%s\n", record.Tags))
-		if record.Status == "未完成" {
-			builder.WriteString("状态:<font color=\"warning\">未完成</font>\n")
-		} else {
-			builder.WriteString("状态:<font color=\"info\">已完成</font>\n")
+		builder.WriteString(fmt.Sprintf("%s %s -> %s (%s)", custody.CreatedAt.Format("2006-01-02 15:04"), from, custody.ToLocation, custody.Operator))
+		if custody.Note != "" {
+			builder.WriteString(" " + custody.Note)
 		}
-		mds = append(mds, builder.String())
+		builder.WriteString("\n")
 	}
-	return
+	return builder.String()
 }
 
 func GetAllTag() (tags []string) {
-	tagRecords := dao.GetAllTag()
-	for _,tagRecord := range tagRecords {
-		tags = append(tags,tagRecord.TagName)
+	tagRecords := repo.GetAllTag()
+	for _, tagRecord := range tagRecords {
+		tags = append(tags, tagRecord.TagName)
 	}
 	return
 }
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"strings"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/dao"
+	"wxbot-lostandfound/i18n"
+)
+
+// 将记录渲染为企业微信消息 消息的接收人和应用id由发送方填写
+// 各格式的文案模板在语言文件中 如 record_markdown record_text
+type Renderer interface {
+	Render(records []dao.ItemRecord, viewer Viewer) []interface{}
+}
+
+const (
+	FormatMarkdown = "markdown"
+	FormatText     = "text"
+	FormatNews     = "news"
+	FormatTextCard = "textcard"
+
+	maxNewsArticles = 8    // 图文消息最多8篇文章
+	maxTextBytes    = 2000 // 文本消息最长2048字节
+)
+
+// 根据配置的格式创建renderer 默认markdown(只在企业微信客户端中可以显示)
+func NewRenderer(format string) Renderer {
+	switch format {
+	case FormatText:
+		return textRenderer{}
+	case FormatNews:
+		return newsRenderer{}
+	case FormatTextCard:
+		return textCardRenderer{}
+	default:
+		return markdownRenderer{}
+	}
+}
+
+// markdown 每条记录一条消息
+type markdownRenderer struct{}
+
+func (markdownRenderer) Render(records []dao.ItemRecord, viewer Viewer) (msgs []interface{}) {
+	for _, record := range records {
+		view := newRecordView(record, viewer)
+		msg := &conversation.MarkDownMsg{Msgtype: "markdown"}
+		msg.Markdown.Content = i18n.T(view.Language, "record_markdown", view)
+		msgs = append(msgs, msg)
+	}
+	return
+}
+
+// 纯文本 多条记录合并到一条消息中,超出长度时拆分
+type textRenderer struct{}
+
+func (textRenderer) Render(records []dao.ItemRecord, viewer Viewer) (msgs []interface{}) {
+	builder := strings.Builder{}
+	flush := func() {
+		if builder.Len() > 0 {
+			msg := &conversation.InitiativeTextMsg{Msgtype: "text"}
+			msg.Text.Content = strings.TrimSpace(builder.String())
+			msgs = append(msgs, msg)
+			builder.Reset()
+		}
+	}
+	for _, record := range records {
+		view := newRecordView(record, viewer)
+		text := i18n.T(view.Language, "record_text", view)
+		if builder.Len()+len(text) > maxTextBytes {
+			flush()
+		}
+		builder.WriteString(text)
+		builder.WriteString("\n")
+	}
+	flush()
+	return
+}
+
+// 图文消息 每条消息最多8条记录
+type newsRenderer struct{}
+
+func (newsRenderer) Render(records []dao.ItemRecord, viewer Viewer) (msgs []interface{}) {
+	for start := 0; start < len(records); start += maxNewsArticles {
+		end := start + maxNewsArticles
+		if end > len(records) {
+			end = len(records)
+		}
+		msg := &conversation.NewsMsg{Msgtype: "news"}
+		for _, record := range records[start:end] {
+			msg.News.Articles = append(msg.News.Articles, RecordArticle(record, viewer))
+		}
+		msgs = append(msgs, msg)
+	}
+	return
+}
+
+// 文本卡片 每条记录一张卡片
+type textCardRenderer struct{}
+
+func (textCardRenderer) Render(records []dao.ItemRecord, viewer Viewer) (msgs []interface{}) {
+	for _, record := range records {
+		view := newRecordView(record, viewer)
+		msg := &conversation.TextCardMsg{Msgtype: "textcard"}
+		msg.TextCard.Title = i18n.T(view.Language, "record_title", view)
+		msg.TextCard.Description = i18n.T(view.Language, "record_textcard", view)
+		msg.TextCard.Url = view.DetailUrl
+		msg.TextCard.Btntxt = i18n.T(view.Language, "textcard_button")
+		msgs = append(msgs, msg)
+	}
+	return
+}
+
+// 使用指定的文案模板渲染单条记录 用于群聊推送和定时汇总
+func RenderRecord(key string, record dao.ItemRecord, viewer Viewer) string {
+	view := newRecordView(record, viewer)
+	return i18n.T(view.Language, key, view)
+}
+
+// 单条记录的图文文章 用于群聊推送
+func RecordArticle(record dao.ItemRecord, viewer Viewer) conversation.NewsArticle {
+	view := newRecordView(record, viewer)
+	return conversation.NewsArticle{
+		Title:       i18n.T(view.Language, "record_title", view),
+		Description: i18n.T(view.Language, "record_summary", view),
+		Url:         view.DetailUrl,
+		Picurl:      view.ImgUrl,
+	}
+}
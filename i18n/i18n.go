@@ -0,0 +1,128 @@
+package i18n
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// 用户可见文案的模板目录 每种语言一个文件 如 locales/zh.yaml locales/en.yaml
+// 文件内容为 key: 模板 ,模板使用text/template语法
+
+// 模板参数 也可以直接传入结构体
+type Data map[string]interface{}
+
+var (
+	DefaultLanguage = "zh"
+	catalogs        = map[string]map[string]*template.Template{}
+)
+
+// 加载目录下所有语言的模板 并校验每种语言的key是否一致
+func Load(dir string, defaultLanguage string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("目录%s下没有语言文件", dir)
+	}
+	loaded := map[string]map[string]*template.Template{}
+	for _, file := range files {
+		lang := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		messages := map[string]string{}
+		if err = yaml.Unmarshal(content, &messages); err != nil {
+			return fmt.Errorf("解析语言文件%s: %s", file, err.Error())
+		}
+		catalog := make(map[string]*template.Template, len(messages))
+		for key, text := range messages {
+			tmpl, err := template.New(key).Parse(text)
+			if err != nil {
+				return fmt.Errorf("解析语言%s的模板%s: %s", lang, key, err.Error())
+			}
+			catalog[key] = tmpl
+		}
+		loaded[lang] = catalog
+	}
+	if defaultLanguage != "" {
+		DefaultLanguage = defaultLanguage
+	}
+	if _, ok := loaded[DefaultLanguage]; !ok {
+		return fmt.Errorf("缺少默认语言%s的语言文件", DefaultLanguage)
+	}
+	if err = validate(loaded); err != nil {
+		return err
+	}
+	catalogs = loaded
+	log.Printf("已加载语言 %s\n", strings.Join(Languages(), ","))
+	return nil
+}
+
+// 每个key在每种语言中都必须存在
+func validate(loaded map[string]map[string]*template.Template) error {
+	keys := map[string]struct{}{}
+	for _, catalog := range loaded {
+		for key := range catalog {
+			keys[key] = struct{}{}
+		}
+	}
+	var missing []string
+	for lang, catalog := range loaded {
+		for key := range keys {
+			if _, ok := catalog[key]; !ok {
+				missing = append(missing, lang+":"+key)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("语言文件缺少以下文案 %s", strings.Join(missing, ","))
+	}
+	return nil
+}
+
+// 已加载的语言
+func Languages() (languages []string) {
+	for lang := range catalogs {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	return
+}
+
+func Supported(lang string) bool {
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// 渲染文案 语言不存在时使用默认语言,key不存在时返回key本身
+func T(lang string, key string, data ...interface{}) string {
+	catalog, ok := catalogs[lang]
+	if !ok {
+		catalog = catalogs[DefaultLanguage]
+	}
+	tmpl, ok := catalog[key]
+	if !ok {
+		log.Println("缺少文案", lang, key)
+		return key
+	}
+	var arg interface{}
+	if len(data) > 0 {
+		arg = data[0]
+	}
+	buffer := bytes.Buffer{}
+	if err := tmpl.Execute(&buffer, arg); err != nil {
+		log.Println("渲染文案出错", key, err.Error())
+		return key
+	}
+	return buffer.String()
+}
@@ -0,0 +1,82 @@
+package i18n
+
+import (
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const localeDir = "../locales"
+
+func readKeys(t *testing.T, lang string) map[string]string {
+	content, err := ioutil.ReadFile(filepath.Join(localeDir, lang+".yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := map[string]string{}
+	if err := yaml.Unmarshal(content, &messages); err != nil {
+		t.Fatalf("解析%s: %v", lang, err)
+	}
+	return messages
+}
+
+// 中英文的key必须一致
+func TestLocaleKeysMatch(t *testing.T) {
+	zh, en := readKeys(t, "zh"), readKeys(t, "en")
+	for key := range zh {
+		if _, ok := en[key]; !ok {
+			t.Errorf("en缺少%s", key)
+		}
+	}
+	for key := range en {
+		if _, ok := zh[key]; !ok {
+			t.Errorf("zh缺少%s", key)
+		}
+	}
+}
+
+// 所有模板都可以解析 加载时同样会校验key是否一致
+func TestLoadLocales(t *testing.T) {
+	if err := Load(localeDir, "zh"); err != nil {
+		t.Fatal(err)
+	}
+	if languages := strings.Join(Languages(), ","); languages != "en,zh" {
+		t.Errorf("已加载的语言 %s", languages)
+	}
+}
+
+func TestLoadMissingKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "zh.yaml"), []byte("a: 甲\nb: 乙\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "en.yaml"), []byte("a: A\n"), 0644)
+	if err := Load(dir, "zh"); err == nil || !strings.Contains(err.Error(), "en:b") {
+		t.Errorf("缺少文案时应该报错 %v", err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "en.yaml"), []byte("a: A\nb: '{{.B'\n"), 0644)
+	if err := Load(dir, "zh"); err == nil {
+		t.Error("模板无法解析时应该报错")
+	}
+}
+
+func TestT(t *testing.T) {
+	if err := Load(localeDir, "zh"); err != nil {
+		t.Fatal(err)
+	}
+	if got := T("en", "edit_done", Data{"Id": 12}); got != "Record 12 updated" {
+		t.Errorf("渲染英文文案 %s", got)
+	}
+	// 不支持的语言使用默认语言 不存在的key返回key本身
+	if got, want := T("fr", "edit_done", Data{"Id": 12}), T("zh", "edit_done", Data{"Id": 12}); got != want {
+		t.Errorf("不支持的语言 %s %s", got, want)
+	}
+	if got := T("zh", "no_such_key"); got != "no_such_key" {
+		t.Errorf("不存在的key %s", got)
+	}
+}
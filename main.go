@@ -3,7 +3,10 @@ package main
 import (
 	"github.com/spf13/viper"
 	"log"
+	"os"
 	"wxbot-lostandfound/bot"
+	"wxbot-lostandfound/cli"
+	"wxbot-lostandfound/dao"
 	"wxbot-lostandfound/utils"
 )
 
@@ -22,10 +25,14 @@ func main()  {
 			} else {
 				log.Printf("%v", r)
 			}
+			os.Exit(1)
 		}
 	}()
 	log.Println("Loading config...")
 	utils.CheckError(viper.ReadInConfig(),"读取配置文件")
 	utils.CheckError(viper.Unmarshal(bot.GetBotConfig()),"反序列化配置文件")
-	bot.Start()
-}
\ No newline at end of file
+	repository, err := dao.Open(bot.GetBotConfig().Database)
+	utils.CheckError(err, "数据库连接")
+	// 没有参数时启动服务 管理命令见 help
+	utils.CheckError(cli.Run(os.Args[1:], repository), "执行命令")
+}
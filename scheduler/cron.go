@@ -0,0 +1,131 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cron表达式 分 时 日 月 周 如 "0 9 * * 1-5" 表示工作日9点
+// 支持 * , - / 以及 @hourly @daily @weekly @monthly
+type Schedule struct {
+	minute, hour, dom, month, dow uint64 // 各字段允许的取值 按位表示
+	domAny, dowAny                bool
+}
+
+var descriptors = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+func Parse(spec string) (schedule Schedule, err error) {
+	spec = strings.TrimSpace(spec)
+	if expanded, ok := descriptors[spec]; ok {
+		spec = expanded
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return schedule, fmt.Errorf("cron表达式%q应为5个字段", spec)
+	}
+	if schedule.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return
+	}
+	if schedule.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return
+	}
+	if schedule.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return
+	}
+	if schedule.month, err = parseField(fields[3], 1, 12); err != nil {
+		return
+	}
+	if schedule.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return
+	}
+	// 周日可以写作0或7
+	if schedule.dow&(1<<7) != 0 {
+		schedule.dow |= 1
+	}
+	schedule.domAny = fields[2] == "*"
+	schedule.dowAny = fields[4] == "*"
+	return
+}
+
+// 解析单个字段 如 */15 1,3,5 1-5 1-10/2
+func parseField(field string, min int, max int) (bits uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if index := strings.Index(part, "/"); index >= 0 {
+			if step, err = strconv.Atoi(part[index+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("无效的步长%q", part)
+			}
+			part = part[:index]
+		}
+		start, end := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("无效的范围%q", part)
+			}
+			if end, err = strconv.Atoi(bounds[1]); err != nil {
+				return 0, fmt.Errorf("无效的范围%q", part)
+			}
+		default:
+			if start, err = strconv.Atoi(part); err != nil {
+				return 0, fmt.Errorf("无效的取值%q", part)
+			}
+			end = start
+			if step > 1 {
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("取值%q超出范围%d-%d", part, min, max)
+		}
+		for value := start; value <= end; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return
+}
+
+// 日和周同时限定时满足其一即可 与标准cron一致
+func (s Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// 严格晚于t的下一次执行时间 五年内没有执行时间时返回零值
+func (s Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
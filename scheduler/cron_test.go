@@ -0,0 +1,96 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func at(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.Local)
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-a * * * *",
+		"@yearly",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("%q 应该解析失败", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// 2024-03-13 为周三
+	cases := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"0 9 * * *", at(2024, 3, 13, 8, 0), at(2024, 3, 13, 9, 0)},
+		// 严格晚于当前时间
+		{"0 9 * * *", at(2024, 3, 13, 9, 0), at(2024, 3, 14, 9, 0)},
+		{"0 9 * * *", at(2024, 3, 13, 9, 0).Add(30 * time.Second), at(2024, 3, 14, 9, 0)},
+		// 范围
+		{"0 9 * * 1-5", at(2024, 3, 15, 10, 0), at(2024, 3, 18, 9, 0)},
+		{"0 9-11 * * *", at(2024, 3, 13, 9, 30), at(2024, 3, 13, 10, 0)},
+		// 步长
+		{"*/15 * * * *", at(2024, 3, 13, 10, 7), at(2024, 3, 13, 10, 15)},
+		{"*/15 * * * *", at(2024, 3, 13, 10, 59), at(2024, 3, 13, 11, 0)},
+		{"0 12 1-10/3 * *", at(2024, 3, 2, 0, 0), at(2024, 3, 4, 12, 0)},
+		{"0 12 1-10/3 * *", at(2024, 3, 10, 12, 0), at(2024, 4, 1, 12, 0)},
+		{"5/20 * * * *", at(2024, 3, 13, 10, 26), at(2024, 3, 13, 10, 45)},
+		// 列表
+		{"0 0 1,15 * *", at(2024, 3, 2, 0, 0), at(2024, 3, 15, 0, 0)},
+		// 周日可以写作0或7
+		{"30 8 * * 0", at(2024, 3, 13, 0, 0), at(2024, 3, 17, 8, 30)},
+		{"30 8 * * 7", at(2024, 3, 13, 0, 0), at(2024, 3, 17, 8, 30)},
+		// 日和周同时限定时满足其一即可
+		{"0 0 13 * 5", at(2024, 3, 13, 0, 0), at(2024, 3, 15, 0, 0)},
+		{"0 0 13 * 5", at(2024, 3, 29, 0, 0), at(2024, 4, 5, 0, 0)},
+		{"0 0 20 * 5", at(2024, 3, 16, 0, 0), at(2024, 3, 20, 0, 0)},
+		// 只限定日或周时只看限定的字段
+		{"0 0 * * 5", at(2024, 3, 13, 0, 0), at(2024, 3, 15, 0, 0)},
+		{"0 0 20 * *", at(2024, 3, 13, 0, 0), at(2024, 3, 20, 0, 0)},
+		// 月份
+		{"0 0 1 2 *", at(2024, 3, 13, 0, 0), at(2025, 2, 1, 0, 0)},
+		{"0 0 29 2 *", at(2024, 3, 1, 0, 0), at(2028, 2, 29, 0, 0)},
+		// 简写
+		{"@hourly", at(2024, 3, 13, 15, 0), at(2024, 3, 13, 16, 0)},
+		{"@daily", at(2024, 3, 13, 15, 0), at(2024, 3, 14, 0, 0)},
+		{"@weekly", at(2024, 3, 13, 15, 0), at(2024, 3, 17, 0, 0)},
+		{"@monthly", at(2024, 3, 13, 15, 0), at(2024, 4, 1, 0, 0)},
+	}
+	for _, c := range cases {
+		schedule, err := Parse(c.spec)
+		if err != nil {
+			t.Errorf("%q: %v", c.spec, err)
+			continue
+		}
+		if got := schedule.Next(c.from); !got.Equal(c.want) {
+			t.Errorf("%q 从 %s: 期望 %s 实际 %s", c.spec, c.from, c.want, got)
+		}
+	}
+}
+
+// 不存在的日期 五年内没有执行时间
+func TestNextNever(t *testing.T) {
+	schedule, err := Parse("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := schedule.Next(at(2024, 3, 13, 0, 0)); !next.IsZero() {
+		t.Errorf("不应该有执行时间 %s", next)
+	}
+}
@@ -0,0 +1,154 @@
+package scheduler
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// 定时任务调度 时间由Clock提供,测试时可以注入手动控制的时钟
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+var RealClock Clock = realClock{}
+
+type job struct {
+	name     string
+	schedule Schedule
+	run      func(now time.Time)
+	next     time.Time
+}
+
+type Scheduler struct {
+	clock Clock
+	jobs  []*job
+	mutex sync.Mutex
+}
+
+func New(clock Clock) *Scheduler {
+	return &Scheduler{clock: clock}
+}
+
+// 添加任务 任务执行时传入计划的执行时间
+func (s *Scheduler) Add(name string, spec string, run func(now time.Time)) error {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.jobs = append(s.jobs, &job{name: name, schedule: schedule, run: run, next: schedule.Next(s.clock.Now())})
+	log.Printf("添加定时任务%s %s\n", name, spec)
+	return nil
+}
+
+// 执行到期的任务 返回下一次有任务需要执行的时间
+func (s *Scheduler) RunDue(now time.Time) (next time.Time) {
+	s.mutex.Lock()
+	var due []*job
+	for _, j := range s.jobs {
+		if !j.next.IsZero() && !j.next.After(now) {
+			due = append(due, j)
+		}
+	}
+	s.mutex.Unlock()
+	for _, j := range due {
+		s.runJob(j, j.next)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, j := range due {
+		j.next = j.schedule.Next(now)
+	}
+	for _, j := range s.jobs {
+		if !j.next.IsZero() && (next.IsZero() || j.next.Before(next)) {
+			next = j.next
+		}
+	}
+	return
+}
+
+// 任务出错不影响其他任务
+func (s *Scheduler) runJob(j *job, at time.Time) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("定时任务%s出错 %v\n", j.name, r)
+		}
+	}()
+	log.Printf("执行定时任务%s\n", j.name)
+	j.run(at)
+}
+
+// 持续运行直到stop被关闭
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	for {
+		next := s.RunDue(s.clock.Now())
+		if next.IsZero() {
+			log.Println("没有需要执行的定时任务")
+			return
+		}
+		select {
+		case <-stop:
+			return
+		case <-s.clock.After(next.Sub(s.clock.Now())):
+		}
+	}
+}
+
+// 手动控制的时钟 Advance之后到期的After才会触发
+type ManualClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ch := make(chan time.Time, 1)
+	at := c.now.Add(d)
+	if d <= 0 {
+		ch <- c.now
+	} else {
+		c.waiters = append(c.waiters, waiter{at: at, ch: ch})
+	}
+	return ch
+}
+
+// 时间前进d 并触发到期的After
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	remaining := c.waiters[:0]
+	for _, w := range c.waiters {
+		if !w.at.After(c.now) {
+			w.ch <- c.now
+		} else {
+			remaining = append(remaining, w)
+		}
+	}
+	c.waiters = remaining
+}
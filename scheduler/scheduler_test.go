@@ -0,0 +1,131 @@
+package scheduler
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录任务的执行时间
+type runs struct {
+	mutex sync.Mutex
+	times []time.Time
+}
+
+func (r *runs) record(now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.times = append(r.times, now)
+}
+
+func (r *runs) get() []time.Time {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]time.Time(nil), r.times...)
+}
+
+func TestRunDue(t *testing.T) {
+	clock := NewManualClock(at(2024, 3, 13, 8, 59))
+	scheduler := New(clock)
+	daily, hourly := &runs{}, &runs{}
+	if err := scheduler.Add("daily", "0 9 * * *", daily.record); err != nil {
+		t.Fatal(err)
+	}
+	if err := scheduler.Add("hourly", "@hourly", hourly.record); err != nil {
+		t.Fatal(err)
+	}
+	if err := scheduler.Add("invalid", "* * *", daily.record); err == nil {
+		t.Error("无效的cron表达式应该报错")
+	}
+
+	next := scheduler.RunDue(clock.Now())
+	if len(daily.get()) != 0 || len(hourly.get()) != 0 {
+		t.Fatal("还没有到期的任务")
+	}
+	if !next.Equal(at(2024, 3, 13, 9, 0)) {
+		t.Errorf("下一次执行时间 %s", next)
+	}
+
+	clock.Advance(time.Minute)
+	next = scheduler.RunDue(clock.Now())
+	if got := daily.get(); len(got) != 1 || !got[0].Equal(at(2024, 3, 13, 9, 0)) {
+		t.Errorf("每天的任务 %v", got)
+	}
+	if got := hourly.get(); len(got) != 1 {
+		t.Errorf("每小时的任务 %v", got)
+	}
+	if !next.Equal(at(2024, 3, 13, 10, 0)) {
+		t.Errorf("下一次执行时间 %s", next)
+	}
+
+	// 同一时间再次执行不会重复
+	scheduler.RunDue(clock.Now())
+	if len(daily.get()) != 1 || len(hourly.get()) != 1 {
+		t.Error("任务不应该重复执行")
+	}
+
+	// 停机很久后只补执行一次 计划时间为错过的那次
+	clock.Advance(3 * 24 * time.Hour)
+	next = scheduler.RunDue(clock.Now())
+	if got := daily.get(); len(got) != 2 || !got[1].Equal(at(2024, 3, 14, 9, 0)) {
+		t.Errorf("错过的任务 %v", got)
+	}
+	if !next.Equal(at(2024, 3, 16, 10, 0)) {
+		t.Errorf("下一次执行时间从当前时间开始计算 %s", next)
+	}
+}
+
+// 任务出错不影响其他任务
+func TestRunDuePanic(t *testing.T) {
+	clock := NewManualClock(at(2024, 3, 13, 8, 59))
+	scheduler := New(clock)
+	ok := &runs{}
+	scheduler.Add("panic", "0 9 * * *", func(time.Time) { panic("出错") })
+	scheduler.Add("ok", "0 9 * * *", ok.record)
+	clock.Advance(time.Minute)
+	scheduler.RunDue(clock.Now())
+	if len(ok.get()) != 1 {
+		t.Error("其他任务应该正常执行")
+	}
+}
+
+func TestRun(t *testing.T) {
+	clock := NewManualClock(at(2024, 3, 13, 8, 59))
+	scheduler := New(clock)
+	executed := make(chan time.Time, 10)
+	scheduler.Add("daily", "0 9 * * *", func(now time.Time) { executed <- now })
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		scheduler.Run(stop)
+		close(done)
+	}()
+	clock.Advance(time.Minute)
+	select {
+	case now := <-executed:
+		if !now.Equal(at(2024, 3, 13, 9, 0)) {
+			t.Errorf("执行时间 %s", now)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("任务没有执行")
+	}
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("关闭stop后应该退出")
+	}
+}
+
+// 没有任务时直接退出
+func TestRunWithoutJobs(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		New(NewManualClock(at(2024, 3, 13, 8, 59))).Run(nil)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("没有任务时应该退出")
+	}
+}
@@ -0,0 +1,95 @@
+package speech
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"wxbot-lostandfound/utils"
+)
+
+// 语音识别 将语音文件转换为文字
+
+var ErrNotConfigured = errors.New("未配置语音识别引擎")
+
+type Transcriber interface {
+	// 输入为16k采样率单声道的wav文件
+	Transcribe(wavPath string) (string, error)
+}
+
+type Config struct {
+	Engine   string   // stub 或 command
+	StubText string   // stub引擎固定返回的文字,为空时返回未配置错误
+	Command  string   // 本地识别引擎的命令 如 whisper.cpp vosk-transcriber
+	Args     []string // 命令参数 {file} 会被替换为wav文件路径
+	Ffmpeg   string   // ffmpeg路径 用于将amr转换为wav
+}
+
+func NewTranscriber(config Config) Transcriber {
+	switch config.Engine {
+	case "command":
+		return &CommandTranscriber{Command: config.Command, Args: config.Args}
+	default:
+		return &StubTranscriber{Text: config.StubText}
+	}
+}
+
+// 占位实现 用于没有识别引擎的环境
+type StubTranscriber struct {
+	Text string
+}
+
+func (t *StubTranscriber) Transcribe(wavPath string) (string, error) {
+	if t.Text == "" {
+		return "", ErrNotConfigured
+	}
+	return t.Text, nil
+}
+
+// 调用本地识别引擎 识别结果从标准输出读取
+type CommandTranscriber struct {
+	Command string
+	Args    []string
+}
+
+func (t *CommandTranscriber) Transcribe(wavPath string) (string, error) {
+	if t.Command == "" {
+		return "", ErrNotConfigured
+	}
+	defer utils.MetricTimeCost("语音识别")()
+	args := make([]string, 0, len(t.Args)+1)
+	replaced := false
+	for _, arg := range t.Args {
+		if strings.Contains(arg, "{file}") {
+			replaced = true
+		}
+		args = append(args, strings.ReplaceAll(arg, "{file}", wavPath))
+	}
+	if !replaced {
+		args = append(args, wavPath)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(t.Command, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.New(err.Error() + ":" + stderr.String())
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// 企业微信的语音为amr格式 转换为识别引擎通用的16k单声道wav
+func ConvertAmrToWav(ffmpeg string, amrPath string) (wavPath string, err error) {
+	if ffmpeg == "" {
+		ffmpeg = "ffmpeg"
+	}
+	wavPath = strings.TrimSuffix(amrPath, filepath.Ext(amrPath)) + ".wav"
+	var stderr bytes.Buffer
+	cmd := exec.Command(ffmpeg, "-y", "-i", amrPath, "-ar", "16000", "-ac", "1", wavPath)
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		err = errors.New("转换语音格式失败:" + err.Error() + ":" + stderr.String())
+	}
+	return
+}
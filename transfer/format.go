@@ -0,0 +1,170 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/xuri/excelize/v2"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// 文件格式
+type Format string
+
+const (
+	FormatCSV   Format = "csv"
+	FormatJSONL Format = "jsonl" // 每行一条JSON记录
+	FormatXLSX  Format = "xlsx"
+)
+
+// Excel打开没有BOM的UTF-8 CSV时中文会乱码
+const bom = "\ufeff"
+
+const sheetName = "records"
+
+// 按名称或文件扩展名确定格式
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "csv":
+		return FormatCSV, nil
+	case "jsonl", "json", "ndjson":
+		return FormatJSONL, nil
+	case "xlsx", "excel":
+		return FormatXLSX, nil
+	}
+	return "", fmt.Errorf("不支持的格式%s 可用的格式: csv jsonl xlsx", name)
+}
+
+func FormatOf(path string) (Format, error) {
+	return ParseFormat(filepath.Ext(path))
+}
+
+// 导出记录
+func Export(writer io.Writer, format Format, records []Record) error {
+	switch format {
+	case FormatCSV:
+		if _, err := io.WriteString(writer, bom); err != nil {
+			return err
+		}
+		csvWriter := csv.NewWriter(writer)
+		if err := csvWriter.Write(columns); err != nil {
+			return err
+		}
+		for _, record := range records {
+			row, err := record.row()
+			if err != nil {
+				return err
+			}
+			if err := csvWriter.Write(row); err != nil {
+				return err
+			}
+		}
+		csvWriter.Flush()
+		return csvWriter.Error()
+	case FormatJSONL:
+		encoder := json.NewEncoder(writer)
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatXLSX:
+		file := excelize.NewFile()
+		file.SetSheetName("Sheet1", sheetName)
+		rows := [][]string{columns}
+		for _, record := range records {
+			row, err := record.row()
+			if err != nil {
+				return err
+			}
+			rows = append(rows, row)
+		}
+		for i, row := range rows {
+			cells := make([]interface{}, len(row))
+			for j, cell := range row {
+				cells[j] = cell
+			}
+			cell, err := excelize.CoordinatesToCellName(1, i+1)
+			if err != nil {
+				return err
+			}
+			if err := file.SetSheetRow(sheetName, cell, &cells); err != nil {
+				return err
+			}
+		}
+		return file.Write(writer)
+	}
+	return fmt.Errorf("不支持的格式%s", format)
+}
+
+// 文件中的一行 Line为行号 表格的第一行为列名
+type sourceRow struct {
+	Line   int
+	Record Record
+	Err    error
+}
+
+// 读取文件中的记录 文件无法解析时返回错误 单行的错误记录在sourceRow中
+func read(reader io.Reader, format Format) (rows []sourceRow, err error) {
+	switch format {
+	case FormatCSV:
+		csvReader := csv.NewReader(reader)
+		csvReader.FieldsPerRecord = -1
+		table, err := csvReader.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		return readTable(table)
+	case FormatJSONL:
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			text := bytes.TrimSpace(scanner.Bytes())
+			if len(text) == 0 {
+				continue
+			}
+			row := sourceRow{Line: line}
+			if err := json.Unmarshal(text, &row.Record); err != nil {
+				row.Err = fmt.Errorf("无法解析JSON %s", err.Error())
+			}
+			rows = append(rows, row)
+		}
+		return rows, scanner.Err()
+	case FormatXLSX:
+		file, err := excelize.OpenReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		// 读取第一个工作表
+		table, err := file.GetRows(file.GetSheetList()[0])
+		if err != nil {
+			return nil, err
+		}
+		return readTable(table)
+	}
+	return nil, fmt.Errorf("不支持的格式%s", format)
+}
+
+func readTable(table [][]string) (rows []sourceRow, err error) {
+	if len(table) == 0 {
+		return nil, fmt.Errorf("文件为空")
+	}
+	h, err := newHeader(table[0])
+	if err != nil {
+		return nil, err
+	}
+	for i, cells := range table[1:] {
+		if emptyRow(cells) {
+			continue
+		}
+		row := sourceRow{Line: i + 2}
+		row.Record, row.Err = h.record(cells)
+		rows = append(rows, row)
+	}
+	return
+}
@@ -0,0 +1,185 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/dao"
+	"wxbot-lostandfound/utils"
+)
+
+// 导入选项
+type ImportOptions struct {
+	User   string                     // 进行导入的用户 没有填写登记人时作为登记人
+	Tagger func(text string) []string // 没有填写标签时根据城市、物品名称和描述生成标签
+	Now    time.Time                  // 没有填写创建时间时使用
+	DryRun bool                       // 只检查不导入
+}
+
+// 有错误的行
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("第%d行: %s", e.Line, e.Err.Error())
+}
+
+// 纸质登记簿中常用的类型名称
+var kindAliases = map[string]conversation.RecordKind{
+	"丢失": conversation.KindLost, "失物": conversation.KindLost,
+	"捡到": conversation.KindFound, "拾获": conversation.KindFound, "招领": conversation.KindFound,
+}
+
+// 导入记录 所有行都检查通过后才在同一个事务中导入,有错误时不导入任何记录
+// 返回导入的记录数和有错误的行 err为文件无法读取或数据库出错
+func Import(repository dao.RecordRepository, reader io.Reader, format Format, options ImportOptions) (count int, rowErrors []RowError, err error) {
+	rows, err := read(reader, format)
+	if err != nil {
+		return 0, nil, err
+	}
+	if options.Now.IsZero() {
+		options.Now = time.Now()
+	}
+	imports := make([]dao.RecordImport, 0, len(rows))
+	for _, row := range rows {
+		if row.Err != nil {
+			rowErrors = append(rowErrors, RowError{row.Line, row.Err})
+			continue
+		}
+		recordImport, err := toImport(row.Record, options)
+		if err != nil {
+			rowErrors = append(rowErrors, RowError{row.Line, err})
+			continue
+		}
+		imports = append(imports, recordImport)
+	}
+	if len(rowErrors) > 0 || options.DryRun {
+		return 0, rowErrors, nil
+	}
+	if err = repository.ImportRecords(imports); err != nil {
+		// 有错误的行已经排除 imports与rows一一对应
+		var importErr *dao.ImportError
+		if errors.As(err, &importErr) {
+			return 0, []RowError{{rows[importErr.Index].Line, importErr.Err}}, nil
+		}
+		return 0, nil, err
+	}
+	return len(imports), nil, nil
+}
+
+// 检查一行并转换为数据库中的记录
+func toImport(record Record, options ImportOptions) (recordImport dao.RecordImport, err error) {
+	kind, exist := kindAliases[strings.TrimSpace(record.Type)]
+	if !exist {
+		if kind, err = conversation.ParseKind(record.Type); err != nil {
+			return recordImport, fmt.Errorf("无效的类型%s 可用的类型: lost found", record.Type)
+		}
+	}
+	if strings.TrimSpace(record.ItemName) == "" {
+		return recordImport, fmt.Errorf("物品名称不能为空")
+	}
+	status := dao.StatusOpen
+	if record.Status != "" {
+		if status = dao.RecordStatus(record.Status); !status.IsValid() {
+			return recordImport, fmt.Errorf("无效的状态%s", record.Status)
+		}
+	}
+	city := record.City
+	if record.Location != "" {
+		if utils.FindLocation(record.Location) == nil {
+			return recordImport, fmt.Errorf("未知的地点%s", record.Location)
+		}
+		if city == "" {
+			city = utils.CityOfPath(record.Location)
+		}
+	} else if city != "" && utils.FindLocation(city) == nil {
+		return recordImport, fmt.Errorf("未知的城市%s", city)
+	}
+	// 图片由服务以imgs目录中的文件名访问
+	if strings.ContainsAny(record.ImageKey, `/\`) || record.ImageKey == ".." {
+		return recordImport, fmt.Errorf("无效的图片名称%s", record.ImageKey)
+	}
+	// 验证问题和答案需要同时填写 否则无法认领
+	if (record.VerifyQuestion == "") != (record.VerifyAnswer == "") {
+		return recordImport, fmt.Errorf("验证问题和答案需要同时填写")
+	}
+	tags := record.Tags
+	if len(tags) == 0 && options.Tagger != nil {
+		tags = options.Tagger(city + record.ItemName + record.Description)
+	}
+	user := record.User
+	if user == "" {
+		user = options.User
+	}
+	item := dao.ItemRecord{
+		Type:           kind,
+		ItemName:       strings.TrimSpace(record.ItemName),
+		User:           user,
+		CompleteUser:   record.CompleteUser,
+		Tags:           strings.Join(tags, ","),
+		City:           city,
+		Location:       record.Location,
+		Description:    record.Description,
+		ImgName:        record.ImageKey,
+		Status:         status,
+		Sensitive:      record.Sensitive || utils.IsSensitive(tags),
+		VerifyQuestion: record.VerifyQuestion,
+		VerifyAnswer:   record.VerifyAnswer,
+		PickupLocation: record.PickupLocation,
+		CreatedAt:      options.Now,
+	}
+	if record.OccurredAt != "" {
+		occurredAt, err := parseTime(record.OccurredAt)
+		if err != nil {
+			return recordImport, err
+		}
+		item.OccurredAt = &occurredAt
+	}
+	if record.CreatedAt != "" {
+		if item.CreatedAt, err = parseTime(record.CreatedAt); err != nil {
+			return recordImport, err
+		}
+	}
+	recordImport.Record = item
+	for i, history := range record.StatusHistory {
+		from, to := dao.RecordStatus(history.From), dao.RecordStatus(history.To)
+		if !from.IsValid() || !to.IsValid() {
+			return recordImport, fmt.Errorf("状态历史第%d项的状态无效", i+1)
+		}
+		role := dao.Role(history.Role)
+		if !role.IsValid() {
+			return recordImport, fmt.Errorf("状态历史第%d项的角色%s无效 可用的角色: owner claimant admin system", i+1, history.Role)
+		}
+		createdAt := options.Now
+		if history.CreatedAt != "" {
+			if createdAt, err = parseTime(history.CreatedAt); err != nil {
+				return recordImport, err
+			}
+		}
+		recordImport.History = append(recordImport.History, dao.RecordStatusHistory{
+			FromStatus: from,
+			ToStatus:   to,
+			Operator:   history.Operator,
+			Role:       role,
+			Note:       history.Note,
+			CreatedAt:  createdAt,
+		})
+	}
+	// 导入时已经不是未完成状态的记录 补充一条变更历史
+	if len(recordImport.History) == 0 && status != dao.StatusOpen {
+		recordImport.History = []dao.RecordStatusHistory{{
+			FromStatus: dao.StatusOpen,
+			ToStatus:   status,
+			Operator:   options.User,
+			Role:       dao.RoleAdmin,
+			Note:       "导入",
+			CreatedAt:  options.Now,
+		}}
+	}
+	return
+}
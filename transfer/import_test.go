@@ -0,0 +1,81 @@
+package transfer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"wxbot-lostandfound/conversation"
+	"wxbot-lostandfound/dao"
+)
+
+func newTestRepository(t *testing.T) *dao.GormRepository {
+	repository, err := dao.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repository
+}
+
+// 导出后再导入 验证问题和敏感标记保持不变
+func TestExportImport(t *testing.T) {
+	occurredAt := time.Date(2024, 3, 13, 15, 0, 0, 0, time.Local)
+	record := dao.ItemRecord{
+		Id:             12,
+		Type:           conversation.KindFound,
+		Status:         dao.StatusClaimed,
+		ItemName:       "工牌",
+		Description:    "蓝色挂绳",
+		Tags:           "工牌,证件",
+		PickupLocation: "前台",
+		Sensitive:      true,
+		VerifyQuestion: "工牌上的姓氏",
+		VerifyAnswer:   "王",
+		User:           "u1",
+		OccurredAt:     &occurredAt,
+		CreatedAt:      occurredAt,
+	}
+	histories := []dao.RecordStatusHistory{{FromStatus: dao.StatusOpen, ToStatus: dao.StatusClaimed, Operator: "u2", Role: dao.RoleClaimant, CreatedAt: occurredAt}}
+	for _, format := range []Format{FormatCSV, FormatJSONL, FormatXLSX} {
+		var buffer bytes.Buffer
+		if err := Export(&buffer, format, []Record{NewRecord(record, histories)}); err != nil {
+			t.Fatal(err)
+		}
+		repository := newTestRepository(t)
+		count, rowErrors, err := Import(repository, &buffer, format, ImportOptions{User: "admin"})
+		if err != nil || len(rowErrors) != 0 || count != 1 {
+			t.Fatalf("%s: 导入 %d %v %v", format, count, rowErrors, err)
+		}
+		imported := repository.GetRecord(dao.RecordFilter{Statuses: dao.Statuses})[0]
+		if imported.ItemName != record.ItemName || imported.Status != record.Status || imported.Tags != record.Tags ||
+			!imported.Sensitive || imported.VerifyQuestion != record.VerifyQuestion || imported.VerifyAnswer != record.VerifyAnswer ||
+			imported.PickupLocation != record.PickupLocation || !imported.OccurredAt.Equal(occurredAt) {
+			t.Errorf("%s: 导入的记录 %+v", format, imported)
+		}
+		if history := repository.GetStatusHistory(imported.Id); len(history) != 1 || history[0].Role != dao.RoleClaimant {
+			t.Errorf("%s: 状态历史 %+v", format, history)
+		}
+	}
+}
+
+func TestImportRowErrors(t *testing.T) {
+	csv := strings.Join([]string{
+		"type,item_name,status,verify_question,verify_answer,sensitive,status_history",
+		`found,雨伞,claimed,,,,"[{""from"":""open"",""to"":""claimed"",""role"":""guest""}]"`,
+		`found,雨伞,,伞柄的颜色,,,`,
+		`found,雨伞,,,,maybe,`,
+		`found,雨伞,claimed,,,,"[{""from"":""open"",""to"":""claimed"",""role"":""claimant""}]"`,
+	}, "\n")
+	repository := newTestRepository(t)
+	count, rowErrors, err := Import(repository, strings.NewReader(csv), FormatCSV, ImportOptions{User: "admin"})
+	if err != nil || count != 0 {
+		t.Fatalf("有错误时不导入 %d %v", count, err)
+	}
+	lines := map[int]bool{}
+	for _, rowError := range rowErrors {
+		lines[rowError.Line] = true
+	}
+	if len(rowErrors) != 3 || !lines[2] || !lines[3] || !lines[4] {
+		t.Errorf("有错误的行 %v", rowErrors)
+	}
+}
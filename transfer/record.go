@@ -0,0 +1,205 @@
+package transfer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"wxbot-lostandfound/dao"
+)
+
+// 导入导出的记录 三种格式使用相同的字段 时间为RFC3339格式
+type Record struct {
+	Id             int64     `json:"id"` // 导入时忽略 总是创建新的记录
+	Type           string    `json:"type"`
+	Status         string    `json:"status"`
+	ItemName       string    `json:"item_name"`
+	Description    string    `json:"description"`
+	Tags           []string  `json:"tags"`
+	City           string    `json:"city"`
+	Location       string    `json:"location"`
+	PickupLocation string    `json:"pickup_location"`
+	Sensitive      bool      `json:"sensitive"`
+	VerifyQuestion string    `json:"verify_question"` // 认领时需要回答的问题 导出文件中包含答案 需要妥善保管
+	VerifyAnswer   string    `json:"verify_answer"`
+	ImageKey       string    `json:"image_key"` // imgs目录中的图片名称
+	User           string    `json:"user"`
+	CompleteUser   string    `json:"complete_user"`
+	OccurredAt     string    `json:"occurred_at"`
+	CreatedAt      string    `json:"created_at"`
+	StatusHistory  []History `json:"status_history"`
+}
+
+// 状态变更历史
+type History struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Operator  string `json:"operator"`
+	Role      string `json:"role"`
+	Note      string `json:"note"`
+	CreatedAt string `json:"created_at"`
+}
+
+// 表格的列 CSV和XLSX的第一行
+var columns = []string{"id", "type", "status", "item_name", "description", "tags", "city", "location",
+	"pickup_location", "sensitive", "verify_question", "verify_answer", "image_key", "user", "complete_user", "occurred_at", "created_at", "status_history"}
+
+// 导入时也可以使用中文列名 与命令行中记录详情的名称相同
+var columnAliases = map[string]string{
+	"类型": "type", "状态": "status", "物品": "item_name", "描述": "description", "标签": "tags",
+	"城市": "city", "地点": "location", "取回地点": "pickup_location",
+	"敏感": "sensitive", "验证问题": "verify_question", "验证答案": "verify_answer", "图片": "image_key",
+	"登记人": "user", "完成人": "complete_user", "时间": "occurred_at", "创建时间": "created_at", "状态历史": "status_history",
+}
+
+func NewRecord(record dao.ItemRecord, histories []dao.RecordStatusHistory) Record {
+	exported := Record{
+		Id:             record.Id,
+		Type:           record.Type.String(),
+		Status:         string(record.Status),
+		ItemName:       record.ItemName,
+		Description:    record.Description,
+		Tags:           splitTags(record.Tags),
+		City:           record.City,
+		Location:       record.Location,
+		PickupLocation: record.PickupLocation,
+		Sensitive:      record.Sensitive,
+		VerifyQuestion: record.VerifyQuestion,
+		VerifyAnswer:   record.VerifyAnswer,
+		ImageKey:       record.ImgName,
+		User:           record.User,
+		CompleteUser:   record.CompleteUser,
+		CreatedAt:      formatTime(record.CreatedAt),
+		StatusHistory:  []History{},
+	}
+	if record.OccurredAt != nil {
+		exported.OccurredAt = formatTime(*record.OccurredAt)
+	}
+	for _, history := range histories {
+		exported.StatusHistory = append(exported.StatusHistory, History{
+			From:      string(history.FromStatus),
+			To:        string(history.ToStatus),
+			Operator:  history.Operator,
+			Role:      string(history.Role),
+			Note:      history.Note,
+			CreatedAt: formatTime(history.CreatedAt),
+		})
+	}
+	return exported
+}
+
+// 表格中的一行 标签用逗号分隔 状态历史为JSON
+func (r Record) row() ([]string, error) {
+	history, err := json.Marshal(r.StatusHistory)
+	if err != nil {
+		return nil, err
+	}
+	return []string{strconv.FormatInt(r.Id, 10), r.Type, r.Status, r.ItemName, r.Description, strings.Join(r.Tags, ","),
+		r.City, r.Location, r.PickupLocation, strconv.FormatBool(r.Sensitive), r.VerifyQuestion, r.VerifyAnswer, r.ImageKey, r.User, r.CompleteUser, r.OccurredAt, r.CreatedAt, string(history)}, nil
+}
+
+// 表格的列名 -> 列的位置
+type header map[string]int
+
+func newHeader(names []string) (header, error) {
+	h := header{}
+	for i, name := range names {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, bom)))
+		if alias, exist := columnAliases[name]; exist {
+			name = alias
+		}
+		h[name] = i
+	}
+	for _, required := range []string{"type", "item_name"} {
+		if _, exist := h[required]; !exist {
+			return nil, fmt.Errorf("缺少%s列", required)
+		}
+	}
+	return h, nil
+}
+
+// 按列名读取表格中的一行 缺少的列为空
+func (h header) record(row []string) (record Record, err error) {
+	get := func(name string) string {
+		if i, exist := h[name]; exist && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	record = Record{
+		Type:           get("type"),
+		Status:         get("status"),
+		ItemName:       get("item_name"),
+		Description:    get("description"),
+		Tags:           splitTags(get("tags")),
+		City:           get("city"),
+		Location:       get("location"),
+		PickupLocation: get("pickup_location"),
+		VerifyQuestion: get("verify_question"),
+		VerifyAnswer:   get("verify_answer"),
+		ImageKey:       get("image_key"),
+		User:           get("user"),
+		CompleteUser:   get("complete_user"),
+		OccurredAt:     get("occurred_at"),
+		CreatedAt:      get("created_at"),
+	}
+	if sensitive := get("sensitive"); sensitive != "" {
+		if record.Sensitive, err = parseBool(sensitive); err != nil {
+			return
+		}
+	}
+	if history := get("status_history"); history != "" {
+		if err = json.Unmarshal([]byte(history), &record.StatusHistory); err != nil {
+			err = fmt.Errorf("无法解析状态历史 %s", err.Error())
+		}
+	}
+	return
+}
+
+// 空行不导入
+func emptyRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// 逗号分隔的标签 也可以使用中文逗号
+func splitTags(text string) (tags []string) {
+	for _, tag := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == '，' }) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return
+}
+
+// 表格中的是否 也可以使用中文
+func parseBool(text string) (bool, error) {
+	switch strings.ToLower(text) {
+	case "true", "1", "yes", "是":
+		return true, nil
+	case "false", "0", "no", "否":
+		return false, nil
+	}
+	return false, fmt.Errorf("无效的是否%s 可用的值: true false", text)
+}
+
+func formatTime(t time.Time) string {
+	return t.Local().Format(time.RFC3339)
+}
+
+// 导入时可以使用的时间格式 没有时区时使用本地时区
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02", "2006/01/02 15:04", "2006/01/02"}
+
+func parseTime(text string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, text, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无效的时间%s", text)
+}
@@ -0,0 +1,282 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 中文自然语言时间解析 如 昨天下午、上周五、3月2日、3天前、最近一周
+// 解析结果为时间范围 [start, end), 只精确到天的表达式返回一整天
+
+var (
+	ErrNoTimeExpression = errors.New("无法识别的时间")
+	ErrFutureTime       = errors.New("时间晚于当前时间") // 丢失或捡到物品的时间不会在未来
+)
+
+const chineseNumber = `[\d零一二两三四五六七八九十]`
+
+var (
+	// 没有年份时 . 和 - 分隔的日期需要以日或号结尾 避免把 3.5寸 1-2个 识别为日期
+	dateExpression   = `今天|今日|昨天|昨日|大前天|前天|刚才|刚刚|(?:上个?|这个?|本|下个?)?(?:周|星期|礼拜)[一二三四五六日天1-7]|\d{4}[年/.\-]\d{1,2}[月/.\-]\d{1,2}[日号]?|\d{1,2}[月/]\d{1,2}[日号]?|\d{1,2}[.\-]\d{1,2}[日号]|\d{1,2}[日号]|` + chineseNumber + `+天前`
+	periodExpression = `凌晨|早上|早晨|上午|中午|下午|傍晚|晚上|夜里|半夜`
+	clockExpression  = chineseNumber + `{1,3}(?:点|时|:|：)(?:\d{1,2}分?|半)?`
+	timeRegexp       = regexp.MustCompile(`(` + dateExpression + `)?(` + periodExpression + `)?(` + clockExpression + `)?`)
+	recentRegexp     = regexp.MustCompile(`(?:最近|近)(` + chineseNumber + `+)(天|周|个月)|(` + chineseNumber + `+)(天|周|个月)内`)
+
+	weekdayRegexp  = regexp.MustCompile(`^(上个?|这个?|本|下个?)?(?:周|星期|礼拜)([一二三四五六日天1-7])$`)
+	monthDayRegexp = regexp.MustCompile(`^(?:(\d{4})[年/.\-])?(\d{1,2})[月/.\-](\d{1,2})[日号]?$`)
+	dayRegexp      = regexp.MustCompile(`^(\d{1,2})[日号]$`)
+	daysAgoRegexp  = regexp.MustCompile(`^(` + chineseNumber + `+)天前$`)
+	clockRegexp    = regexp.MustCompile(`^(` + chineseNumber + `{1,3})(?:点|时|:|：)(\d{1,2}|半)?分?$`)
+
+	// 时段对应的小时范围
+	periodHours = map[string][2]int{
+		"凌晨": {0, 6},
+		"半夜": {0, 4},
+		"早上": {6, 9},
+		"早晨": {6, 9},
+		"上午": {8, 12},
+		"中午": {11, 14},
+		"下午": {12, 18},
+		"傍晚": {17, 19},
+		"晚上": {18, 24},
+		"夜里": {20, 24},
+	}
+	weekdays = map[string]time.Weekday{
+		"一": time.Monday, "二": time.Tuesday, "三": time.Wednesday, "四": time.Thursday,
+		"五": time.Friday, "六": time.Saturday, "日": time.Sunday, "天": time.Sunday,
+		"1": time.Monday, "2": time.Tuesday, "3": time.Wednesday, "4": time.Thursday,
+		"5": time.Friday, "6": time.Saturday, "7": time.Sunday,
+	}
+)
+
+// 日期后面是这些字时为楼号、线路、出口等地点 如 3号楼 1号线 2号口
+const placeSuffixes = "楼线门口层"
+
+// 在文本中查找第一个时间表达式
+func FindTimeExpression(text string) string {
+	if match := recentRegexp.FindString(text); match != "" {
+		return match
+	}
+	for _, index := range timeRegexp.FindAllStringSubmatchIndex(text, -1) {
+		if index[0] == index[1] {
+			continue
+		}
+		datePart, periodPart, clockPart := submatch(text, index, 1), submatch(text, index, 2), submatch(text, index, 3)
+		if strings.HasSuffix(datePart, "号") || strings.HasSuffix(datePart, "日") {
+			if next := []rune(text[index[1]:]); periodPart == "" && clockPart == "" && len(next) > 0 && strings.ContainsRune(placeSuffixes, next[0]) {
+				continue
+			}
+		}
+		// 只有中文数字的 一点 可能是 有一点划痕 需要有日期或时段
+		if datePart == "" && periodPart == "" && !strings.ContainsAny(clockPart, "0123456789") {
+			continue
+		}
+		return text[index[0]:index[1]]
+	}
+	return ""
+}
+
+func submatch(text string, index []int, group int) string {
+	if index[2*group] < 0 {
+		return ""
+	}
+	return text[index[2*group]:index[2*group+1]]
+}
+
+// 解析时间 返回时间范围的开始
+func ParseTime(text string, now time.Time) (time.Time, error) {
+	start, _, err := ParseTimeRange(text, now)
+	return start, err
+}
+
+// 解析时间范围
+func ParseTimeRange(text string, now time.Time) (start time.Time, end time.Time, err error) {
+	text = strings.TrimSpace(text)
+	if match := recentRegexp.FindStringSubmatch(text); match != nil {
+		number, unit := match[1], match[2]
+		if number == "" {
+			number, unit = match[3], match[4]
+		}
+		n, ok := parseChineseNumber(number)
+		if !ok {
+			return start, end, ErrNoTimeExpression
+		}
+		switch unit {
+		case "天":
+			start = startOfDay(now).AddDate(0, 0, -n+1)
+		case "周":
+			start = startOfDay(now).AddDate(0, 0, -7*n+1)
+		case "个月":
+			start = startOfDay(now).AddDate(0, -n, 0)
+		}
+		return start, now, nil
+	}
+	expression := FindTimeExpression(text)
+	if expression == "" {
+		return start, end, ErrNoTimeExpression
+	}
+	match := timeRegexp.FindStringSubmatch(expression)
+	datePart, periodPart, clockPart := match[1], match[2], match[3]
+	if datePart == "刚才" || datePart == "刚刚" {
+		return now.Add(-time.Hour), now, nil
+	}
+	day := startOfDay(now)
+	if datePart != "" {
+		if day, err = parseDate(datePart, now); err != nil {
+			return
+		}
+	}
+	start, end = day, day.AddDate(0, 0, 1)
+	if hours, ok := periodHours[periodPart]; ok {
+		start, end = day.Add(time.Duration(hours[0])*time.Hour), day.Add(time.Duration(hours[1])*time.Hour)
+	}
+	if clockPart != "" {
+		clockMatch := clockRegexp.FindStringSubmatch(clockPart)
+		if clockMatch == nil {
+			return start, end, ErrNoTimeExpression
+		}
+		hour, ok := parseChineseNumber(clockMatch[1])
+		if !ok || hour > 24 {
+			return start, end, ErrNoTimeExpression
+		}
+		minute := 0
+		if clockMatch[2] == "半" {
+			minute = 30
+		} else if clockMatch[2] != "" {
+			minute, _ = strconv.Atoi(clockMatch[2])
+		}
+		// 下午三点 -> 15点
+		if hour < 12 && (periodPart == "下午" || periodPart == "傍晚" || periodPart == "晚上" || periodPart == "夜里") {
+			hour += 12
+		}
+		start = day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+		end = start.Add(time.Hour)
+	}
+	if start.After(now) {
+		return start, end, ErrFutureTime
+	}
+	return start, end, nil
+}
+
+// 解析日期部分 返回当天零点
+func parseDate(text string, now time.Time) (day time.Time, err error) {
+	today := startOfDay(now)
+	switch text {
+	case "今天", "今日":
+		return today, nil
+	case "昨天", "昨日":
+		return today.AddDate(0, 0, -1), nil
+	case "前天":
+		return today.AddDate(0, 0, -2), nil
+	case "大前天":
+		return today.AddDate(0, 0, -3), nil
+	}
+	if match := weekdayRegexp.FindStringSubmatch(text); match != nil {
+		// 周一作为一周的开始
+		offset := (int(today.Weekday()) + 6) % 7
+		monday := today.AddDate(0, 0, -offset)
+		target := (int(weekdays[match[2]]) + 6) % 7
+		switch match[1] {
+		case "上", "上个":
+			return monday.AddDate(0, 0, target-7), nil
+		case "下", "下个":
+			return monday.AddDate(0, 0, target+7), nil
+		case "这", "这个", "本":
+			return monday.AddDate(0, 0, target), nil
+		default:
+			// 只说了周几时取最近已经过去的那一天
+			day = monday.AddDate(0, 0, target)
+			if day.After(today) {
+				day = day.AddDate(0, 0, -7)
+			}
+			return day, nil
+		}
+	}
+	if match := monthDayRegexp.FindStringSubmatch(text); match != nil {
+		month, _ := strconv.Atoi(match[2])
+		dayOfMonth, _ := strconv.Atoi(match[3])
+		year := now.Year()
+		if match[1] != "" {
+			year, _ = strconv.Atoi(match[1])
+		}
+		// 没有写年份且日期在未来时认为是去年
+		if match[1] == "" && time.Date(year, time.Month(month), dayOfMonth, 0, 0, 0, 0, now.Location()).After(today) {
+			year--
+		}
+		return validDate(year, time.Month(month), dayOfMonth, now.Location())
+	}
+	if match := dayRegexp.FindStringSubmatch(text); match != nil {
+		dayOfMonth, _ := strconv.Atoi(match[1])
+		year, month := now.Year(), now.Month()
+		// 日期在未来时认为是上个月
+		if dayOfMonth > now.Day() {
+			month--
+			if month < time.January {
+				year, month = year-1, time.December
+			}
+		}
+		return validDate(year, month, dayOfMonth, now.Location())
+	}
+	if match := daysAgoRegexp.FindStringSubmatch(text); match != nil {
+		n, ok := parseChineseNumber(match[1])
+		if !ok {
+			return day, ErrNoTimeExpression
+		}
+		return today.AddDate(0, 0, -n), nil
+	}
+	return day, ErrNoTimeExpression
+}
+
+// 解析阿拉伯数字或者一百以内的中文数字
+func parseChineseNumber(text string) (int, bool) {
+	if n, err := strconv.Atoi(text); err == nil {
+		return n, true
+	}
+	digits := map[rune]int{'零': 0, '一': 1, '二': 2, '两': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9}
+	runes := []rune(text)
+	if len(runes) == 0 {
+		return 0, false
+	}
+	tens, ones := 0, 0
+	for i, r := range runes {
+		if r == '十' {
+			tens = 1
+			if i > 0 {
+				tens = ones
+			}
+			ones = 0
+			continue
+		}
+		digit, ok := digits[r]
+		if !ok {
+			return 0, false
+		}
+		ones = digit
+	}
+	return tens*10 + ones, true
+}
+
+// 不存在的日期如 2月30日 不会顺延到下个月
+func validDate(year int, month time.Month, dayOfMonth int, loc *time.Location) (time.Time, error) {
+	day := time.Date(year, month, dayOfMonth, 0, 0, 0, 0, loc)
+	if month < time.January || month > time.December || day.Month() != month || day.Day() != dayOfMonth {
+		return day, ErrNoTimeExpression
+	}
+	return day, nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// 格式化时间 只精确到天时不显示时分
+func FormatTime(t time.Time) string {
+	if t.Equal(startOfDay(t)) {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02 15:04")
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// 2024-03-13 周三 15:00
+var testNow = time.Date(2024, 3, 13, 15, 0, 0, 0, time.Local)
+
+func day(month time.Month, d int) time.Time {
+	return time.Date(2024, month, d, 0, 0, 0, 0, time.Local)
+}
+
+func TestParseTimeRange(t *testing.T) {
+	cases := []struct {
+		text  string
+		start time.Time
+		end   time.Time
+	}{
+		{"今天", day(3, 13), day(3, 14)},
+		{"昨天下午", day(3, 12).Add(12 * time.Hour), day(3, 12).Add(18 * time.Hour)},
+		{"前天", day(3, 11), day(3, 12)},
+		{"大前天", day(3, 10), day(3, 11)},
+		{"上周五", day(3, 8), day(3, 9)},
+		{"周五", day(3, 8), day(3, 9)},
+		{"这周一", day(3, 11), day(3, 12)},
+		{"星期天", day(3, 10), day(3, 11)},
+		{"3月2日", day(3, 2), day(3, 3)},
+		{"12月5号", time.Date(2023, 12, 5, 0, 0, 0, 0, time.Local), time.Date(2023, 12, 6, 0, 0, 0, 0, time.Local)},
+		{"2023.3.5", time.Date(2023, 3, 5, 0, 0, 0, 0, time.Local), time.Date(2023, 3, 6, 0, 0, 0, 0, time.Local)},
+		{"2023-3-5", time.Date(2023, 3, 5, 0, 0, 0, 0, time.Local), time.Date(2023, 3, 6, 0, 0, 0, 0, time.Local)},
+		{"3/5", day(3, 5), day(3, 6)},
+		{"3.5号", day(3, 5), day(3, 6)},
+		{"5号", day(3, 5), day(3, 6)},
+		{"3天前", day(3, 10), day(3, 11)},
+		{"三天前", day(3, 10), day(3, 11)},
+		{"昨天下午三点", day(3, 12).Add(15 * time.Hour), day(3, 12).Add(16 * time.Hour)},
+		{"上午10点半", day(3, 13).Add(10*time.Hour + 30*time.Minute), day(3, 13).Add(11*time.Hour + 30*time.Minute)},
+		{"刚才", testNow.Add(-time.Hour), testNow},
+		{"最近一周", day(3, 7), testNow},
+		{"3天内", day(3, 11), testNow},
+		{"我昨天在西溪园区3楼丢了耳机", day(3, 12), day(3, 13)},
+		{"下午一点", day(3, 13).Add(13 * time.Hour), day(3, 13).Add(14 * time.Hour)},
+		{"昨天一点", day(3, 12).Add(time.Hour), day(3, 12).Add(2 * time.Hour)},
+		{"10点", day(3, 13).Add(10 * time.Hour), day(3, 13).Add(11 * time.Hour)},
+		// 楼号等不影响后面的时间
+		{"3号楼会议室 昨天丢的", day(3, 12), day(3, 13)},
+		// 日期在未来时为上个月
+		{"29号", day(2, 29), day(3, 1)},
+		{"2月29日", day(2, 29), day(3, 1)},
+	}
+	for _, c := range cases {
+		start, end, err := ParseTimeRange(c.text, testNow)
+		if err != nil {
+			t.Errorf("%s: %v", c.text, err)
+			continue
+		}
+		if !start.Equal(c.start) || !end.Equal(c.end) {
+			t.Errorf("%s: 期望 [%s, %s) 实际 [%s, %s)", c.text, c.start, c.end, start, end)
+		}
+	}
+}
+
+func TestParseTimeRangeNoExpression(t *testing.T) {
+	for _, text := range []string{"", "没有时间", "3.5寸的屏幕", "1-2个", "捡到2.5元", "13月5日",
+		// 楼号、线路和出口
+		"杭州3号楼会议室丢了耳机", "1号线地铁上捡到", "在5号口捡到", "2号门", "8层",
+		// 中文数字的 一点 不是时间
+		"手机有一点划痕", "三点水",
+		// 不存在的日期不会顺延
+		"2月30日", "2023年2月29日", "4月31号", "31号",
+	} {
+		if start, _, err := ParseTimeRange(text, testNow); err == nil {
+			t.Errorf("%s: 不应识别为时间 %s", text, start)
+		}
+	}
+}
+
+// 丢失或捡到物品的时间不会在未来
+func TestParseTimeRangeFuture(t *testing.T) {
+	for _, text := range []string{"下周五", "这周五", "晚上8点", "2025年3月2日"} {
+		if start, _, err := ParseTimeRange(text, testNow); err != ErrFutureTime {
+			t.Errorf("%s: 应该拒绝未来的时间 %s %v", text, start, err)
+		}
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	if got := FormatTime(day(3, 12)); got != "2024-03-12" {
+		t.Errorf("只精确到天 %s", got)
+	}
+	if got := FormatTime(day(3, 12).Add(15*time.Hour + 4*time.Minute)); got != "2024-03-12 15:04" {
+		t.Errorf("精确到分钟 %s", got)
+	}
+}
@@ -0,0 +1,241 @@
+package utils
+
+import (
+	"math"
+	"strings"
+	"sync"
+)
+
+// 地点 按 城市 -> 园区/楼栋 -> 楼层 -> 会议室 的层级组织
+type Location struct {
+	Name      string
+	Latitude  float64 // 可选的坐标 用于将位置消息匹配到最近的办公地点
+	Longitude float64
+	Children  []*Location
+	parent    *Location
+}
+
+// 经纬度坐标
+type GeoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+const earthRadiusKm = 6371.0
+
+// 地点路径分隔符 如 杭州/西溪园区/3楼
+const LocationSeparator = "/"
+
+// 当前的地点层级和城市 管理后台修改地点时会在处理消息的同时替换
+var (
+	locationTree []*Location
+	cities       []string
+	locationLock sync.RWMutex
+)
+
+func init() {
+	SetLocations(nil)
+}
+
+// 设置地点层级,未配置时使用默认的城市列表
+// 使用传入地点的副本 已经取得的地点不会被之后的修改影响
+func SetLocations(locations []*Location) {
+	if len(locations) == 0 {
+		locations = make([]*Location, 0, len(defaultCities))
+		for _, city := range defaultCities {
+			locations = append(locations, &Location{Name: city})
+		}
+	}
+	var copyTree func(parent *Location, nodes []*Location) []*Location
+	copyTree = func(parent *Location, nodes []*Location) []*Location {
+		copied := make([]*Location, 0, len(nodes))
+		for _, node := range nodes {
+			child := &Location{Name: node.Name, Latitude: node.Latitude, Longitude: node.Longitude, parent: parent}
+			child.Children = copyTree(child, node.Children)
+			copied = append(copied, child)
+		}
+		return copied
+	}
+	tree := copyTree(nil, locations)
+	names := make([]string, 0, len(tree))
+	for _, city := range tree {
+		names = append(names, city.Name)
+	}
+	locationLock.Lock()
+	locationTree, cities = tree, names
+	locationLock.Unlock()
+}
+
+// 最顶层的地点 即所有城市 返回的切片不能修改
+func Cities() []string {
+	locationLock.RLock()
+	defer locationLock.RUnlock()
+	return cities
+}
+
+// 完整路径
+func (l *Location) Path() string {
+	names := []string{l.Name}
+	for p := l.parent; p != nil; p = p.parent {
+		names = append([]string{p.Name}, names...)
+	}
+	return strings.Join(names, LocationSeparator)
+}
+
+// 所在城市 即最顶层的地点
+func (l *Location) City() string {
+	root := l
+	for root.parent != nil {
+		root = root.parent
+	}
+	return root.Name
+}
+
+// 地点路径的城市部分
+func CityOfPath(path string) string {
+	return strings.SplitN(path, LocationSeparator, 2)[0]
+}
+
+// 根据用户输入和分词得到的地点词匹配地点
+// 路径上匹配的层级越多越优先,存在多个同样优先的地点时全部返回由用户选择
+func MatchLocations(input string, words []string) (matches []*Location) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return
+	}
+	// 直接输入完整路径
+	for _, location := range allLocations() {
+		if location.Path() == input {
+			return []*Location{location}
+		}
+	}
+	nameMatches := func(l *Location) bool {
+		if strings.Contains(input, l.Name) {
+			return true
+		}
+		for _, word := range words {
+			if len([]rune(word)) >= 2 && strings.Contains(l.Name, word) {
+				return true
+			}
+		}
+		return false
+	}
+	bestScore := 0
+	for _, location := range allLocations() {
+		if !nameMatches(location) {
+			continue
+		}
+		score := 0
+		for l := location; l != nil; l = l.parent {
+			if nameMatches(l) {
+				score++
+			}
+		}
+		if score > bestScore {
+			bestScore = score
+			matches = []*Location{location}
+		} else if score == bestScore {
+			matches = append(matches, location)
+		}
+	}
+	return
+}
+
+// 根据路径查找地点
+func FindLocation(path string) *Location {
+	for _, location := range allLocations() {
+		if location.Path() == path {
+			return location
+		}
+	}
+	return nil
+}
+
+func allLocations() (locations []*Location) {
+	var walk func(nodes []*Location)
+	walk = func(nodes []*Location) {
+		for _, node := range nodes {
+			locations = append(locations, node)
+			walk(node.Children)
+		}
+	}
+	locationLock.RLock()
+	tree := locationTree
+	locationLock.RUnlock()
+	walk(tree)
+	return
+}
+
+// 两个坐标之间的球面距离 单位千米
+func Distance(a GeoPoint, b GeoPoint) float64 {
+	toRadian := func(degree float64) float64 { return degree * math.Pi / 180 }
+	dLat := toRadian(b.Latitude - a.Latitude)
+	dLng := toRadian(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadian(a.Latitude))*math.Cos(toRadian(b.Latitude))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// 距离坐标最近的配置了坐标的地点 没有任何地点配置坐标时返回nil
+func NearestLocation(point GeoPoint) (nearest *Location, distance float64) {
+	for _, location := range allLocations() {
+		if location.Latitude == 0 && location.Longitude == 0 {
+			continue
+		}
+		d := Distance(point, GeoPoint{Latitude: location.Latitude, Longitude: location.Longitude})
+		if nearest == nil || d < distance {
+			nearest, distance = location, d
+		}
+	}
+	return
+}
+
+// 以坐标为中心的经纬度范围 用于数据库中的初步筛选
+func BoundingBox(center GeoPoint, radiusKm float64) (min GeoPoint, max GeoPoint) {
+	latDelta := radiusKm / earthRadiusKm * 180 / math.Pi
+	lngDelta := latDelta / math.Max(math.Cos(center.Latitude*math.Pi/180), 0.01)
+	min = GeoPoint{Latitude: center.Latitude - latDelta, Longitude: center.Longitude - lngDelta}
+	max = GeoPoint{Latitude: center.Latitude + latDelta, Longitude: center.Longitude + lngDelta}
+	return
+}
+
+// 以完整路径表示的地点 用于保存和编辑地点层级
+type LocationPath struct {
+	Path      string
+	Latitude  float64
+	Longitude float64
+}
+
+// 当前的地点层级 上级地点在下级地点之前
+func LocationPaths() (paths []LocationPath) {
+	for _, location := range allLocations() {
+		paths = append(paths, LocationPath{Path: location.Path(), Latitude: location.Latitude, Longitude: location.Longitude})
+	}
+	return
+}
+
+// 按路径创建地点层级 缺少的上级地点自动创建
+func BuildLocations(paths []LocationPath) (roots []*Location) {
+	nodes := map[string]*Location{}
+	var node func(path string) *Location
+	node = func(path string) *Location {
+		if location, exist := nodes[path]; exist {
+			return location
+		}
+		i := strings.LastIndex(path, LocationSeparator)
+		location := &Location{Name: path[i+1:]}
+		nodes[path] = location
+		if i < 0 {
+			roots = append(roots, location)
+		} else {
+			parent := node(path[:i])
+			parent.Children = append(parent.Children, location)
+		}
+		return location
+	}
+	for _, path := range paths {
+		location := node(path.Path)
+		location.Latitude, location.Longitude = path.Latitude, path.Longitude
+	}
+	return
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"sync"
+	"testing"
+)
+
+func testLocations() []*Location {
+	return BuildLocations([]LocationPath{
+		{Path: "杭州/西溪园区/3楼", Latitude: 30.28, Longitude: 120.02},
+		{Path: "杭州/滨江园区"},
+		{Path: "上海/虹桥"},
+	})
+}
+
+func TestSetLocations(t *testing.T) {
+	t.Cleanup(func() { SetLocations(nil) })
+	if cities := Cities(); len(cities) != len(defaultCities) {
+		t.Errorf("默认城市 %v", cities)
+	}
+	locations := testLocations()
+	SetLocations(locations)
+	if cities := Cities(); len(cities) != 2 || cities[0] != "杭州" || cities[1] != "上海" {
+		t.Errorf("城市 %v", cities)
+	}
+	floor := FindLocation("杭州/西溪园区/3楼")
+	if floor == nil || floor.City() != "杭州" || floor.Latitude != 30.28 {
+		t.Fatalf("查找地点 %+v", floor)
+	}
+	if FindLocation("杭州/西溪") != nil || FindLocation("北京") != nil {
+		t.Error("不存在的地点")
+	}
+	// 修改传入的地点不影响当前的地点层级
+	locations[0].Name = "成都"
+	if FindLocation("杭州/滨江园区") == nil {
+		t.Error("传入的地点被修改后仍然使用原来的层级")
+	}
+	if matches := MatchLocations("虹桥", nil); len(matches) != 1 || matches[0].Path() != "上海/虹桥" {
+		t.Errorf("匹配地点 %v", matches)
+	}
+	if nearest, _ := NearestLocation(GeoPoint{Latitude: 30.29, Longitude: 120.03}); nearest != floor {
+		t.Errorf("最近的地点 %+v", nearest)
+	}
+	SetLocations(nil)
+	if FindLocation("杭州/滨江园区") != nil || FindLocation("北京") == nil {
+		t.Error("恢复默认城市")
+	}
+}
+
+// 管理后台修改地点的同时处理消息 使用 go test -race 检查
+func TestSetLocationsConcurrent(t *testing.T) {
+	t.Cleanup(func() { SetLocations(nil) })
+	var wait sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wait.Add(2)
+		go func() {
+			defer wait.Done()
+			for j := 0; j < 100; j++ {
+				SetLocations(testLocations())
+			}
+		}()
+		go func() {
+			defer wait.Done()
+			for j := 0; j < 100; j++ {
+				MatchLocations("西溪园区", nil)
+				FindLocation("杭州/滨江园区")
+				IfWordInSlice("杭州", Cities())
+			}
+		}()
+	}
+	wait.Wait()
+}
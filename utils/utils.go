@@ -7,10 +7,20 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
+	"unicode"
 )
 
-var CitySlice = []string{"杭州", "上海", "成都", "广州", "北京"}
+// 没有配置地点时使用的城市
+var defaultCities = []string{"杭州", "上海", "成都", "广州", "北京"}
+
+// 出现这些标签的物品视为敏感物品,公开展示时隐藏图片和号码
+var SensitiveTagSlice = []string{"身份证", "银行卡", "信用卡", "工牌", "护照", "驾驶证", "驾照", "社保卡", "学生证", "门禁卡", "钱包"}
+
+// 连续的数字(可夹杂空格和横线,身份证末位可能为X)
+var numberRegexp = regexp.MustCompile(`[0-9][0-9 \-]{2,}[0-9Xx]`)
 
 func CheckError(err error, where string) {
 	if err != nil {
@@ -56,3 +66,81 @@ func IfWordInSlice(word string, words []string) (found bool) {
 	}
 	return
 }
+
+// 根据标签判断是否为敏感物品
+func IsSensitive(tags []string) bool {
+	for _, tag := range tags {
+		for _, word := range SensitiveTagSlice {
+			if strings.Contains(tag, word) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 将描述中的卡号、证件号等数字替换为*
+func RedactNumbers(text string) string {
+	return numberRegexp.ReplaceAllStringFunc(text, func(number string) string {
+		return strings.Map(func(r rune) rune {
+			if r == ' ' || r == '-' {
+				return r
+			}
+			return '*'
+		}, number)
+	})
+}
+
+// 去除空白和标点并转为小写,用于答案比较
+func normalizeAnswer(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, text)
+}
+
+// 编辑距离
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j] + 1
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+			if prev[j-1]+cost < cur[j] {
+				cur[j] = prev[j-1] + cost
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// 模糊匹配验证问题的答案 忽略大小写和标点,包含正确答案或者相似度不低于80%即视为正确
+// 包含正确答案时正确答案需要占回答的一半以上 避免一次列出多个猜测
+func FuzzyMatch(answer string, expected string) bool {
+	a, e := []rune(normalizeAnswer(answer)), []rune(normalizeAnswer(expected))
+	if len(a) == 0 || len(e) == 0 {
+		return false
+	}
+	if string(a) == string(e) || (len(e) >= 2 && len(e)*2 > len(a) && strings.Contains(string(a), string(e))) {
+		return true
+	}
+	longest := len(a)
+	if len(e) > longest {
+		longest = len(e)
+	}
+	return float64(longest-levenshtein(a, e))/float64(longest) >= 0.8
+}
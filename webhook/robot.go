@@ -0,0 +1,177 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"wxbot-lostandfound/conversation"
+)
+
+// 企业微信群机器人 通过webhook向群聊推送消息
+// 每个机器人每分钟最多发送20条消息
+
+const (
+	FormatMarkdown = "markdown"
+	FormatNews     = "news"
+
+	robotRateLimit  = 20
+	robotRateWindow = time.Minute
+)
+
+// 推送目标 在配置文件中配置
+type Target struct {
+	Name      string
+	Url       string                    // 群机器人的webhook地址 测试时可以指向本地的http服务
+	Locations []string                  // 推送的城市或办公地点路径 为空时推送所有记录
+	Types     []conversation.RecordKind // 推送的记录类型 1 丢失物品 2 捡到物品 为空时都推送
+	Format    string                    // markdown 或 news 默认为markdown
+	Language  string                    // 消息使用的语言 为空时使用默认语言
+}
+
+// 记录的地点和类型是否需要推送到该目标
+func (t Target) Matches(location string, recordType conversation.RecordKind) bool {
+	if len(t.Types) > 0 {
+		matched := false
+		for _, targetType := range t.Types {
+			if targetType == recordType {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(t.Locations) == 0 {
+		return true
+	}
+	for _, targetLocation := range t.Locations {
+		if location == targetLocation || strings.HasPrefix(location, targetLocation+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+type Robot struct {
+	Target  Target
+	limiter *RateLimiter
+	client  *http.Client
+}
+
+func NewRobot(target Target) *Robot {
+	if target.Format == "" {
+		target.Format = FormatMarkdown
+	}
+	return &Robot{
+		Target:  target,
+		limiter: NewRateLimiter(robotRateLimit, robotRateWindow),
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type markdownMsg struct {
+	Msgtype  string `json:"msgtype"`
+	Markdown struct {
+		Content string `json:"content"`
+	} `json:"markdown"`
+}
+
+type newsMsg struct {
+	Msgtype string `json:"msgtype"`
+	News    struct {
+		Articles []conversation.NewsArticle `json:"articles"`
+	} `json:"news"`
+}
+
+// 发送markdown消息 最长4096字节
+func (r *Robot) SendMarkdown(content string) error {
+	msg := markdownMsg{Msgtype: "markdown"}
+	msg.Markdown.Content = content
+	return r.send(msg)
+}
+
+// 发送图文消息 最多8篇文章
+func (r *Robot) SendNews(articles []conversation.NewsArticle) error {
+	msg := newsMsg{Msgtype: "news"}
+	msg.News.Articles = articles
+	return r.send(msg)
+}
+
+// 超过频率限制时等待后再发送
+func (r *Robot) send(msg interface{}) error {
+	jsonMsg, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	r.limiter.Wait()
+	resp, err := r.client.Post(r.Target.Url, "application/json", bytes.NewReader(jsonMsg))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	response := &conversation.InitiativeMsgResponse{}
+	if err = json.Unmarshal(body, response); err != nil {
+		return err
+	}
+	if response.Errcode != 0 {
+		return errors.New(response.Errmsg)
+	}
+	log.Printf("成功推送消息到群聊%s\n", r.Target.Name)
+	return nil
+}
+
+// 滑动窗口限流 窗口内最多发送limit次
+type RateLimiter struct {
+	limit  int
+	window time.Duration
+	sent   []time.Time
+	mutex  sync.Mutex
+	now    func() time.Time
+	sleep  func(time.Duration)
+}
+
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{limit: limit, window: window, now: time.Now, sleep: time.Sleep}
+}
+
+// 获取一次发送的机会 超出限制时返回需要等待的时间
+func (l *RateLimiter) reserve() time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	// 移除窗口外的发送记录
+	valid := l.sent[:0]
+	for _, sentAt := range l.sent {
+		if now.Sub(sentAt) < l.window {
+			valid = append(valid, sentAt)
+		}
+	}
+	l.sent = valid
+	if len(l.sent) < l.limit {
+		l.sent = append(l.sent, now)
+		return 0
+	}
+	return l.window - now.Sub(l.sent[0])
+}
+
+// 等待直到可以发送
+func (l *RateLimiter) Wait() {
+	for {
+		wait := l.reserve()
+		if wait <= 0 {
+			return
+		}
+		l.sleep(wait)
+	}
+}
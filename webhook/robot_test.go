@@ -0,0 +1,149 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"wxbot-lostandfound/conversation"
+)
+
+func TestTargetMatches(t *testing.T) {
+	cases := []struct {
+		target   Target
+		location string
+		kind     conversation.RecordKind
+		want     bool
+	}{
+		{Target{}, "杭州/西溪园区", conversation.KindLost, true},
+		{Target{Locations: []string{"杭州"}}, "杭州", conversation.KindFound, true},
+		{Target{Locations: []string{"杭州"}}, "杭州/西溪园区/3楼", conversation.KindFound, true},
+		{Target{Locations: []string{"杭州"}}, "杭州湾", conversation.KindFound, false},
+		{Target{Locations: []string{"杭州/西溪园区"}}, "杭州/滨江园区", conversation.KindFound, false},
+		{Target{Locations: []string{"上海", "杭州/西溪园区"}}, "杭州/西溪园区/3楼", conversation.KindLost, true},
+		{Target{Types: []conversation.RecordKind{conversation.KindFound}}, "杭州", conversation.KindFound, true},
+		{Target{Types: []conversation.RecordKind{conversation.KindFound}}, "杭州", conversation.KindLost, false},
+		{Target{Locations: []string{"上海"}, Types: []conversation.RecordKind{conversation.KindLost}}, "杭州", conversation.KindLost, false},
+	}
+	for _, c := range cases {
+		if got := c.target.Matches(c.location, c.kind); got != c.want {
+			t.Errorf("%+v %s %s: 期望 %v", c.target, c.location, c.kind, c.want)
+		}
+	}
+}
+
+func newStubRobot(t *testing.T) (*Robot, *Stub) {
+	stub := &Stub{}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	return NewRobot(Target{Name: "测试", Url: server.URL}), stub
+}
+
+func TestSendMarkdown(t *testing.T) {
+	robot, stub := newStubRobot(t)
+	if robot.Target.Format != FormatMarkdown {
+		t.Errorf("默认格式 %s", robot.Target.Format)
+	}
+	if err := robot.SendMarkdown("**新记录**"); err != nil {
+		t.Fatal(err)
+	}
+	messages := stub.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("收到%d条消息", len(messages))
+	}
+	var msg markdownMsg
+	if err := json.Unmarshal(messages[0], &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Msgtype != "markdown" || msg.Markdown.Content != "**新记录**" {
+		t.Errorf("markdown消息 %s", messages[0])
+	}
+}
+
+func TestSendNews(t *testing.T) {
+	robot, stub := newStubRobot(t)
+	articles := []conversation.NewsArticle{{Title: "黑色雨伞", Description: "西溪园区", Url: "https://example.com/1", Picurl: "https://example.com/1.jpg"}}
+	if err := robot.SendNews(articles); err != nil {
+		t.Fatal(err)
+	}
+	var msg newsMsg
+	if err := json.Unmarshal(stub.Messages()[0], &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Msgtype != "news" || len(msg.News.Articles) != 1 || msg.News.Articles[0] != articles[0] {
+		t.Errorf("图文消息 %+v", msg)
+	}
+}
+
+func TestSendError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errcode":45009,"errmsg":"api freq out of limit"}`))
+	}))
+	defer server.Close()
+	if err := NewRobot(Target{Url: server.URL}).SendMarkdown("test"); err == nil || err.Error() != "api freq out of limit" {
+		t.Errorf("返回错误码时应该报错 %v", err)
+	}
+}
+
+// 手动控制的时间 sleep时直接前进
+type fakeClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.slept = append(c.slept, d)
+	c.now = c.now.Add(d)
+}
+
+func newTestLimiter(limit int, window time.Duration) (*RateLimiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 3, 13, 15, 0, 0, 0, time.Local)}
+	limiter := NewRateLimiter(limit, window)
+	limiter.now, limiter.sleep = clock.Now, clock.Sleep
+	return limiter, clock
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter, clock := newTestLimiter(3, time.Minute)
+	for i := 0; i < 3; i++ {
+		limiter.Wait()
+		clock.now = clock.now.Add(10 * time.Second)
+	}
+	if len(clock.slept) != 0 {
+		t.Fatalf("限制内不需要等待 %v", clock.slept)
+	}
+	// 第一次发送在30秒前 需要再等30秒
+	limiter.Wait()
+	if len(clock.slept) != 1 || clock.slept[0] != 30*time.Second {
+		t.Errorf("超出限制时等待 %v", clock.slept)
+	}
+	// 窗口外的发送不再计数
+	clock.now = clock.now.Add(time.Minute)
+	clock.slept = nil
+	for i := 0; i < 3; i++ {
+		limiter.Wait()
+	}
+	if len(clock.slept) != 0 {
+		t.Errorf("窗口过后不需要等待 %v", clock.slept)
+	}
+}
+
+func TestRobotThrottled(t *testing.T) {
+	robot, stub := newStubRobot(t)
+	limiter, clock := newTestLimiter(robotRateLimit, robotRateWindow)
+	robot.limiter = limiter
+	for i := 0; i < robotRateLimit+1; i++ {
+		if err := robot.SendMarkdown("test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(stub.Messages()) != robotRateLimit+1 {
+		t.Errorf("收到%d条消息", len(stub.Messages()))
+	}
+	if len(clock.slept) != 1 || clock.slept[0] != robotRateWindow {
+		t.Errorf("第%d条消息需要等待一个窗口 %v", robotRateLimit+1, clock.slept)
+	}
+}
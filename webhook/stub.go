@@ -0,0 +1,34 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// 本地的群机器人替身 记录收到的消息并返回成功,用于测试和本地调试
+// 使用时将Target.Url指向该handler所在的http服务
+type Stub struct {
+	mutex    sync.Mutex
+	messages [][]byte
+}
+
+func (s *Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mutex.Lock()
+	s.messages = append(s.messages, body)
+	s.mutex.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+}
+
+// 收到的所有消息
+func (s *Stub) Messages() [][]byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([][]byte(nil), s.messages...)
+}